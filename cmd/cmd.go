@@ -3,8 +3,16 @@ package cmd
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/janu-cambrelen/proxy-service/internal/cache"
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/jsonlimit"
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
 	"github.com/janu-cambrelen/proxy-service/internal/proxyserver"
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
 	"go.uber.org/zap"
 )
 
@@ -23,7 +31,35 @@ func Run() error {
 	defer logger.Sync()
 
 	// new handler with logging middleware
-	handler := proxyserver.NewProxyServer(
+	handler, err := NewHandler(cfg, logger)
+	if err != nil {
+		return err
+	}
+	logger.Info("initializing server")
+	logger.Debug("server configuration", zap.Any("details", cfg)) // only when DEBUG=true
+
+	// serve metrics on a separate listener so they are not proxied
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddr, proxyserver.MetricsHandler()); err != http.ErrServerClosed {
+				logger.Error("unexpected metrics server error", zap.Error(err))
+			}
+		}()
+	}
+
+	// listen and serve handler
+	addr := fmt.Sprintf("%s:%v", cfg.Host, cfg.Port)
+	if err := http.ListenAndServe(addr, handler); err != http.ErrServerClosed {
+		logger.Error("unexpected server error", zap.Error(err))
+	}
+
+	return nil
+}
+
+// NewHandler creates the proxy server described by the given configuration
+// and wraps it with the request logging middleware.
+func NewHandler(cfg *Config, logger *zap.Logger) (http.Handler, error) {
+	server := proxyserver.NewProxyServer(
 		cfg.Debug,
 		cfg.TargetURL,
 		cfg.RequestDelay,
@@ -32,16 +68,175 @@ func Run() error {
 		cfg.RejectExact,
 		cfg.RejectInsensitive,
 		logger,
-		proxyserver.RequestCopy{},
-	).WithRequestLoggerMiddleware()
-	logger.Info("initializing server")
-	logger.Debug("server configuration", zap.Any("details", cfg)) // only when DEBUG=true
+	)
 
-	// listen and serve handler
-	addr := fmt.Sprintf("%s:%v", cfg.Host, cfg.Port)
-	if err := http.ListenAndServe(addr, handler); err != http.ErrServerClosed {
-		logger.Error("unexpected server error", zap.Error(err))
+	// state shared by every replica, such as rate limit buckets and idempotency records
+	store, err := statestore.Open(cfg.StateStoreURL)
+	if err != nil {
+		return nil, err
 	}
+	server.WithStateStore(store)
 
-	return nil
+	// identification of clients for consecutive request detection
+	server.WithClientIDHeader(cfg.ClientIDHeader)
+	if cfg.PriorRequestTTL > 0 {
+		server.WithPriorRequestTTL(time.Duration(cfg.PriorRequestTTL) * time.Second)
+	}
+
+	// parts of a request compared to detect consecutive requests
+	fingerprint, err := cfg.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	server.WithFingerprint(fingerprint)
+
+	// answer to consecutive identical requests, optionally escalating the delay of repeated ones
+	if cfg.DuplicateStrategy != "" {
+		server.WithDuplicateStrategy(cfg.DuplicateStrategy)
+	}
+	if cfg.DuplicateMaxDelay > 0 {
+		server.WithDuplicateEscalation(time.Duration(cfg.DuplicateMaxDelay) * time.Second)
+	}
+
+	// normalization of request bodies before they are filtered
+	normalizer, err := textnorm.Parse(cfg.Normalize)
+	if err != nil {
+		return nil, err
+	}
+	server.WithNormalizer(normalizer)
+
+	// parts of requests checked for the `REJECT_WITH` phrase, and the action taken on requests
+	// with it, which are rejected by default
+	server.WithRejectIn(splitList(cfg.RejectIn), splitList(cfg.RejectHeaders))
+	server.WithRejectAction(cfg.RejectAction, cfg.RejectReplacement)
+
+	// rejection rules, reloaded whenever the blocklist file changes
+	if cfg.BlocklistFile != "" {
+		blocklist, err := filter.Watch(cfg.BlocklistFile, normalizer, logger)
+		if err != nil {
+			return nil, err
+		}
+		server.WithBlocklist(blocklist.Filter)
+	}
+
+	// validation of requests, and optionally responses, against an OpenAPI description
+	if cfg.OpenAPIFile != "" {
+		doc, err := openapi.Load(cfg.OpenAPIFile)
+		if err != nil {
+			return nil, err
+		}
+		server.WithOpenAPI(doc, cfg.OpenAPIReportOnly, cfg.OpenAPIValidateResponses)
+	}
+
+	// masking and removal of sensitive data from responses
+	redactor, err := cfg.redactor()
+	if err != nil {
+		return nil, err
+	}
+	server.WithRedactor(redactor)
+
+	// blocking or redaction of secrets within request bodies
+	scanner, err := cfg.secretScanner()
+	if err != nil {
+		return nil, err
+	}
+	server.WithSecretScanner(scanner)
+
+	// methods allowed and denied on every route, which routes may override
+	allowMethods, err := proxyserver.ParseMethods(cfg.AllowMethods)
+	if err != nil {
+		return nil, err
+	}
+	denyMethods, err := proxyserver.ParseMethods(cfg.DenyMethods)
+	if err != nil {
+		return nil, err
+	}
+	server.WithMethods(allowMethods, denyMethods)
+
+	// media types of the request bodies accepted, which routes may override
+	contentTypes, err := proxyserver.ParseContentTypes(cfg.ContentTypes)
+	if err != nil {
+		return nil, err
+	}
+	server.WithContentTypes(contentTypes, cfg.ContentTypeSkipBodyless, cfg.ValidateJSON)
+
+	// structural limits of JSON request bodies
+	server.WithJSONLimits(jsonlimit.Limits{
+		MaxDepth:        int(cfg.JSONMaxDepth),
+		MaxTokens:       int(cfg.JSONMaxTokens),
+		MaxKeys:         int(cfg.JSONMaxKeys),
+		MaxArrayLength:  int(cfg.JSONMaxArrayLength),
+		MaxStringLength: int(cfg.JSONMaxStringLength),
+	})
+
+	// checks whose decisions are only logged and counted
+	dryRun, err := proxyserver.ParseDryRun(cfg.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	server.WithDryRun(dryRun)
+
+	// admission of requests according to the rules of a policy
+	if cfg.PolicyFile != "" {
+		p, err := policy.Load(cfg.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		server.WithPolicy(p)
+	}
+
+	// status and body of the errors written to clients
+	statuses, err := proxyserver.ParseErrorStatus(cfg.ErrorStatus)
+	if err != nil {
+		return nil, err
+	}
+	server.WithErrorStatus(statuses)
+	if cfg.ErrorTemplateFile != "" {
+		tmpl, err := proxyserver.LoadErrorTemplate(cfg.ErrorTemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		server.WithErrorTemplate(tmpl)
+	}
+	if cfg.ErrorFormat == "problem" {
+		server.WithProblemDetails(cfg.ProblemTypeBase)
+	}
+
+	if cfg.RoutesFile != "" {
+		routes, err := proxyserver.LoadRoutes(cfg.RoutesFile)
+		if err != nil {
+			return nil, err
+		}
+		server.WithRoutes(routes)
+	}
+
+	// response cache, file-backed when a cache directory is configured
+	if cfg.CacheTTL > 0 {
+		var storage cache.Storage = cache.NewMemoryStorage()
+		if cfg.CacheDir != "" {
+			fs, err := cache.NewFileStorage(cfg.CacheDir)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create cache directory: %s", err.Error())
+			}
+			storage = fs
+		}
+		server.WithCache(cache.New(
+			storage,
+			time.Duration(cfg.CacheTTL)*time.Second,
+			time.Duration(cfg.CacheStaleWhileRevalidate)*time.Second,
+			time.Duration(cfg.CacheStaleIfError)*time.Second,
+		))
+	}
+
+	// replay of responses to requests carrying an `Idempotency-Key` header
+	if cfg.IdempotencyTTL > 0 {
+		server.WithIdempotency(time.Duration(cfg.IdempotencyTTL) * time.Second)
+	}
+
+	// token bucket rate limiting
+	if cfg.RateLimitRate > 0 {
+		server.WithRateLimit(cfg.RateLimitRate, cfg.RateLimitBurst, cfg.RateLimitBy, cfg.RateLimitHeader)
+	}
+
+	return server.WithRequestLoggerMiddleware(), nil
 }
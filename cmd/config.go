@@ -4,22 +4,79 @@ import (
 	"flag"
 	"fmt"
 	"net/url"
+	"strings"
 
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
+	"github.com/janu-cambrelen/proxy-service/internal/proxyserver"
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
 	"github.com/spf13/viper"
 )
 
 // Config defines the server configuration.
 type Config struct {
-	Source            string // the source from which the config was loaded
-	Debug             bool   `mapstructure:"DEBUG"`              // set debug mode
-	Host              string `mapstructure:"HOST"`               // proxy server host name
-	Port              int    `mapstructure:"PORT"`               // proxy server port number
-	TargetURL         string `mapstructure:"TARGET_URL"`         // url of target backend service
-	RequestDelay      uint   `mapstructure:"REQUEST_DELAY"`      // number of seconds to delay consecutive requests
-	BodyMethodsOnly   bool   `mapstructure:"BODY_METHODS_ONLY"`  // whether to accept only POST, PUT, PATCH requests
-	RejectWith        string `mapstructure:"REJECT_WITH"`        // reject requests with the specified word / phrase
-	RejectExact       bool   `mapstructure:"REJECT_EXACT"`       // whether to reject based on exact match, otherwise it will filter if 'contains'
-	RejectInsensitive bool   `mapstructure:"REJECT_INSENSITIVE"` // whether to perform case insensitive rejection validation
+	Source                    string  // the source from which the config was loaded
+	Debug                     bool    `mapstructure:"DEBUG"`                        // set debug mode
+	Host                      string  `mapstructure:"HOST"`                         // proxy server host name
+	Port                      int     `mapstructure:"PORT"`                         // proxy server port number
+	TargetURL                 string  `mapstructure:"TARGET_URL"`                   // url of target backend service
+	RequestDelay              uint    `mapstructure:"REQUEST_DELAY"`                // number of seconds to delay consecutive requests
+	BodyMethodsOnly           bool    `mapstructure:"BODY_METHODS_ONLY"`            // whether to accept only POST, PUT, PATCH requests, deprecated in favor of ALLOW_METHODS
+	AllowMethods              string  `mapstructure:"ALLOW_METHODS"`                // comma-separated methods allowed on every route, which routes may replace, every method when empty
+	DenyMethods               string  `mapstructure:"DENY_METHODS"`                 // comma-separated methods denied on every route
+	RejectWith                string  `mapstructure:"REJECT_WITH"`                  // reject requests with the specified word / phrase
+	RejectExact               bool    `mapstructure:"REJECT_EXACT"`                 // whether to reject based on exact match, otherwise it will filter if 'contains'
+	RejectInsensitive         bool    `mapstructure:"REJECT_INSENSITIVE"`           // whether to perform case insensitive rejection validation
+	RejectAction              string  `mapstructure:"REJECT_ACTION"`                // what happens to requests with the REJECT_WITH phrase: 'reject', 'log', 'mask', 'drop' or 'tag', defaults to 'reject' when empty
+	RejectReplacement         string  `mapstructure:"REJECT_REPLACEMENT"`           // text replacing the REJECT_WITH phrase when REJECT_ACTION is 'mask', defaults to '***' when empty
+	RejectIn                  string  `mapstructure:"REJECT_IN"`                    // comma-separated parts of requests checked for the REJECT_WITH phrase: 'path', 'query', 'headers' or 'body', defaults to 'body' when empty
+	RejectHeaders             string  `mapstructure:"REJECT_HEADERS"`               // comma-separated headers checked for the REJECT_WITH phrase when REJECT_IN holds 'headers', every header when empty
+	CacheTTL                  uint    `mapstructure:"CACHE_TTL"`                    // number of seconds responses to safe requests are cached, caching is disabled when 0
+	CacheStaleWhileRevalidate uint    `mapstructure:"CACHE_STALE_WHILE_REVALIDATE"` // number of seconds past the TTL a stale response may be served while it is revalidated
+	CacheStaleIfError         uint    `mapstructure:"CACHE_STALE_IF_ERROR"`         // number of seconds past the TTL a stale response may be served when the backend fails
+	CacheDir                  string  `mapstructure:"CACHE_DIR"`                    // directory for the file-backed cache, responses are cached in memory when empty
+	RoutesFile                string  `mapstructure:"ROUTES_FILE"`                  // path to a JSON file with per-route settings
+	MetricsAddr               string  `mapstructure:"METRICS_ADDR"`                 // address to serve metrics on, metrics are not served when empty
+	IdempotencyTTL            uint    `mapstructure:"IDEMPOTENCY_TTL"`              // number of seconds responses to requests with an Idempotency-Key are replayed, disabled when 0
+	RateLimitRate             float64 `mapstructure:"RATE_LIMIT_RATE"`              // number of requests per second allowed per rate limit key, rate limiting is disabled when 0
+	RateLimitBurst            uint    `mapstructure:"RATE_LIMIT_BURST"`             // number of requests allowed in a burst per rate limit key
+	RateLimitBy               string  `mapstructure:"RATE_LIMIT_BY"`                // how requests are grouped for rate limiting: 'ip', 'header' or 'route'
+	RateLimitHeader           string  `mapstructure:"RATE_LIMIT_HEADER"`            // identifying header used when RATE_LIMIT_BY is 'header'
+	StateStoreURL             string  `mapstructure:"STATE_STORE_URL"`              // url of the store shared by replicas (e.g., redis://localhost:6379/0), state is held in memory when empty
+	ClientIDHeader            string  `mapstructure:"CLIENT_ID_HEADER"`             // header identifying clients for consecutive request detection, clients are identified by IP when empty
+	PriorRequestTTL           uint    `mapstructure:"PRIOR_REQUEST_TTL"`            // number of seconds the prior request of each client is remembered, defaults to 60 when 0
+	FingerprintHeaders        string  `mapstructure:"FINGERPRINT_HEADERS"`          // comma-separated headers compared to detect consecutive requests, a common subset is used when empty
+	FingerprintQuery          string  `mapstructure:"FINGERPRINT_QUERY"`            // comma-separated query parameters compared to detect consecutive requests, all are compared when empty
+	FingerprintBodyFields     string  `mapstructure:"FINGERPRINT_BODY_FIELDS"`      // comma-separated JSON body paths (e.g., $.user.id) compared to detect consecutive requests, the whole body is compared when empty
+	DuplicateStrategy         string  `mapstructure:"DUPLICATE_STRATEGY"`           // how consecutive identical requests are answered: 'delay', 'reject', 'conflict' or 'replay', defaults to 'delay' when empty
+	DuplicateMaxDelay         uint    `mapstructure:"DUPLICATE_MAX_DELAY"`          // number of seconds the delay of repeated duplicates escalates to, doubling each time, escalation is disabled when 0
+	BlocklistFile             string  `mapstructure:"BLOCKLIST_FILE"`               // path to a JSON file with rejection rules, reloaded whenever it changes
+	Normalize                 string  `mapstructure:"NORMALIZE"`                    // comma-separated normalization steps applied before filtering: 'invisible', 'nfkc', 'casefold', 'confusables', 'leetspeak' or 'all'
+	OpenAPIFile               string  `mapstructure:"OPENAPI_FILE"`                 // path to an OpenAPI 3 description (JSON or YAML) requests are validated against, replacing BODY_METHODS_ONLY
+	OpenAPIReportOnly         bool    `mapstructure:"OPENAPI_REPORT_ONLY"`          // whether violations of the OpenAPI description are only logged rather than rejected
+	OpenAPIValidateResponses  bool    `mapstructure:"OPENAPI_VALIDATE_RESPONSES"`   // whether responses of the backend are validated against the OpenAPI description as well
+	RedactFields              string  `mapstructure:"REDACT_FIELDS"`                // comma-separated JSON paths (e.g., $.user.email) of response fields whose values are masked
+	RemoveFields              string  `mapstructure:"REMOVE_FIELDS"`                // comma-separated JSON paths of response fields that are removed
+	RedactPatterns            string  `mapstructure:"REDACT_PATTERNS"`              // comma-separated personal information masked within responses: 'email', 'phone', 'ssn', 'card' or 'all'
+	RedactMask                string  `mapstructure:"REDACT_MASK"`                  // text replacing redacted values, defaults to '[REDACTED]' when empty
+	DryRun                    string  `mapstructure:"DRY_RUN"`                      // comma-separated checks whose decisions are only logged and counted: 'method', 'content_type', 'reject', 'blocklist', 'secrets', 'policy', 'rate_limit', 'json_limits' or 'all'
+	PolicyFile                string  `mapstructure:"POLICY_FILE"`                  // path to a JSON file with policy rules allowing, denying, tagging or routing requests according to expressions
+	ErrorStatus               string  `mapstructure:"ERROR_STATUS"`                 // comma-separated error classes, each followed by the status written for them (e.g., 'rejected_content:422,secret_detected:403')
+	ErrorTemplateFile         string  `mapstructure:"ERROR_TEMPLATE_FILE"`          // path to a JSON error body template referencing variables such as {{request_id}}, {{rule}} or {{timestamp}}
+	ErrorFormat               string  `mapstructure:"ERROR_FORMAT"`                 // format of the errors written to clients: 'json' ({"code", "msg"}) or 'problem' (RFC 7807 application/problem+json), defaults to 'json'
+	ProblemTypeBase           string  `mapstructure:"PROBLEM_TYPE_BASE"`            // URI prefixed to the class of errors to form the type of problem details, defaults to 'urn:proxy-service:error:'
+	SecretDetectors           string  `mapstructure:"SECRET_DETECTORS"`             // comma-separated detectors of secrets within request bodies, each optionally followed by ':block' (default) or ':redact': 'aws_key', 'private_key', 'jwt', 'token', 'card' or 'all'
+	ContentTypes              string  `mapstructure:"CONTENT_TYPES"`                // comma-separated media types of the request bodies accepted, which may hold wildcards (e.g., 'application/*+json'), defaults to 'application/json,application/*+json' when empty
+	ContentTypeSkipBodyless   bool    `mapstructure:"CONTENT_TYPE_SKIP_BODYLESS"`   // whether requests without a body are accepted whatever their Content-Type, or lack thereof
+	ValidateJSON              bool    `mapstructure:"VALIDATE_JSON"`                // whether request bodies of JSON media types must be well-formed JSON
+	JSONMaxDepth              uint    `mapstructure:"JSON_MAX_DEPTH"`               // maximum nesting depth of JSON request bodies, not limited when 0
+	JSONMaxTokens             uint    `mapstructure:"JSON_MAX_TOKENS"`              // maximum total number of tokens (delimiters, keys and values) of JSON request bodies, not limited when 0
+	JSONMaxKeys               uint    `mapstructure:"JSON_MAX_KEYS"`                // maximum number of keys of each object of JSON request bodies, not limited when 0
+	JSONMaxArrayLength        uint    `mapstructure:"JSON_MAX_ARRAY_LENGTH"`        // maximum number of elements of each array of JSON request bodies, not limited when 0
+	JSONMaxStringLength       uint    `mapstructure:"JSON_MAX_STRING_LENGTH"`       // maximum length in bytes of each string, keys included, of JSON request bodies, not limited when 0
 }
 
 // validate is method to validate the server configuration.
@@ -32,9 +89,182 @@ func (c *Config) validate() error {
 		return fmt.Errorf("invalid target url: %s", err.Error())
 	}
 
+	// validate RejectAction
+	switch c.RejectAction {
+	case "", filter.ActionReject, filter.ActionLog, filter.ActionMask, filter.ActionDrop, filter.ActionTag:
+	default:
+		return fmt.Errorf("invalid reject action: %q must be one of 'reject', 'log', 'mask', 'drop' or 'tag'", c.RejectAction)
+	}
+
+	// validate RejectIn and RejectHeaders
+	if _, err := filter.New([]filter.Rule{{
+		Phrase:  "reject",
+		Action:  c.RejectAction,
+		In:      splitList(c.RejectIn),
+		Headers: splitList(c.RejectHeaders),
+	}}, textnorm.Normalizer{}); err != nil {
+		return fmt.Errorf("invalid reject parts: %s", strings.TrimPrefix(err.Error(), "rule 0: "))
+	}
+
+	// validate AllowMethods and DenyMethods
+	if _, err := proxyserver.ParseMethods(c.AllowMethods); err != nil {
+		return fmt.Errorf("invalid allowed methods: %s", err.Error())
+	}
+	if _, err := proxyserver.ParseMethods(c.DenyMethods); err != nil {
+		return fmt.Errorf("invalid denied methods: %s", err.Error())
+	}
+
+	// validate ContentTypes
+	if _, err := proxyserver.ParseContentTypes(c.ContentTypes); err != nil {
+		return fmt.Errorf("invalid content types: %s", err.Error())
+	}
+
+	// validate rate limit settings
+	if c.RateLimitRate < 0 {
+		return fmt.Errorf("invalid rate limit rate: must not be negative")
+	}
+	if c.RateLimitRate > 0 {
+		switch c.RateLimitBy {
+		case "", proxyserver.RateLimitByIP, proxyserver.RateLimitByHeader, proxyserver.RateLimitByRoute:
+		default:
+			return fmt.Errorf("invalid rate limit key: %q must be one of 'ip', 'header' or 'route'", c.RateLimitBy)
+		}
+		if c.RateLimitBurst == 0 {
+			return fmt.Errorf("invalid rate limit burst: must be at least 1")
+		}
+		if c.RateLimitBy == proxyserver.RateLimitByHeader && c.RateLimitHeader == "" {
+			return fmt.Errorf("invalid rate limit header: must be set when rate limiting by header")
+		}
+	}
+
+	// validate duplicate request settings
+	switch c.DuplicateStrategy {
+	case "", proxyserver.DuplicateDelay, proxyserver.DuplicateReject, proxyserver.DuplicateConflict, proxyserver.DuplicateReplay:
+	default:
+		return fmt.Errorf("invalid duplicate strategy: %q must be one of 'delay', 'reject', 'conflict' or 'replay'", c.DuplicateStrategy)
+	}
+	if c.DuplicateMaxDelay > 0 && c.RequestDelay == 0 {
+		return fmt.Errorf("invalid duplicate max delay: the request delay must be set for the delay to escalate")
+	}
+	if c.DuplicateMaxDelay > 0 && c.DuplicateMaxDelay < c.RequestDelay {
+		return fmt.Errorf("invalid duplicate max delay: must not be less than the request delay")
+	}
+
+	// validate StateStoreURL
+	if _, err := statestore.Open(c.StateStoreURL); err != nil {
+		return fmt.Errorf("invalid state store url: %s", err.Error())
+	}
+
+	// validate fingerprint settings
+	if _, err := c.fingerprint(); err != nil {
+		return fmt.Errorf("invalid fingerprint: %s", err.Error())
+	}
+
+	// validate Normalize
+	normalizer, err := textnorm.Parse(c.Normalize)
+	if err != nil {
+		return fmt.Errorf("invalid normalization: %s", err.Error())
+	}
+
+	// validate BlocklistFile
+	if c.BlocklistFile != "" {
+		if _, err := filter.Load(c.BlocklistFile, normalizer); err != nil {
+			return fmt.Errorf("invalid blocklist file: %s", err.Error())
+		}
+	}
+
+	// validate redaction settings
+	if _, err := c.redactor(); err != nil {
+		return fmt.Errorf("invalid redaction: %s", err.Error())
+	}
+
+	// validate SecretDetectors
+	if _, err := c.secretScanner(); err != nil {
+		return fmt.Errorf("invalid secret detectors: %s", err.Error())
+	}
+
+	// validate DryRun
+	if _, err := proxyserver.ParseDryRun(c.DryRun); err != nil {
+		return fmt.Errorf("invalid dry run: %s", err.Error())
+	}
+
+	// validate PolicyFile
+	if c.PolicyFile != "" {
+		if _, err := policy.Load(c.PolicyFile); err != nil {
+			return fmt.Errorf("invalid policy file: %s", err.Error())
+		}
+	}
+
+	// validate ErrorStatus
+	if _, err := proxyserver.ParseErrorStatus(c.ErrorStatus); err != nil {
+		return fmt.Errorf("invalid error status: %s", err.Error())
+	}
+
+	// validate ErrorTemplateFile
+	if c.ErrorTemplateFile != "" {
+		if _, err := proxyserver.LoadErrorTemplate(c.ErrorTemplateFile); err != nil {
+			return fmt.Errorf("invalid error template file: %s", err.Error())
+		}
+	}
+
+	// validate ErrorFormat
+	switch c.ErrorFormat {
+	case "", "json":
+	case "problem":
+		if c.ErrorTemplateFile != "" {
+			return fmt.Errorf("the `problem` error format and an error template file are mutually exclusive")
+		}
+	default:
+		return fmt.Errorf("invalid error format %q must be one of 'json' or 'problem'", c.ErrorFormat)
+	}
+
+	// validate OpenAPIFile
+	if c.OpenAPIFile != "" {
+		if _, err := openapi.Load(c.OpenAPIFile); err != nil {
+			return fmt.Errorf("invalid openapi file: %s", err.Error())
+		}
+	}
+
+	// validate RoutesFile
+	if c.RoutesFile != "" {
+		if _, err := proxyserver.LoadRoutes(c.RoutesFile); err != nil {
+			return fmt.Errorf("invalid routes file: %s", err.Error())
+		}
+	}
+
 	return nil
 }
 
+// fingerprint returns the consecutive request fingerprint described by the configuration.
+func (c *Config) fingerprint() (*proxyserver.Fingerprint, error) {
+	headers := splitList(c.FingerprintHeaders)
+	if len(headers) == 0 {
+		headers = proxyserver.DefaultFingerprintHeaders
+	}
+	return proxyserver.NewFingerprint(headers, splitList(c.FingerprintQuery), splitList(c.FingerprintBodyFields))
+}
+
+// redactor returns the redactor of response bodies described by the configuration.
+func (c *Config) redactor() (*redact.Redactor, error) {
+	return redact.New(c.RedactMask, splitList(c.RedactFields), splitList(c.RemoveFields), splitList(c.RedactPatterns))
+}
+
+// secretScanner returns the scanner of request bodies for secrets described by the configuration.
+func (c *Config) secretScanner() (*redact.Scanner, error) {
+	return redact.ParseScanner(c.SecretDetectors, c.RedactMask)
+}
+
+// splitList splits a comma-separated list, ignoring surrounding whitespace and empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // SetConfig loads configuration from a specified file or from flags/defaults.
 // It first attempts to set config values using a file that lives at the
 // given path and has the given name.  If it encounters an error, it then attempts
@@ -93,13 +323,111 @@ func loadFlags() (*Config, error) {
 	flag.UintVar(
 		&cfg.RequestDelay, "request-delay", 2, "number of seconds to delay consecutive requests")
 	flag.BoolVar(
-		&cfg.BodyMethodsOnly, "body-methods-only", false, "accept POST, PUT, PATCH requests only")
+		&cfg.BodyMethodsOnly, "body-methods-only", false, "accept POST, PUT, PATCH requests only, deprecated in favor of allow-methods")
+	flag.StringVar(
+		&cfg.AllowMethods, "allow-methods", "", "comma-separated methods allowed on every route, which routes may replace, every method when empty")
+	flag.StringVar(
+		&cfg.DenyMethods, "deny-methods", "", "comma-separated methods denied on every route")
 	flag.StringVar(
 		&cfg.RejectWith, "reject-with", "", "reject requests with the specified word / phrase")
 	flag.BoolVar(
 		&cfg.RejectExact, "reject-exact", false, "whether to reject based on exact match, otherwise it will filter if 'contains'")
 	flag.BoolVar(
 		&cfg.RejectInsensitive, "reject-insensitive", false, "whether to perform case insensitive rejection validation")
+	flag.StringVar(
+		&cfg.RejectAction, "reject-action", filter.ActionReject, "what happens to requests with the reject-with phrase: 'reject', 'log', 'mask', 'drop' or 'tag'")
+	flag.StringVar(
+		&cfg.RejectReplacement, "reject-replacement", filter.DefaultReplacement, "text replacing the reject-with phrase when reject-action is 'mask'")
+	flag.StringVar(
+		&cfg.RejectIn, "reject-in", filter.PartBody, "comma-separated parts of requests checked for the reject-with phrase: 'path', 'query', 'headers' or 'body'")
+	flag.StringVar(
+		&cfg.RejectHeaders, "reject-headers", "", "comma-separated headers checked for the reject-with phrase when reject-in holds 'headers', every header when empty")
+	flag.UintVar(
+		&cfg.CacheTTL, "cache-ttl", 0, "number of seconds responses to safe requests are cached, caching is disabled when 0")
+	flag.UintVar(
+		&cfg.CacheStaleWhileRevalidate, "cache-stale-while-revalidate", 0, "number of seconds past the TTL a stale response may be served while it is revalidated")
+	flag.UintVar(
+		&cfg.CacheStaleIfError, "cache-stale-if-error", 0, "number of seconds past the TTL a stale response may be served when the backend fails")
+	flag.StringVar(
+		&cfg.CacheDir, "cache-dir", "", "directory for the file-backed cache, responses are cached in memory when empty")
+	flag.StringVar(
+		&cfg.RoutesFile, "routes-file", "", "path to a JSON file with per-route settings")
+	flag.StringVar(
+		&cfg.MetricsAddr, "metrics-addr", "", "address to serve metrics on, metrics are not served when empty")
+	flag.UintVar(
+		&cfg.IdempotencyTTL, "idempotency-ttl", 0, "number of seconds responses to requests with an Idempotency-Key are replayed, disabled when 0")
+	flag.Float64Var(
+		&cfg.RateLimitRate, "rate-limit-rate", 0, "number of requests per second allowed per rate limit key, rate limiting is disabled when 0")
+	flag.UintVar(
+		&cfg.RateLimitBurst, "rate-limit-burst", 1, "number of requests allowed in a burst per rate limit key")
+	flag.StringVar(
+		&cfg.RateLimitBy, "rate-limit-by", "ip", "how requests are grouped for rate limiting: 'ip', 'header' or 'route'")
+	flag.StringVar(
+		&cfg.RateLimitHeader, "rate-limit-header", "X-API-Key", "identifying header used when rate-limit-by is 'header'")
+	flag.StringVar(
+		&cfg.StateStoreURL, "state-store-url", "", "url of the store shared by replicas (e.g., redis://localhost:6379/0), state is held in memory when empty")
+	flag.StringVar(
+		&cfg.ClientIDHeader, "client-id-header", "", "header identifying clients for consecutive request detection, clients are identified by IP when empty")
+	flag.UintVar(
+		&cfg.PriorRequestTTL, "prior-request-ttl", 60, "number of seconds the prior request of each client is remembered")
+	flag.StringVar(
+		&cfg.FingerprintHeaders, "fingerprint-headers", "", "comma-separated headers compared to detect consecutive requests, a common subset is used when empty")
+	flag.StringVar(
+		&cfg.FingerprintQuery, "fingerprint-query", "", "comma-separated query parameters compared to detect consecutive requests, all are compared when empty")
+	flag.StringVar(
+		&cfg.FingerprintBodyFields, "fingerprint-body-fields", "", "comma-separated JSON body paths (e.g., $.user.id) compared to detect consecutive requests, the whole body is compared when empty")
+	flag.StringVar(
+		&cfg.DuplicateStrategy, "duplicate-strategy", "delay", "how consecutive identical requests are answered: 'delay', 'reject', 'conflict' or 'replay'")
+	flag.UintVar(
+		&cfg.DuplicateMaxDelay, "duplicate-max-delay", 0, "number of seconds the delay of repeated duplicates escalates to, doubling each time, escalation is disabled when 0")
+	flag.StringVar(
+		&cfg.BlocklistFile, "blocklist-file", "", "path to a JSON file with rejection rules, reloaded whenever it changes")
+	flag.StringVar(
+		&cfg.Normalize, "normalize", "", "comma-separated normalization steps applied before filtering: 'invisible', 'nfkc', 'casefold', 'confusables', 'leetspeak' or 'all'")
+	flag.StringVar(
+		&cfg.OpenAPIFile, "openapi-file", "", "path to an OpenAPI 3 description (JSON or YAML) requests are validated against, replacing body-methods-only")
+	flag.BoolVar(
+		&cfg.OpenAPIReportOnly, "openapi-report-only", false, "whether violations of the OpenAPI description are only logged rather than rejected")
+	flag.BoolVar(
+		&cfg.OpenAPIValidateResponses, "openapi-validate-responses", false, "whether responses of the backend are validated against the OpenAPI description as well")
+	flag.StringVar(
+		&cfg.RedactFields, "redact-fields", "", "comma-separated JSON paths (e.g., $.user.email) of response fields whose values are masked")
+	flag.StringVar(
+		&cfg.RemoveFields, "remove-fields", "", "comma-separated JSON paths of response fields that are removed")
+	flag.StringVar(
+		&cfg.RedactPatterns, "redact-patterns", "", "comma-separated personal information masked within responses: 'email', 'phone', 'ssn', 'card' or 'all'")
+	flag.StringVar(
+		&cfg.RedactMask, "redact-mask", redact.DefaultMask, "text replacing redacted values")
+	flag.StringVar(
+		&cfg.DryRun, "dry-run", "", "comma-separated checks whose decisions are only logged and counted: 'method', 'content_type', 'reject', 'blocklist', 'secrets', 'policy', 'rate_limit', 'json_limits' or 'all'")
+	flag.StringVar(
+		&cfg.PolicyFile, "policy-file", "", "path to a JSON file with policy rules allowing, denying, tagging or routing requests according to expressions")
+	flag.StringVar(
+		&cfg.ErrorStatus, "error-status", "", "comma-separated error classes, each followed by the status written for them (e.g., 'rejected_content:422,secret_detected:403')")
+	flag.StringVar(
+		&cfg.ErrorTemplateFile, "error-template-file", "", "path to a JSON error body template referencing variables such as {{request_id}}, {{rule}} or {{timestamp}}")
+	flag.StringVar(
+		&cfg.ErrorFormat, "error-format", "json", "format of the errors written to clients: 'json' ({\"code\", \"msg\"}) or 'problem' (RFC 7807 application/problem+json)")
+	flag.StringVar(
+		&cfg.ProblemTypeBase, "problem-type-base", proxyserver.DefaultProblemTypeBase, "URI prefixed to the class of errors to form the type of problem details")
+	flag.StringVar(
+		&cfg.SecretDetectors, "secret-detectors", "", "comma-separated detectors of secrets within request bodies, each optionally followed by ':block' (default) or ':redact': 'aws_key', 'private_key', 'jwt', 'token', 'card' or 'all'")
+	flag.StringVar(
+		&cfg.ContentTypes, "content-types", strings.Join(proxyserver.DefaultContentTypes, ","), "comma-separated media types of the request bodies accepted, which may hold wildcards (e.g., 'application/*+json')")
+	flag.BoolVar(
+		&cfg.ContentTypeSkipBodyless, "content-type-skip-bodyless", false, "whether requests without a body are accepted whatever their Content-Type, or lack thereof")
+	flag.BoolVar(
+		&cfg.ValidateJSON, "validate-json", false, "whether request bodies of JSON media types must be well-formed JSON")
+	flag.UintVar(
+		&cfg.JSONMaxDepth, "json-max-depth", 0, "maximum nesting depth of JSON request bodies, not limited when 0")
+	flag.UintVar(
+		&cfg.JSONMaxTokens, "json-max-tokens", 0, "maximum total number of tokens (delimiters, keys and values) of JSON request bodies, not limited when 0")
+	flag.UintVar(
+		&cfg.JSONMaxKeys, "json-max-keys", 0, "maximum number of keys of each object of JSON request bodies, not limited when 0")
+	flag.UintVar(
+		&cfg.JSONMaxArrayLength, "json-max-array-length", 0, "maximum number of elements of each array of JSON request bodies, not limited when 0")
+	flag.UintVar(
+		&cfg.JSONMaxStringLength, "json-max-string-length", 0, "maximum length in bytes of each string, keys included, of JSON request bodies, not limited when 0")
 	flag.Parse()
 
 	err := cfg.validate()
@@ -7,7 +7,6 @@ import (
 	"testing"
 
 	"github.com/janu-cambrelen/proxy-service/cmd"
-	"github.com/janu-cambrelen/proxy-service/internal/proxyserver"
 	"go.uber.org/zap"
 )
 
@@ -32,17 +31,10 @@ func TestMain(m *testing.M) {
 	defer logger.Sync()
 
 	// new handler with logging middleware
-	handler := proxyserver.NewProxyServer(
-		cfg.Debug,
-		cfg.TargetURL,
-		cfg.RequestDelay,
-		cfg.BodyMethodsOnly,
-		cfg.RejectWith,
-		cfg.RejectExact,
-		cfg.RejectInsensitive,
-		logger,
-		proxyserver.RequestCopy{},
-	).WithRequestLoggerMiddleware()
+	handler, err := cmd.NewHandler(cfg, logger)
+	if err != nil {
+		panic(err)
+	}
 	logger.Info("initializing server")
 	logger.Debug("server configuration", zap.Any("details", cfg)) // only when DEBUG=true
 
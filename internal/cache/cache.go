@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Storage when no entry exists for the given key.
+var ErrNotFound = errors.New("cache entry not found")
+
+// Entry defines a cached backend response.
+type Entry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// sweepInterval is how often the Cache deletes entries too old to be served from storage.
+const sweepInterval = time.Minute
+
+// Storage defines a pluggable cache storage backend. Implementations must be
+// safe for concurrent use. A Storage does not apply any expiration policy itself,
+// entries are retained until they are deleted by the Cache.
+type Storage interface {
+	Get(key string) (*Entry, error)
+	Set(key string, e *Entry) error
+	Delete(key string) error
+	// Sweep deletes the entries stored before the given time.
+	Sweep(before time.Time) error
+}
+
+// Freshness describes the state of a cache entry at lookup time.
+type Freshness int
+
+const (
+	// Miss means there is no usable entry for the key.
+	Miss Freshness = iota
+	// Fresh means the entry is younger than the TTL and may be served as is.
+	Fresh
+	// Stale means the entry is past its TTL but within the stale-while-revalidate
+	// window, it may be served while it is revalidated in the background.
+	Stale
+	// Expired means the entry may only be served if the backend fails and the
+	// entry is still within the stale-if-error window.
+	Expired
+)
+
+// Cache applies a freshness policy on top of a Storage.
+type Cache struct {
+	storage              Storage
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	now                  func() time.Time
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+	lastSweep    time.Time
+}
+
+// New constructor creates a new Cache. Entries are fresh for `ttl`, may be served
+// while revalidating for a further `swr`, and may be served in place of a backend
+// error for a further `sie`.
+func New(s Storage, ttl, swr, sie time.Duration) *Cache {
+	c := &Cache{
+		storage:              s,
+		ttl:                  ttl,
+		staleWhileRevalidate: swr,
+		staleIfError:         sie,
+		now:                  time.Now,
+		revalidating:         map[string]bool{},
+	}
+	return c
+}
+
+// Lookup returns the entry stored for key along with its freshness. Entries that
+// are too old to be served under any circumstance are deleted from storage.
+func (c *Cache) Lookup(key string) (*Entry, Freshness) {
+	e, err := c.storage.Get(key)
+	if err != nil {
+		return nil, Miss
+	}
+
+	age := c.Age(e)
+	switch {
+	case age < c.ttl:
+		return e, Fresh
+	case age < c.ttl+c.staleWhileRevalidate:
+		return e, Stale
+	case age < c.ttl+c.staleIfError:
+		return e, Expired
+	}
+
+	_ = c.storage.Delete(key)
+	return nil, Miss
+}
+
+// Store saves the entry under key, stamping it with the current time. At most once per
+// sweep interval, entries too old to be served under any circumstance are also deleted from
+// storage, since entries that are never looked up again would otherwise be retained forever.
+// The first entry stored sweeps those left by previous runs.
+func (c *Cache) Store(key string, e *Entry) error {
+	e.StoredAt = c.now()
+	if err := c.storage.Set(key, e); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	sweep := e.StoredAt.Sub(c.lastSweep) >= sweepInterval
+	if sweep {
+		c.lastSweep = e.StoredAt
+	}
+	c.mu.Unlock()
+	if sweep {
+		return c.storage.Sweep(e.StoredAt.Add(-c.maxAge()))
+	}
+	return nil
+}
+
+// maxAge returns the age past which entries may no longer be served.
+func (c *Cache) maxAge() time.Duration {
+	if c.staleIfError > c.staleWhileRevalidate {
+		return c.ttl + c.staleIfError
+	}
+	return c.ttl + c.staleWhileRevalidate
+}
+
+// Age returns how long ago the entry was stored.
+func (c *Cache) Age(e *Entry) time.Duration {
+	return c.now().Sub(e.StoredAt)
+}
+
+// ServableOnError reports whether the entry is within the stale-if-error window
+// and may be served in place of a failed backend response.
+func (c *Cache) ServableOnError(e *Entry) bool {
+	return c.Age(e) < c.ttl+c.staleIfError
+}
+
+// BeginRevalidation marks key as being revalidated. It returns false if a
+// revalidation for key is already in flight, in which case the caller should not
+// start another one. Callers that receive true must call EndRevalidation.
+func (c *Cache) BeginRevalidation(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revalidating[key] {
+		return false
+	}
+	c.revalidating[key] = true
+	return true
+}
+
+// EndRevalidation clears the in-flight revalidation mark for key.
+func (c *Cache) EndRevalidation(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.revalidating, key)
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStorage tests the Storage implementations
+func TestStorage(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	for name, s := range map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"file":   fs,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Get("GET http://backend/posts/1")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			e := &Entry{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       []byte(`{"id": 1}`),
+				StoredAt:   time.Now().UTC(),
+			}
+			assert.NoError(t, s.Set("GET http://backend/posts/1", e))
+
+			got, err := s.Get("GET http://backend/posts/1")
+			assert.NoError(t, err)
+			assert.Equal(t, e.StatusCode, got.StatusCode)
+			assert.Equal(t, e.Header, got.Header)
+			assert.Equal(t, e.Body, got.Body)
+			assert.True(t, e.StoredAt.Equal(got.StoredAt))
+
+			assert.NoError(t, s.Delete("GET http://backend/posts/1"))
+			assert.NoError(t, s.Delete("GET http://backend/posts/1"))
+			_, err = s.Get("GET http://backend/posts/1")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+// TestFileStoragePersists tests that entries written by one FileStorage are read by another
+func TestFileStoragePersists(t *testing.T) {
+	dir := t.TempDir()
+
+	s1, err := NewFileStorage(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, s1.Set("key", &Entry{StatusCode: 200, Body: []byte(`{}`)}))
+
+	s2, err := NewFileStorage(dir)
+	assert.NoError(t, err)
+	got, err := s2.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{}`), got.Body)
+}
+
+// TestLookup tests the freshness policy applied by Cache
+func TestLookup(t *testing.T) {
+
+	type unitTestCase struct {
+		age       time.Duration
+		freshness Freshness
+		onError   bool
+	}
+
+	now := time.Now()
+	c := New(NewMemoryStorage(), 10*time.Second, 5*time.Second, 20*time.Second)
+	c.now = func() time.Time { return now }
+
+	for _, tCase := range []unitTestCase{
+		{age: 0, freshness: Fresh, onError: true},
+		{age: 9 * time.Second, freshness: Fresh, onError: true},
+		{age: 10 * time.Second, freshness: Stale, onError: true},
+		{age: 14 * time.Second, freshness: Stale, onError: true},
+		{age: 15 * time.Second, freshness: Expired, onError: true},
+		{age: 29 * time.Second, freshness: Expired, onError: true},
+		{age: 30 * time.Second, freshness: Miss},
+	} {
+		t.Run(fmt.Sprintf("age=%s/freshness=%d", tCase.age, tCase.freshness), func(t *testing.T) {
+			err := c.storage.Set("key", &Entry{StatusCode: 200, StoredAt: now.Add(-tCase.age)})
+			assert.NoError(t, err)
+
+			e, f := c.Lookup("key")
+			assert.Equal(t, tCase.freshness, f)
+			if tCase.freshness == Miss {
+				assert.Nil(t, e)
+				_, err := c.storage.Get("key")
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			assert.Equal(t, tCase.onError, c.ServableOnError(e))
+		})
+	}
+}
+
+// TestRevalidation tests that only one revalidation per key is in flight
+func TestRevalidation(t *testing.T) {
+	c := New(NewMemoryStorage(), time.Second, time.Second, time.Second)
+
+	assert.True(t, c.BeginRevalidation("key"))
+	assert.False(t, c.BeginRevalidation("key"))
+	assert.True(t, c.BeginRevalidation("other"))
+	c.EndRevalidation("key")
+	assert.True(t, c.BeginRevalidation("key"))
+}
+
+// TestSweep tests that entries too old to be served are deleted from storage once they are
+// no longer looked up
+func TestSweep(t *testing.T) {
+	fs, err := NewFileStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	for name, s := range map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"file":   fs,
+	} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			c := New(s, 10*time.Second, 5*time.Second, 20*time.Second)
+			c.now = func() time.Time { return now }
+			assert.NoError(t, c.Store("old", &Entry{StatusCode: 200}))
+
+			// past the stale-if-error window
+			now = now.Add(time.Minute)
+			assert.NoError(t, c.Store("new", &Entry{StatusCode: 200}))
+			_, err := s.Get("old")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Get("new")
+			assert.NoError(t, err)
+
+			// swept at most once per interval
+			now = now.Add(30 * time.Second)
+			assert.NoError(t, c.Store("other", &Entry{StatusCode: 200}))
+			_, err = s.Get("new")
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is an in-process Storage. Its entries do not survive restarts.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	entries map[string]*Entry
+}
+
+// NewMemoryStorage constructor creates a new MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{entries: map[string]*Entry{}}
+}
+
+// Get returns the entry stored for key or ErrNotFound.
+func (m *MemoryStorage) Get(key string) (*Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// Set stores the entry under key.
+func (m *MemoryStorage) Set(key string, e *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = e
+	return nil
+}
+
+// Delete removes the entry stored under key, if any.
+func (m *MemoryStorage) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Sweep deletes the entries stored before the given time.
+func (m *MemoryStorage) Sweep(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, e := range m.entries {
+		if e.StoredAt.Before(before) {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
+
+// FileStorage is a Storage that keeps one JSON file per entry within a directory,
+// so that cached responses survive restarts. File names are derived from a
+// SHA-256 hash of the key.
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage constructor creates a new FileStorage, creating the directory if needed.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Get reads the entry stored for key or returns ErrNotFound.
+func (f *FileStorage) Get(key string) (*Entry, error) {
+	buf, err := ioutil.ReadFile(f.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Set writes the entry under key. The entry is written to a temporary file first
+// and then renamed, so that readers never observe a partially written entry.
+func (f *FileStorage) Set(key string, e *Entry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(f.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// Delete removes the entry stored under key, if any.
+func (f *FileStorage) Delete(key string) error {
+	err := os.Remove(f.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Sweep deletes the entries stored before the given time. Files that cannot be read as an entry
+// are left in place.
+func (f *FileStorage) Sweep(before time.Time) error {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		name := filepath.Join(f.dir, fi.Name())
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var e struct {
+			StoredAt time.Time `json:"stored_at"`
+		}
+		if json.Unmarshal(buf, &e) != nil || !e.StoredAt.Before(before) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// path returns the file path for the given key.
+func (f *FileStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,98 @@
+package filter
+
+// node defines a state of the Aho-Corasick automaton.
+type node struct {
+	next map[byte]int32
+	fail int32
+	out  []int // indices of the patterns ending in this state, including through fail links
+}
+
+// matcher is an Aho-Corasick automaton, it finds every occurrence of any number of
+// patterns in a single pass over the text.
+type matcher struct {
+	nodes   []node
+	lengths []int
+	root    [256]int32 // dense transitions of the root state, where most of the text is scanned
+}
+
+// occurrence defines a pattern found within a text, at text[start:end].
+type occurrence struct {
+	pattern int
+	start   int
+	end     int
+}
+
+// newMatcher builds the automaton for the given patterns.
+func newMatcher(patterns []string) *matcher {
+	m := &matcher{nodes: []node{{next: map[byte]int32{}}}}
+
+	// trie of the patterns
+	for i, p := range patterns {
+		m.lengths = append(m.lengths, len(p))
+		var cur int32
+		for j := 0; j < len(p); j++ {
+			nxt, ok := m.nodes[cur].next[p[j]]
+			if !ok {
+				nxt = int32(len(m.nodes))
+				m.nodes = append(m.nodes, node{next: map[byte]int32{}})
+				m.nodes[cur].next[p[j]] = nxt
+			}
+			cur = nxt
+		}
+		m.nodes[cur].out = append(m.nodes[cur].out, i)
+	}
+
+	for b, child := range m.nodes[0].next {
+		m.root[b] = child
+	}
+
+	// fail links, breadth first so that shorter suffixes are linked before longer ones
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for b, child := range m.nodes[cur].next {
+			queue = append(queue, child)
+			f := m.nodes[cur].fail
+			for {
+				if nxt, ok := m.nodes[f].next[b]; ok && nxt != child {
+					m.nodes[child].fail = nxt
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			m.nodes[child].out = append(m.nodes[child].out, m.nodes[m.nodes[child].fail].out...)
+		}
+	}
+	return m
+}
+
+// find calls fn for every occurrence of a pattern within the text, in order of their end.
+// It stops as soon as fn returns false.
+func (m *matcher) find(text string, fn func(o occurrence) bool) {
+	var cur int32
+	for i := 0; i < len(text); i++ {
+		for {
+			if cur == 0 {
+				cur = m.root[text[i]]
+				break
+			}
+			if nxt, ok := m.nodes[cur].next[text[i]]; ok {
+				cur = nxt
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		for _, p := range m.nodes[cur].out {
+			if !fn(occurrence{pattern: p, start: i + 1 - m.lengths[p], end: i + 1}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+)
+
+// Actions, these determine what happens to requests matching a rule.
+const (
+	ActionReject = "reject" // reject the request
+	ActionLog    = "log"    // log the match and let the request through
+	ActionMask   = "mask"   // replace the matched text with the replacement of the rule
+	ActionDrop   = "drop"   // remove the JSON fields holding the matched text
+	ActionTag    = "tag"    // add a header naming the rule to the request and let it through
+)
+
+const (
+	// DefaultReplacement replaces the text matched by rules with the `mask` action that do not set one.
+	DefaultReplacement = "***"
+	// DefaultTagHeader is added to requests matched by rules with the `tag` action that do not set one.
+	DefaultTagHeader = "X-Proxy-Filter-Match"
+)
+
+// Rule defines a word or phrase, or a regular expression, that requests are checked for.
+type Rule struct {
+	Name        string   `json:"name"`        // name of the rule reported to clients and in logs, required for patterns
+	Phrase      string   `json:"phrase"`      // word or phrase to look for
+	Pattern     string   `json:"pattern"`     // regular expression (RE2 syntax) to look for, in place of a phrase
+	Exact       bool     `json:"exact"`       // whether the phrase must be delimited by spaces or quotes, otherwise it matches if 'contains'
+	Insensitive bool     `json:"insensitive"` // whether the match is case insensitive
+	Action      string   `json:"action"`      // what happens to matching requests: 'reject', 'log', 'mask', 'drop' or 'tag', defaults to 'reject'
+	Replacement string   `json:"replacement"` // text replacing the matched text of the 'mask' action, defaults to `***`
+	Header      string   `json:"header"`      // header added to requests by the 'tag' action, defaults to `X-Proxy-Filter-Match`
+	Status      int      `json:"status"`      // status requests rejected by the rule are answered with, defaults to that of rejected content
+	DryRun      bool     `json:"dry_run"`     // whether the action is only logged, and never rewrites the body, so that the rule can be measured before it is enforced
+	Scope       string   `json:"scope"`       // what the rule is checked against: 'raw' body or JSON 'values', defaults to 'raw' unless fields or types are set
+	Fields      []string `json:"fields"`      // JSON body paths (e.g., `$.comment`, `$.items[*].note`) whose values the rule is checked against, every value when empty
+	Types       []string `json:"types"`       // JSON value types the rule is checked against: 'string', 'number' or 'boolean', defaults to 'string'
+	In          []string `json:"in"`          // parts of the request the rule is checked against: 'path', 'query', 'headers' or 'body', defaults to 'body'
+	Headers     []string `json:"headers"`     // names of the headers the rule is checked against when `in` holds 'headers', every header when empty
+}
+
+// Label returns the name of the rule, or its phrase when it has none.
+func (r Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Phrase
+}
+
+// Filter checks text against a set of rules. Every phrase is checked in a single pass over
+// the text, however many there are, while each pattern is checked in a pass of its own.
+type Filter struct {
+	rules       []Rule
+	sensitive   *matcher
+	insensitive *matcher
+	// indices of the rules matched by each pattern of the automata
+	sensitiveRules   []int
+	insensitiveRules []int
+	// compiled patterns, along with the indices of their rules
+	patterns     []*regexp.Regexp
+	patternRules []int
+	// rules checked against the values of the JSON body
+	jsonRules      []*jsonRule
+	needsAllLeaves bool
+	normalizer     textnorm.Normalizer
+	// parts of requests checked by at least one rule
+	parts map[string]bool
+	// rules with the `mask` or `drop` action, applied by Rewrite
+	rewriters []*rewriter
+}
+
+// New constructor creates a new Filter checking the given rules. Both the phrases of the rules
+// and the text they are checked against are normalized by n.
+func New(rules []Rule, n textnorm.Normalizer) (*Filter, error) {
+	f := &Filter{rules: make([]Rule, len(rules)), normalizer: n, parts: map[string]bool{}}
+	var sensitive, insensitive []string
+	for i, r := range rules {
+		switch {
+		case r.Phrase == "" && r.Pattern == "":
+			return nil, fmt.Errorf("rule %d: either a phrase or a pattern is required", i)
+		case r.Phrase != "" && r.Pattern != "":
+			return nil, fmt.Errorf("rule %d: a phrase and a pattern are mutually exclusive", i)
+		case r.Pattern != "" && r.Name == "":
+			return nil, fmt.Errorf("rule %d: a name is required for patterns", i)
+		}
+		switch r.Action {
+		case "":
+			r.Action = ActionReject
+		case ActionReject, ActionLog, ActionMask, ActionDrop, ActionTag:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid action %q must be one of 'reject', 'log', 'mask', 'drop' or 'tag'", i, r.Action)
+		}
+		if r.Action == ActionMask && r.Replacement == "" {
+			r.Replacement = DefaultReplacement
+		}
+		if r.Action == ActionTag && r.Header == "" {
+			r.Header = DefaultTagHeader
+		}
+		if r.Status != 0 && (r.Status < 400 || r.Status > 599) {
+			return nil, fmt.Errorf("rule %d: invalid status %d must be between 400 and 599", i, r.Status)
+		}
+		switch r.Scope {
+		case "", ScopeRaw, ScopeValues:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid scope %q must be one of 'raw' or 'values'", i, r.Scope)
+		}
+		if r.Scope == ScopeRaw && (len(r.Fields) > 0 || len(r.Types) > 0) {
+			return nil, fmt.Errorf("rule %d: fields and types only apply to the 'values' scope", i)
+		}
+		if len(r.In) == 0 {
+			r.In = []string{PartBody}
+		}
+		if err := r.validateParts(); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err.Error())
+		}
+		for _, part := range r.In {
+			f.parts[part] = true
+		}
+		f.rules[i] = r
+
+		var re *regexp.Regexp
+		if r.Pattern != "" {
+			expr := r.Pattern
+			if r.Insensitive {
+				expr = "(?i)" + expr
+			}
+			var err error
+			if re, err = regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("rule %d (%s): invalid pattern: %s", i, r.Name, err.Error())
+			}
+		}
+
+		if (r.Action == ActionMask || r.Action == ActionDrop) && !r.DryRun {
+			rw, err := newRewriter(i, r, re, n)
+			if err != nil {
+				return nil, err
+			}
+			f.rewriters = append(f.rewriters, rw)
+		}
+
+		if r.isJSON() {
+			jr, err := newJSONRule(i, r, re, n)
+			if err != nil {
+				return nil, err
+			}
+			f.jsonRules = append(f.jsonRules, jr)
+			f.needsAllLeaves = f.needsAllLeaves || len(jr.fields) == 0
+			continue
+		}
+
+		if re != nil {
+			f.patterns = append(f.patterns, re)
+			f.patternRules = append(f.patternRules, i)
+			continue
+		}
+
+		if r.Insensitive {
+			insensitive = append(insensitive, strings.ToLower(n.String(r.Phrase)))
+			f.insensitiveRules = append(f.insensitiveRules, i)
+		} else {
+			sensitive = append(sensitive, n.String(r.Phrase))
+			f.sensitiveRules = append(f.sensitiveRules, i)
+		}
+	}
+	f.sensitive = newMatcher(sensitive)
+	f.insensitive = newMatcher(insensitive)
+	return f, nil
+}
+
+// LoadRules reads rules from a JSON file holding an array of rules.
+func LoadRules(path string) ([]Rule, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(buf, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Load creates a new Filter checking the rules of a JSON file.
+func Load(path string, n textnorm.Normalizer) (*Filter, error) {
+	rules, err := LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(rules, n)
+}
+
+// Len returns the number of rules checked by the filter.
+func (f *Filter) Len() int {
+	return len(f.rules)
+}
+
+// Match returns the rules checked against the body that are matched by the text of a body,
+// in the order they were given.
+func (f *Filter) Match(text string) []Rule {
+	var rules []Rule
+	for i, ok := range f.matchText(PartBody, text) {
+		if ok && f.rules[i].inspects(PartBody, "") {
+			rules = append(rules, f.rules[i])
+		}
+	}
+	return rules
+}
+
+// matchText marks the rules matched by the text of the given part of a request, whether or not
+// they are checked against that part.
+func (f *Filter) matchText(part string, text string) []bool {
+	matched := make([]bool, len(f.rules))
+	raw := f.normalizer.String(text)
+	edges := part != PartBody
+	f.match(raw, f.sensitive, f.sensitiveRules, matched, edges)
+	if len(f.insensitiveRules) > 0 {
+		f.match(strings.ToLower(raw), f.insensitive, f.insensitiveRules, matched, edges)
+	}
+	for j, re := range f.patterns {
+		if re.MatchString(raw) {
+			matched[f.patternRules[j]] = true
+		}
+	}
+	if part == PartBody && len(f.jsonRules) > 0 {
+		f.matchJSON(text, matched)
+	}
+	return matched
+}
+
+// match marks the rules matched by the occurrences of the patterns of m within the text.
+// When edges is set, the start and end of the text delimit exact matches too.
+func (f *Filter) match(text string, m *matcher, rules []int, matched []bool, edges bool) {
+	m.find(text, func(o occurrence) bool {
+		i := rules[o.pattern]
+		if f.rules[i].Exact && !(delimited(text, o.start-1, edges) && delimited(text, o.end, edges)) {
+			return true
+		}
+		matched[i] = true
+		return true
+	})
+}
+
+// delimited reports whether the byte at i delimits an exact match, that is whether it is a space
+// or a quote. Outside of the body, slashes and, when edges is set, the edges of the text do too.
+func delimited(text string, i int, edges bool) bool {
+	if i < 0 || i >= len(text) {
+		return edges
+	}
+	return text[i] == ' ' || text[i] == '"' || (edges && text[i] == '/')
+}
@@ -0,0 +1,224 @@
+package filter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// phrases returns the phrases of the rules.
+func phrases(rules []Rule) []string {
+	var p []string
+	for _, r := range rules {
+		p = append(p, r.Phrase)
+	}
+	return p
+}
+
+// labels returns the labels of the rules.
+func labels(rules []Rule) []string {
+	var l []string
+	for _, r := range rules {
+		l = append(l, r.Label())
+	}
+	return l
+}
+
+// TestMatcher tests the find method on matcher
+func TestMatcher(t *testing.T) {
+	m := newMatcher([]string{"he", "she", "his", "hers"})
+
+	var found []string
+	m.find("ushers", func(o occurrence) bool {
+		found = append(found, fmt.Sprintf("%d:%d-%d", o.pattern, o.start, o.end))
+		return true
+	})
+	assert.Equal(t, []string{"1:1-4", "0:2-4", "3:2-6"}, found)
+
+	// an automaton without patterns matches nothing
+	newMatcher(nil).find("text", func(o occurrence) bool {
+		t.Fail()
+		return true
+	})
+}
+
+// TestFilter tests the Match method on Filter
+func TestFilter(t *testing.T) {
+
+	type unitTestCase struct {
+		body    string
+		rule    Rule
+		matched bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		// exact
+		{body: `{"body": "bad_message"}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: true},
+		{body: `{"body": " bad_message"}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: true},
+		{body: `{"body": "bad_message "}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: true},
+		{body: `{"body": " bad_message "}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: true},
+		{body: `{"body": "bad_messages"}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: false},
+		{body: `{"body": "0bad_messages"}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: false},
+		// contains
+		{body: `{"body": "bad_message"}`, rule: Rule{Phrase: "bad_message"}, matched: true},
+		{body: `{"body": "bad_messages"}`, rule: Rule{Phrase: "bad_message"}, matched: true},
+		{body: `{"body": "0bad_messages"}`, rule: Rule{Phrase: "bad_message"}, matched: true},
+		// case-sensitive
+		{body: `{"body": "BAD_MESSAGE"}`, rule: Rule{Phrase: "bad_message", Exact: true}, matched: false},
+		// case-insensitive
+		{body: `{"body": "BAD_MESSAGE"}`, rule: Rule{Phrase: "bad_message", Exact: true, Insensitive: true}, matched: true},
+		{body: `{"body": "bad_message"}`, rule: Rule{Phrase: "BAD_MESSAGE", Insensitive: true}, matched: true},
+	} {
+		t.Run(fmt.Sprintf("body=%s/phrase=%s/exact=%t/insensitive=%t/matched=%t", tCase.body, tCase.rule.Phrase, tCase.rule.Exact, tCase.rule.Insensitive, tCase.matched),
+			func(t *testing.T) {
+				f, err := New([]Rule{tCase.rule}, textnorm.Normalizer{})
+				assert.NoError(t, err)
+
+				rules := f.Match(tCase.body)
+				if tCase.matched {
+					assert.Len(t, rules, 1)
+					assert.Equal(t, ActionReject, rules[0].Action)
+				} else {
+					assert.Empty(t, rules)
+				}
+			})
+	}
+
+	t.Run("many rules", func(t *testing.T) {
+		f, err := New([]Rule{
+			{Phrase: "alpha"},
+			{Phrase: "beta", Exact: true},
+			{Phrase: "GAMMA", Insensitive: true, Action: ActionLog},
+			{Phrase: "delta"},
+			{Phrase: "alphabet"},
+		}, textnorm.Normalizer{})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, f.Len())
+
+		assert.Equal(t, []string{"alpha", "beta", "GAMMA", "alphabet"}, phrases(f.Match(`{"a": "alphabet", "b": "beta", "c": "gamma gamma"}`)))
+		assert.Equal(t, []string{"alpha", "alphabet"}, phrases(f.Match(`{"a": "alphabetagamm"}`)))
+		assert.Empty(t, f.Match(`{"a": "alph", "b": "Delta"}`))
+	})
+
+	t.Run("patterns", func(t *testing.T) {
+		f, err := New([]Rule{
+			{Name: "ssn", Pattern: `\b\d{3}-\d{2}-\d{4}\b`},
+			{Name: "sql", Pattern: `drop\s+table`, Insensitive: true},
+			{Phrase: "alpha"},
+		}, textnorm.Normalizer{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"ssn"}, labels(f.Match(`{"ssn": "123-45-6789"}`)))
+		assert.Empty(t, f.Match(`{"ssn": "1123-45-67890"}`))
+		assert.Equal(t, []string{"sql", "alpha"}, labels(f.Match(`{"q": "DROP  Table alpha"}`)))
+	})
+
+	t.Run("normalized", func(t *testing.T) {
+		n, err := textnorm.New("all")
+		assert.NoError(t, err)
+		f, err := New([]Rule{
+			{Phrase: "bad_message", Exact: true},
+			{Phrase: "Drop Table", Scope: ScopeValues, Exact: true},
+		}, n)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"bad_message"}, phrases(f.Match("{\"a\": \"\uff42\u0430d_m\u200bessage\"}")))
+		assert.Equal(t, []string{"Drop Table"}, phrases(f.Match(`{"q": "DR\u00d3P t\u0430ble"}`)))
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		for _, rules := range [][]Rule{
+			{{Phrase: ""}},
+			{{Phrase: "a", Action: "quarantine"}},
+			{{Phrase: "a", Status: 302}},
+			{{Phrase: "a", Pattern: "a", Name: "a"}},
+			{{Pattern: "a"}},
+			{{Name: "unbalanced", Pattern: "(a"}},
+		} {
+			_, err := New(rules, textnorm.Normalizer{})
+			assert.Error(t, err)
+		}
+	})
+}
+
+// TestLoad tests the Load function
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "rules.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"phrase": "bad", "exact": true}, {"phrase": "worse", "action": "log"}]`), 0644))
+	f, err := Load(path, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.Len())
+
+	_, err = Load(filepath.Join(dir, "missing.json"), textnorm.Normalizer{})
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"phrase": "bad"}`), 0644))
+	_, err = Load(path, textnorm.Normalizer{})
+	assert.Error(t, err)
+}
+
+// benchmarkTerms returns n random terms and a body of about 4KB containing none of them.
+func benchmarkTerms(n int) ([]string, string) {
+	rnd := rand.New(rand.NewSource(1))
+	word := func(l int) string {
+		b := make([]byte, l)
+		for i := range b {
+			b[i] = byte('a' + rnd.Intn(26))
+		}
+		return string(b)
+	}
+
+	terms := make([]string, n)
+	for i := range terms {
+		terms[i] = "term" + word(8)
+	}
+	var body strings.Builder
+	for body.Len() < 4096 {
+		body.WriteString(`"` + word(6) + `": "` + word(24) + `", `)
+	}
+	return terms, "{" + body.String() + "}"
+}
+
+// BenchmarkFilter benchmarks the Match method on Filter
+func BenchmarkFilter(b *testing.B) {
+	for _, n := range []int{1, 100, 1000, 10000} {
+		terms, body := benchmarkTerms(n)
+		rules := make([]Rule, n)
+		for i, t := range terms {
+			rules[i] = Rule{Phrase: t}
+		}
+		f, _ := New(rules, textnorm.Normalizer{})
+
+		b.Run(fmt.Sprintf("terms=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f.Match(body)
+			}
+		})
+	}
+}
+
+// BenchmarkContains benchmarks checking every term with `strings.Contains`, as a single
+// `REJECT_WITH` phrase is checked, for comparison with BenchmarkFilter.
+func BenchmarkContains(b *testing.B) {
+	for _, n := range []int{1, 100, 1000, 10000} {
+		terms, body := benchmarkTerms(n)
+
+		b.Run(fmt.Sprintf("terms=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, t := range terms {
+					if strings.Contains(body, t) {
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonpath"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Scopes, these determine what part of the request body a rule is checked against.
+const (
+	ScopeRaw    = "raw"    // the raw body, including keys, escapes and whitespace
+	ScopeValues = "values" // the unescaped, normalized values of the JSON body
+)
+
+// JSON value types a rule scoped to values may apply to.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// jsonRule defines a rule checked against the values of the JSON body.
+type jsonRule struct {
+	index      int
+	fields     []jsonpath.Path
+	types      map[string]bool
+	phrase     string
+	pattern    *regexp.Regexp
+	normalizer textnorm.Normalizer
+}
+
+// leaf defines a value of a JSON document along with its type.
+type leaf struct {
+	value string
+	typ   string
+}
+
+// newJSONRule compiles the rule at index i, whose pattern, if any, is already compiled.
+func newJSONRule(i int, r Rule, re *regexp.Regexp, n textnorm.Normalizer) (*jsonRule, error) {
+	jr := &jsonRule{index: i, types: map[string]bool{}, pattern: re, normalizer: n}
+	for _, expr := range r.Fields {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err.Error())
+		}
+		jr.fields = append(jr.fields, p)
+	}
+
+	types := r.Types
+	if len(types) == 0 {
+		types = []string{TypeString}
+	}
+	for _, t := range types {
+		switch t {
+		case TypeString, TypeNumber, TypeBoolean:
+			jr.types[t] = true
+		default:
+			return nil, fmt.Errorf("rule %d: invalid type %q must be one of 'string', 'number' or 'boolean'", i, t)
+		}
+	}
+
+	jr.phrase = jr.normalize(r.Phrase, r.Insensitive)
+	return jr, nil
+}
+
+// matchJSON marks the rules scoped to values that are matched by the JSON text. Text that is
+// not valid JSON is checked as a single string value, so that it cannot bypass the rules.
+func (f *Filter) matchJSON(text string, matched []bool) {
+	var doc interface{}
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil || d.More() {
+		doc = text
+	}
+
+	// the leaves of the whole document are shared by every rule without fields
+	var all []leaf
+	if f.needsAllLeaves {
+		all = leaves(doc, nil)
+	}
+
+	for _, jr := range f.jsonRules {
+		if matched[jr.index] {
+			continue
+		}
+		candidates := all
+		if len(jr.fields) > 0 {
+			candidates = nil
+			for _, p := range jr.fields {
+				for _, v := range p.Select(doc) {
+					candidates = leaves(v, candidates)
+				}
+			}
+		}
+		r := f.rules[jr.index]
+		for _, l := range candidates {
+			if jr.types[l.typ] && jr.match(l.value, r) {
+				matched[jr.index] = true
+				break
+			}
+		}
+	}
+}
+
+// match reports whether the value matches the rule.
+func (jr *jsonRule) match(value string, r Rule) bool {
+	value = jr.normalize(value, r.Insensitive)
+	if jr.pattern != nil {
+		return jr.pattern.MatchString(value)
+	}
+	if !r.Exact {
+		return strings.Contains(value, jr.phrase)
+	}
+
+	// every occurrence is checked, since the first one may be part of a longer word
+	for start := 0; start <= len(value); {
+		i := strings.Index(value[start:], jr.phrase)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(jr.phrase)
+		if wordBoundary(value, i, true) && wordBoundary(value, end, false) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(value[i:])
+		start = i + size
+	}
+	return false
+}
+
+// leaves appends the scalar values within v to l, without the keys of objects.
+func leaves(v interface{}, l []leaf) []leaf {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(c) {
+			l = leaves(c[k], l)
+		}
+	case []interface{}:
+		for _, e := range c {
+			l = leaves(e, l)
+		}
+	case string:
+		l = append(l, leaf{value: c, typ: TypeString})
+	case json.Number:
+		l = append(l, leaf{value: c.String(), typ: TypeNumber})
+	case bool:
+		l = append(l, leaf{value: fmt.Sprint(c), typ: TypeBoolean})
+	}
+	return l
+}
+
+// sortedKeys returns the keys of the object in order, so that values are always checked in the same order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalize returns the Unicode normalized form of s, further normalized by the normalizer of the
+// filter and lower cased when the match is case insensitive.
+func (jr *jsonRule) normalize(s string, insensitive bool) string {
+	s = jr.normalizer.String(norm.NFC.String(s))
+	if insensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// wordBoundary reports whether the position i of s is a word boundary, looking at the rune
+// before it when before is set and at the rune after it otherwise.
+func wordBoundary(s string, i int, before bool) bool {
+	var r rune
+	if before {
+		if i == 0 {
+			return true
+		}
+		r, _ = utf8.DecodeLastRuneInString(s[:i])
+	} else {
+		if i == len(s) {
+			return true
+		}
+		r, _ = utf8.DecodeRuneInString(s[i:])
+	}
+	return !(unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_')
+}
+
+// isJSON reports whether the rule is checked against the values of the JSON body.
+func (r Rule) isJSON() bool {
+	return r.Scope == ScopeValues || len(r.Fields) > 0 || len(r.Types) > 0
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJSONRules tests the Match method on Filter with rules scoped to the values of the JSON body
+func TestJSONRules(t *testing.T) {
+
+	type unitTestCase struct {
+		name    string
+		body    string
+		rule    Rule
+		matched bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		// escaped values are unescaped before they are checked
+		{name: "escaped", body: `{"body": "\u0062ad_message"}`, rule: Rule{Phrase: "bad_message", Scope: ScopeValues}, matched: true},
+		{name: "escaped raw", body: `{"body": "\u0062ad_message"}`, rule: Rule{Phrase: "bad_message"}, matched: false},
+		// keys are never checked
+		{name: "key", body: `{"bad_message": "ok"}`, rule: Rule{Phrase: "bad_message", Scope: ScopeValues}, matched: false},
+		// word boundaries
+		{name: "exact", body: `{"body": "a bad_message."}`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: true},
+		{name: "exact punctuation", body: `{"body": "(bad_message)"}`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: true},
+		{name: "exact longer word", body: `{"body": "bad_messages"}`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: false},
+		{name: "exact underscore", body: `{"body": "x_bad_message"}`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: false},
+		{name: "exact later occurrence", body: `{"body": "bad_messages, bad_message"}`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: true},
+		{name: "exact unicode letter", body: `{"body": "ébad"}`, rule: Rule{Phrase: "bad", Exact: true, Scope: ScopeValues}, matched: false},
+		// normalization
+		{name: "decomposed", body: `{"body": "cafe\u0301"}`, rule: Rule{Phrase: "café", Exact: true, Scope: ScopeValues}, matched: true},
+		{name: "insensitive", body: `{"body": "BAD_MESSAGE"}`, rule: Rule{Phrase: "bad_message", Insensitive: true, Scope: ScopeValues}, matched: true},
+		// fields
+		{name: "field", body: `{"comment": "bad", "title": "ok"}`, rule: Rule{Phrase: "bad", Fields: []string{"$.comment"}}, matched: true},
+		{name: "other field", body: `{"comment": "ok", "title": "bad"}`, rule: Rule{Phrase: "bad", Fields: []string{"$.comment"}}, matched: false},
+		{name: "nested field", body: `{"items": [{"note": "ok"}, {"note": {"text": "bad"}}]}`, rule: Rule{Phrase: "bad", Fields: []string{"$.items[*].note"}}, matched: true},
+		// types
+		{name: "number not checked", body: `{"id": 1234}`, rule: Rule{Phrase: "1234", Scope: ScopeValues}, matched: false},
+		{name: "number", body: `{"id": 1234}`, rule: Rule{Phrase: "1234", Types: []string{TypeNumber}}, matched: true},
+		{name: "boolean", body: `{"admin": true}`, rule: Rule{Phrase: "true", Exact: true, Fields: []string{"admin"}, Types: []string{TypeBoolean}}, matched: true},
+		// patterns
+		{name: "pattern", body: `{"a": "x", "b": "123-45-6789"}`, rule: Rule{Name: "ssn", Pattern: `^\d{3}-\d{2}-\d{4}$`, Scope: ScopeValues}, matched: true},
+		// bodies that are not JSON are checked as a single value
+		{name: "not json", body: `bad_message`, rule: Rule{Phrase: "bad_message", Exact: true, Scope: ScopeValues}, matched: true},
+	} {
+		t.Run(fmt.Sprintf("name=%s/matched=%t", tCase.name, tCase.matched), func(t *testing.T) {
+			f, err := New([]Rule{tCase.rule}, textnorm.Normalizer{})
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.matched, len(f.Match(tCase.body)) == 1)
+		})
+	}
+
+	t.Run("invalid rules", func(t *testing.T) {
+		for _, rules := range [][]Rule{
+			{{Phrase: "a", Scope: "keys"}},
+			{{Phrase: "a", Scope: ScopeRaw, Fields: []string{"$.a"}}},
+			{{Phrase: "a", Fields: []string{"$a"}}},
+			{{Phrase: "a", Types: []string{"null"}}},
+		} {
+			_, err := New(rules, textnorm.Normalizer{})
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Parts, these determine what parts of requests a rule is checked against.
+const (
+	PartPath    = "path"    // the decoded path of the request
+	PartQuery   = "query"   // the decoded values of the query parameters, each on its own
+	PartHeaders = "headers" // the values of the headers named by the rule, or of every header, each on its own
+	PartBody    = "body"    // the request body, according to the scope of the rule
+)
+
+// Match defines a rule matched by a request, along with where it was matched.
+type Match struct {
+	Rule Rule
+	Part string // part of the request the rule was matched in
+	Name string // name of the query parameter or header the rule was matched in, if any
+}
+
+// Where describes where the rule was matched (e.g., "query parameter `q`").
+func (m Match) Where() string {
+	switch m.Part {
+	case PartPath:
+		return "request path"
+	case PartQuery:
+		return "query parameter `" + m.Name + "`"
+	case PartHeaders:
+		return "header `" + m.Name + "`"
+	}
+	return "request body"
+}
+
+// MatchRequest returns the rules matched by the request, whose body is given as text, in the
+// order they were given. The path, the query values, the headers and then the body are checked,
+// and each rule is reported once, where it was first matched.
+func (f *Filter) MatchRequest(r *http.Request, body string) []Match {
+	found := make([]*Match, len(f.rules))
+	check := func(part string, name string, text string) {
+		if text == "" {
+			return
+		}
+		for i, ok := range f.matchText(part, text) {
+			if ok && found[i] == nil && f.rules[i].inspects(part, name) {
+				found[i] = &Match{Rule: f.rules[i], Part: part, Name: name}
+			}
+		}
+	}
+
+	if f.parts[PartPath] {
+		check(PartPath, "", r.URL.Path)
+	}
+	if f.parts[PartQuery] {
+		query := r.URL.Query()
+		for _, k := range sortedNames(query) {
+			for _, v := range query[k] {
+				check(PartQuery, k, v)
+			}
+		}
+	}
+	if f.parts[PartHeaders] {
+		for _, k := range sortedNames(r.Header) {
+			for _, v := range r.Header[k] {
+				check(PartHeaders, k, v)
+			}
+		}
+	}
+	if f.parts[PartBody] {
+		check(PartBody, "", body)
+	}
+
+	var matches []Match
+	for _, m := range found {
+		if m != nil {
+			matches = append(matches, *m)
+		}
+	}
+	return matches
+}
+
+// inspects reports whether the rule is checked against the given part of requests, and for
+// headers, against the header of the given name.
+func (r Rule) inspects(part string, name string) bool {
+	for _, p := range r.In {
+		if p != part {
+			continue
+		}
+		if part != PartHeaders || len(r.Headers) == 0 {
+			return true
+		}
+		for _, h := range r.Headers {
+			if strings.EqualFold(h, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateParts validates the parts of requests the rule is checked against, since the scope of
+// rules and the actions rewriting requests only apply to the body.
+func (r Rule) validateParts() error {
+	outside := false
+	for _, part := range r.In {
+		switch part {
+		case PartPath, PartQuery, PartHeaders:
+			outside = true
+		case PartBody:
+		default:
+			return fmt.Errorf("invalid part %q must be one of 'path', 'query', 'headers' or 'body'", part)
+		}
+	}
+	if len(r.Headers) > 0 && !r.inspects(PartHeaders, r.Headers[0]) {
+		return errors.New("headers only apply to rules checked against 'headers'")
+	}
+	if outside && r.isJSON() {
+		return errors.New("the 'values' scope, fields and types only apply to the body")
+	}
+	if outside && (r.Action == ActionMask || r.Action == ActionDrop) {
+		return errors.New("the 'mask' and 'drop' actions only apply to the body")
+	}
+	return nil
+}
+
+// sortedNames returns the names of the query parameters or headers, sorted.
+func sortedNames(values map[string][]string) []string {
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,78 @@
+package filter
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// wheres returns the label of the rule of each match, followed by where it was matched.
+func wheres(matches []Match) []string {
+	var w []string
+	for _, m := range matches {
+		w = append(w, m.Rule.Label()+" in "+m.Where())
+	}
+	return w
+}
+
+// TestMatchRequest tests the MatchRequest method on Filter
+func TestMatchRequest(t *testing.T) {
+	f, err := New([]Rule{
+		{Phrase: "bad_message", Exact: true, In: []string{PartPath, PartQuery, PartHeaders, PartBody}},
+		{Name: "ssn", Pattern: `\d{3}-\d{2}-\d{4}`, In: []string{PartQuery}},
+		{Phrase: "evil", Insensitive: true, In: []string{PartHeaders}, Headers: []string{"x-note"}},
+		{Phrase: "body_only"},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		target  string
+		headers map[string]string
+		body    string
+		matched []string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{target: "/posts", body: `{"a": "fine"}`},
+		{target: "/posts/bad_message", matched: []string{"bad_message in request path"}},
+		{target: "/posts/bad_messages"},
+		{target: "/posts?q=bad%5Fmessage", matched: []string{"bad_message in query parameter `q`"}},
+		{target: "/posts?a=1&b=123-45-6789", matched: []string{"ssn in query parameter `b`"}},
+		{target: "/posts", headers: map[string]string{"X-Note": "very EVIL"}, matched: []string{"evil in header `X-Note`"}},
+		{target: "/posts", headers: map[string]string{"X-Other": "evil"}},
+		{target: "/posts", headers: map[string]string{"X-Other": "bad_message"}, matched: []string{"bad_message in header `X-Other`"}},
+		{target: "/posts", body: `{"ssn": "123-45-6789", "a": "body_only"}`, matched: []string{"body_only in request body"}},
+		{target: "/posts?body_only=1", headers: map[string]string{"X-Note": "body_only"}},
+		// rules are reported once, where they were first matched
+		{target: "/posts?q=bad_message", body: `{"a": "bad_message"}`, matched: []string{"bad_message in query parameter `q`"}},
+	} {
+		t.Run(fmt.Sprintf("target=%s/headers=%v/body=%s", tCase.target, tCase.headers, tCase.body),
+			func(t *testing.T) {
+				r := httptest.NewRequest("GET", tCase.target, strings.NewReader(tCase.body))
+				for k, v := range tCase.headers {
+					r.Header.Set(k, v)
+				}
+				assert.Equal(t, tCase.matched, wheres(f.MatchRequest(r, tCase.body)))
+			})
+	}
+
+	// rules checked against other parts only are not matched by the body
+	assert.Equal(t, []string{"bad_message", "body_only"}, labels(f.Match(`{"a": "bad_message body_only evil"}`)))
+
+	t.Run("invalid parts", func(t *testing.T) {
+		for _, rules := range [][]Rule{
+			{{Phrase: "a", In: []string{"cookies"}}},
+			{{Phrase: "a", Headers: []string{"X-Note"}}},
+			{{Phrase: "a", In: []string{PartQuery}, Scope: ScopeValues}},
+			{{Phrase: "a", In: []string{PartHeaders, PartBody}, Action: ActionMask}},
+			{{Phrase: "a", In: []string{PartPath}, Action: ActionDrop}},
+		} {
+			_, err := New(rules, textnorm.Normalizer{})
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+)
+
+// rewriter defines a rule with the `mask` or `drop` action applied to the values of a JSON body.
+type rewriter struct {
+	rule    Rule
+	json    *jsonRule      // reports whether a value matches the rule
+	literal *regexp.Regexp // locates the phrase, or pattern, within values as they are
+}
+
+// dropped marks the values removed by the `drop` action until they are pruned from the document.
+type dropped struct{}
+
+// newRewriter compiles the rule at index i, whose pattern, if any, is already compiled.
+func newRewriter(i int, r Rule, re *regexp.Regexp, n textnorm.Normalizer) (*rewriter, error) {
+	jr, err := newJSONRule(i, r, re, n)
+	if err != nil {
+		return nil, err
+	}
+	rw := &rewriter{rule: r, json: jr, literal: re}
+	if re == nil {
+		expr := regexp.QuoteMeta(r.Phrase)
+		if r.Insensitive {
+			expr = "(?i)" + expr
+		}
+		rw.literal = regexp.MustCompile(expr)
+	}
+	return rw, nil
+}
+
+// Rewrite applies the rules with the `mask` or `drop` action, unless they run in dry-run mode, to a
+// JSON body: the text matched by `mask` rules within values is replaced, and the fields or array
+// elements whose values match `drop` rules are removed. Values in which the matched text cannot be
+// located, because it only appears once they are normalized, are replaced as a whole. The body is
+// re-encoded, with its keys in order, only when it changed. Text that is not JSON is masked as a
+// single value, and an error is returned when a `drop` rule matches it.
+func (f *Filter) Rewrite(text string) (string, error) {
+	if len(f.rewriters) == 0 {
+		return text, nil
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil || d.More() {
+		for _, rw := range f.rewriters {
+			if rw.rule.Action == ActionDrop && rw.json.match(text, rw.rule) {
+				return "", fmt.Errorf("rule `%s` cannot drop fields of a body that is not JSON", rw.rule.Label())
+			}
+			text = rw.mask(text)
+		}
+		return text, nil
+	}
+
+	changed := false
+	for _, rw := range f.rewriters {
+		rw := rw
+		apply := func(v interface{}) interface{} {
+			return rw.apply(v, &changed)
+		}
+		if len(rw.json.fields) == 0 {
+			doc = apply(doc)
+			continue
+		}
+		for _, p := range rw.json.fields {
+			doc = p.Replace(doc, apply)
+		}
+	}
+	if !changed {
+		return text, nil
+	}
+
+	doc = prune(doc)
+	if _, ok := doc.(dropped); ok {
+		return "", errors.New("the whole body would be dropped")
+	}
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// apply applies the rule to the values within v, setting changed when one of them matches.
+func (rw *rewriter) apply(v interface{}, changed *bool) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for k, e := range c {
+			c[k] = rw.apply(e, changed)
+		}
+	case []interface{}:
+		for i, e := range c {
+			c[i] = rw.apply(e, changed)
+		}
+	default:
+		l := leaves(v, nil)
+		if len(l) == 0 || !rw.json.types[l[0].typ] || !rw.json.match(l[0].value, rw.rule) {
+			return v
+		}
+		*changed = true
+		if rw.rule.Action == ActionDrop {
+			return dropped{}
+		}
+		if s, ok := v.(string); ok {
+			return rw.mask(s)
+		}
+		return rw.rule.Replacement
+	}
+	return v
+}
+
+// mask replaces the text matched by the rule within s. s is replaced as a whole when the match
+// cannot be located, because it only appears once s is normalized.
+func (rw *rewriter) mask(s string) string {
+	if !rw.json.match(s, rw.rule) {
+		return s
+	}
+	masked := rw.literal.ReplaceAllLiteralString(s, rw.rule.Replacement)
+	if rw.json.match(masked, rw.rule) {
+		return rw.rule.Replacement
+	}
+	return masked
+}
+
+// prune removes the values marked as dropped from the objects and arrays holding them.
+func prune(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for k, e := range c {
+			if _, ok := e.(dropped); ok {
+				delete(c, k)
+				continue
+			}
+			c[k] = prune(e)
+		}
+	case []interface{}:
+		kept := c[:0]
+		for _, e := range c {
+			if _, ok := e.(dropped); !ok {
+				kept = append(kept, prune(e))
+			}
+		}
+		return kept
+	}
+	return v
+}
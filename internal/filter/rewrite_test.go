@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRewrite tests the Rewrite method on Filter
+func TestRewrite(t *testing.T) {
+	all, _ := textnorm.New("all")
+
+	type unitTestCase struct {
+		body       string
+		rule       Rule
+		normalizer textnorm.Normalizer
+		expected   string
+		err        bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		// mask
+		{body: `{"b": "a bad_message here", "a": 1}`, rule: Rule{Phrase: "bad_message", Action: ActionMask}, expected: `{"a":1,"b":"a *** here"}`},
+		{body: `{"b": "BAD_MESSAGE and bad_message"}`, rule: Rule{Phrase: "bad_message", Insensitive: true, Action: ActionMask, Replacement: "[filtered]"}, expected: `{"b":"[filtered] and [filtered]"}`},
+		{body: `{"b": ["ok", "call 555-1234"]}`, rule: Rule{Name: "phone", Pattern: `\d{3}-\d{4}`, Action: ActionMask}, expected: `{"b":["ok","call ***"]}`},
+		{body: `{"n": 42, "s": "42"}`, rule: Rule{Phrase: "42", Types: []string{TypeNumber}, Action: ActionMask}, expected: `{"n":"***","s":"42"}`},
+		{body: "{\"b\": \"b\u0430d_message\"}", rule: Rule{Phrase: "bad_message", Action: ActionMask}, normalizer: all, expected: `{"b":"***"}`},
+		{body: `{"b": "<bad_message>"}`, rule: Rule{Phrase: "bad_message", Action: ActionMask}, expected: `{"b":"<***>"}`},
+		{body: `plain bad_message text`, rule: Rule{Phrase: "bad_message", Action: ActionMask}, expected: `plain *** text`},
+		// drop
+		{body: `{"keep": "ok", "note": "bad_message", "nested": {"note": "a bad_message"}}`, rule: Rule{Phrase: "bad_message", Action: ActionDrop}, expected: `{"keep":"ok","nested":{}}`},
+		{body: `{"tags": ["ok", "bad_message", "fine"]}`, rule: Rule{Phrase: "bad_message", Action: ActionDrop}, expected: `{"tags":["ok","fine"]}`},
+		{body: `{"title": "bad_message", "note": "bad_message"}`, rule: Rule{Phrase: "bad_message", Action: ActionDrop, Fields: []string{"$.note"}}, expected: `{"title":"bad_message"}`},
+		{body: `"bad_message"`, rule: Rule{Phrase: "bad_message", Action: ActionDrop}, err: true},
+		{body: `not json bad_message`, rule: Rule{Phrase: "bad_message", Action: ActionDrop}, err: true},
+		// bodies that do not match are left as they are
+		{body: `{"b": "fine",  "a": 1}`, rule: Rule{Phrase: "bad_message", Action: ActionMask}, expected: `{"b": "fine",  "a": 1}`},
+		{body: `{"b": "bad_message"}`, rule: Rule{Phrase: "bad_message"}, expected: `{"b": "bad_message"}`},
+	} {
+		t.Run(fmt.Sprintf("body=%s/action=%s", tCase.body, tCase.rule.Action), func(t *testing.T) {
+			f, err := New([]Rule{tCase.rule}, tCase.normalizer)
+			assert.NoError(t, err)
+
+			body, err := f.Rewrite(tCase.body)
+			if tCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expected, body)
+		})
+	}
+}
+
+// TestActionDefaults tests the defaults New sets for the replacement and header of rules
+func TestActionDefaults(t *testing.T) {
+	f, err := New([]Rule{{Phrase: "a", Action: ActionMask}, {Phrase: "b", Action: ActionTag}}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+
+	rules := f.Match("a b")
+	assert.Len(t, rules, 2)
+	assert.Equal(t, DefaultReplacement, rules[0].Replacement)
+	assert.Equal(t, DefaultTagHeader, rules[1].Header)
+
+	_, err = New([]Rule{{Phrase: "a", Action: "rewrite"}}, textnorm.Normalizer{})
+	assert.Error(t, err)
+}
+
+// TestRewriteDryRun tests that Rewrite leaves the values matched by rules in dry-run mode as they are
+func TestRewriteDryRun(t *testing.T) {
+	f, err := New([]Rule{
+		{Phrase: "bad_message", Action: ActionMask},
+		{Phrase: "secret", Action: ActionDrop, DryRun: true},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+
+	body, err := f.Rewrite(`{"a": "bad_message", "b": "secret"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"***","b":"secret"}`, body)
+	assert.Len(t, f.Match(body), 1)
+}
@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"go.uber.org/zap"
+)
+
+// Watcher holds the Filter loaded from a rules file and reloads it whenever the file
+// changes, so that rules can be updated without a restart. A file that fails to load
+// is logged and the previous rules are kept.
+type Watcher struct {
+	path       string
+	target     string // path of the file the rules file resolves to, through symlinks
+	normalizer textnorm.Normalizer
+	filter     atomic.Value // *Filter
+	watcher    *fsnotify.Watcher
+	logger     *zap.Logger
+	done       chan struct{}
+}
+
+// Watch loads the rules file at path, normalized by n, and watches it for changes.
+func Watch(path string, n textnorm.Normalizer, logger *zap.Logger) (*Watcher, error) {
+	f, err := Load(path, n)
+	if err != nil {
+		return nil, err
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// the directory is watched, since editors and deployment tools often replace the file
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		path:       filepath.Clean(path),
+		target:     resolve(path),
+		normalizer: n,
+		watcher:    fw,
+		logger:     logger,
+		done:       make(chan struct{}),
+	}
+	w.filter.Store(f)
+	go w.run()
+	return w, nil
+}
+
+// Filter returns the current Filter.
+func (w *Watcher) Filter() *Filter {
+	return w.filter.Load().(*Filter)
+}
+
+// Close stops watching the rules file.
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+// run reloads the rules file on every change until the watcher is closed.
+func (w *Watcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubernetes mounts ConfigMaps as symlinks into a directory that is swapped
+			// (`..data`), so the file changes whenever its resolved path does
+			if target := resolve(w.path); target != w.target {
+				w.target = target
+				w.reload()
+				continue
+			}
+			if filepath.Clean(e.Name) != w.path || e.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			w.reload()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("rules file watcher failure", zap.String("path", w.path), zap.Error(err))
+		}
+	}
+}
+
+// resolve returns the path the file at path resolves to through symlinks, or an empty string
+// when it cannot be resolved, for instance while it is being replaced.
+func resolve(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// reload loads the rules file, keeping the current rules if it fails.
+func (w *Watcher) reload() {
+	f, err := Load(w.path, w.normalizer)
+	if err != nil {
+		w.logger.Error("failed to reload rules file, keeping previous rules", zap.String("path", w.path), zap.Error(err))
+		return
+	}
+	w.filter.Store(f)
+	w.logger.Info("reloaded rules file", zap.String("path", w.path), zap.Int("rules", f.Len()))
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestWatcher tests that a Watcher reloads its rules file when it changes
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"phrase": "bad"}]`), 0644))
+
+	w, err := Watch(path, textnorm.Normalizer{}, zap.NewNop())
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Len(t, w.Filter().Match("bad"), 1)
+
+	// written in place
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"phrase": "bad"}, {"phrase": "worse"}]`), 0644))
+	assert.Eventually(t, func() bool { return w.Filter().Len() == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	// an invalid file keeps the previous rules
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"phrase": ""}]`), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 2, w.Filter().Len())
+
+	// replaced by a rename
+	tmp := filepath.Join(dir, "rules.json.tmp")
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte(`[{"phrase": "worst"}]`), 0644))
+	assert.NoError(t, os.Rename(tmp, path))
+	assert.Eventually(t, func() bool { return len(w.Filter().Match("worst")) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	// a missing rules file cannot be watched
+	_, err = Watch(filepath.Join(dir, "missing.json"), textnorm.Normalizer{}, zap.NewNop())
+	assert.Error(t, err)
+}
+
+// TestWatcherSymlinks tests that the Watcher reloads a rules file mounted from a Kubernetes ConfigMap,
+// which is updated by swapping the `..data` symlink the file points through
+func TestWatcherSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	for i, rules := range []string{`[{"phrase": "bad"}]`, `[{"phrase": "worst"}]`} {
+		version := filepath.Join(dir, fmt.Sprintf("..v%d", i))
+		assert.NoError(t, os.Mkdir(version, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(version, "rules.json"), []byte(rules), 0644))
+	}
+	assert.NoError(t, os.Symlink("..v0", filepath.Join(dir, "..data")))
+	path := filepath.Join(dir, "rules.json")
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "rules.json"), path))
+
+	w, err := Watch(path, textnorm.Normalizer{}, zap.NewNop())
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Len(t, w.Filter().Match("bad"), 1)
+
+	assert.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.Eventually(t, func() bool { return len(w.Filter().Match("worst")) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, w.Filter().Match("bad"))
+}
@@ -0,0 +1,156 @@
+// Package jsonlimit checks that JSON documents stay within structural limits while they are
+// parsed, such as their nesting depth or the length of their arrays.
+package jsonlimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Names of the limits, reported by violations.
+const (
+	LimitDepth        = "max_depth"         // nesting depth of objects and arrays
+	LimitTokens       = "max_tokens"        // total number of tokens: delimiters, keys and values
+	LimitKeys         = "max_keys"          // number of keys of each object
+	LimitArrayLength  = "max_array_length"  // number of elements of each array
+	LimitStringLength = "max_string_length" // length in bytes of each string, keys included
+)
+
+// Limits defines the structural limits JSON documents must stay within. A limit of 0 is not enforced.
+type Limits struct {
+	MaxDepth        int // maximum nesting depth, a document whose top-level value is an object or array having a depth of 1
+	MaxTokens       int // maximum total number of tokens
+	MaxKeys         int // maximum number of keys of each object
+	MaxArrayLength  int // maximum number of elements of each array
+	MaxStringLength int // maximum length in bytes of each string, once unescaped
+}
+
+// Violation defines a limit a document exceeds.
+type Violation struct {
+	Limit string // name of the limit (e.g., `max_depth`)
+	Max   int    // value of the limit
+	Path  string // path of the offending value (e.g., `$.items[0]`)
+}
+
+// Error returns a description of the violation.
+func (v *Violation) Error() string {
+	return fmt.Sprintf("exceeds the `%s` limit of %d at `%s`", v.Limit, v.Max, v.Path)
+}
+
+// Enabled reports whether any limit is enforced.
+func (l Limits) Enabled() bool {
+	return l.MaxDepth > 0 || l.MaxTokens > 0 || l.MaxKeys > 0 || l.MaxArrayLength > 0 || l.MaxStringLength > 0
+}
+
+// frame defines an object or array being parsed.
+type frame struct {
+	object    bool
+	path      string
+	count     int    // keys or elements so far
+	key       string // key of the current member
+	expectKey bool   // whether the next string is a key
+}
+
+// Check parses the document and returns the first limit it exceeds as a *Violation. Parsing
+// stops as soon as a limit is exceeded, so that pathological documents are never parsed
+// whole. Documents that are not valid JSON return the syntax error instead.
+func (l Limits) Check(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var stack []*frame
+	tokens := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		tokens++
+		if l.MaxTokens > 0 && tokens > l.MaxTokens {
+			path := "$"
+			if top != nil {
+				path = top.path
+			}
+			return &Violation{Limit: LimitTokens, Max: l.MaxTokens, Path: path}
+		}
+
+		if s, ok := tok.(string); ok && top != nil && top.expectKey {
+			top.count++
+			top.key = s
+			top.expectKey = false
+			if l.MaxKeys > 0 && top.count > l.MaxKeys {
+				return &Violation{Limit: LimitKeys, Max: l.MaxKeys, Path: top.path}
+			}
+			if l.MaxStringLength > 0 && len(s) > l.MaxStringLength {
+				return &Violation{Limit: LimitStringLength, Max: l.MaxStringLength, Path: top.path + member(s)}
+			}
+			continue
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				stack[len(stack)-1].expectKey = stack[len(stack)-1].object
+			}
+			continue
+		}
+
+		// the token starts a value, a member of an object or an element of an array
+		path := "$"
+		if top != nil {
+			if top.object {
+				path = top.path + member(top.key)
+			} else {
+				top.count++
+				if l.MaxArrayLength > 0 && top.count > l.MaxArrayLength {
+					return &Violation{Limit: LimitArrayLength, Max: l.MaxArrayLength, Path: top.path}
+				}
+				path = top.path + "[" + strconv.Itoa(top.count-1) + "]"
+			}
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			if l.MaxDepth > 0 && len(stack) >= l.MaxDepth {
+				return &Violation{Limit: LimitDepth, Max: l.MaxDepth, Path: path}
+			}
+			stack = append(stack, &frame{object: t == '{', path: path, expectKey: t == '{'})
+			continue
+		case string:
+			if l.MaxStringLength > 0 && len(t) > l.MaxStringLength {
+				return &Violation{Limit: LimitStringLength, Max: l.MaxStringLength, Path: path}
+			}
+		}
+		if top != nil {
+			top.expectKey = top.object
+		}
+	}
+}
+
+// member returns the path segment of an object member, in dot notation when possible.
+func member(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "['" + name + "']"
+		}
+	}
+	if name == "" {
+		return "['']"
+	}
+	return "." + name
+}
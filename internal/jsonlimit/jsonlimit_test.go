@@ -0,0 +1,63 @@
+package jsonlimit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheck tests the Check method on Limits
+func TestCheck(t *testing.T) {
+
+	type unitTestCase struct {
+		limits Limits
+		doc    string
+		limit  string
+		path   string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{limits: Limits{MaxDepth: 2}, doc: `{"a": [1, 2], "b": {"c": true}}`},
+		{limits: Limits{MaxDepth: 2}, doc: `{"a": [1, {"b": 2}]}`, limit: LimitDepth, path: "$.a[1]"},
+		{limits: Limits{MaxDepth: 1}, doc: `"scalar"`},
+		{limits: Limits{MaxDepth: 3}, doc: strings.Repeat("[", 10000), limit: LimitDepth, path: "$[0][0][0]"},
+		{limits: Limits{MaxTokens: 7}, doc: `{"a": [1, 2]}`},
+		{limits: Limits{MaxTokens: 6}, doc: `{"a": [1, 2]}`, limit: LimitTokens, path: "$"},
+		{limits: Limits{MaxTokens: 4}, doc: `{"a": [1, 2]}`, limit: LimitTokens, path: "$.a"},
+		{limits: Limits{MaxKeys: 2}, doc: `{"a": 1, "b": {"c": 1, "d": 2}}`},
+		{limits: Limits{MaxKeys: 2}, doc: `{"a": {"b": 1, "c": 2, "d": 3}}`, limit: LimitKeys, path: "$.a"},
+		{limits: Limits{MaxArrayLength: 2}, doc: `[[1, 2], [3]]`},
+		{limits: Limits{MaxArrayLength: 2}, doc: `{"items": [{"tags": ["a", "b", "c"]}]}`, limit: LimitArrayLength, path: "$.items[0].tags"},
+		{limits: Limits{MaxStringLength: 3}, doc: `{"abc": "abc"}`},
+		{limits: Limits{MaxStringLength: 3}, doc: `{"a": ["abcd"]}`, limit: LimitStringLength, path: "$.a[0]"},
+		{limits: Limits{MaxStringLength: 3}, doc: `{"a b c d": 1}`, limit: LimitStringLength, path: "$['a b c d']"},
+	} {
+		t.Run(fmt.Sprintf("limits=%+v/doc=%.40s/limit=%s", tCase.limits, tCase.doc, tCase.limit),
+			func(t *testing.T) {
+				err := tCase.limits.Check([]byte(tCase.doc))
+				if tCase.limit == "" {
+					assert.NoError(t, err)
+					return
+				}
+				var v *Violation
+				assert.True(t, errors.As(err, &v), "error: %v", err)
+				assert.Equal(t, tCase.limit, v.Limit)
+				assert.Equal(t, tCase.path, v.Path)
+			})
+	}
+
+	// documents that are not valid JSON return their syntax error
+	for _, doc := range []string{`{"a": }`, `[1, 2`, `not json`} {
+		err := Limits{MaxDepth: 10}.Check([]byte(doc))
+		var v *Violation
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, &v))
+	}
+
+	assert.Equal(t, "exceeds the `max_keys` limit of 2 at `$.a`", (&Violation{Limit: LimitKeys, Max: 2, Path: "$.a"}).Error())
+	assert.False(t, Limits{}.Enabled())
+	assert.True(t, Limits{MaxTokens: 1}.Enabled())
+}
@@ -0,0 +1,239 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentKind defines the kinds of path segments.
+type segmentKind int
+
+const (
+	fieldSegment    segmentKind = iota // `.name` or `['name']`
+	indexSegment                       // `[0]`
+	wildcardSegment                    // `.*` or `[*]`
+)
+
+// segment defines a single step of a Path.
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+}
+
+// Path defines a JSONPath-like selector into a decoded JSON document, such as
+// `$.user.name`, `items[*].id` or `$['odd key'][0]`. The leading `$` is optional.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Parse parses a path expression.
+func Parse(expr string) (Path, error) {
+	p := Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+		if s != "" && s[0] != '.' && s[0] != '[' {
+			return Path{}, fmt.Errorf("invalid path `%s`: unexpected `%c`", expr, s[0])
+		}
+	} else if s != "" && s[0] != '[' {
+		s = "." + s
+	}
+
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return Path{}, fmt.Errorf("invalid path `%s`: empty field name", expr)
+			case "*":
+				p.segments = append(p.segments, segment{kind: wildcardSegment})
+			default:
+				p.segments = append(p.segments, segment{kind: fieldSegment, name: name})
+			}
+		case '[':
+			seg, rest, err := parseBracket(s)
+			if err != nil {
+				return Path{}, fmt.Errorf("invalid path `%s`: %s", expr, err.Error())
+			}
+			p.segments = append(p.segments, seg)
+			s = rest
+		default:
+			return Path{}, fmt.Errorf("invalid path `%s`: unexpected `%c`", expr, s[0])
+		}
+	}
+	return p, nil
+}
+
+// MustParse is like Parse but panics if the expression cannot be parsed.
+func MustParse(expr string) Path {
+	p, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// parseBracket parses a bracketed segment at the start of s and returns the remainder.
+func parseBracket(s string) (segment, string, error) {
+	if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+		quote := s[1]
+		end := strings.IndexByte(s[2:], quote)
+		if end < 0 || len(s) < end+4 || s[end+3] != ']' {
+			return segment{}, "", errors.New("unterminated quoted field name")
+		}
+		return segment{kind: fieldSegment, name: s[2 : end+2]}, s[end+4:], nil
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return segment{}, "", errors.New("missing `]`")
+	}
+	inner := s[1:end]
+	if inner == "*" {
+		return segment{kind: wildcardSegment}, s[end+1:], nil
+	}
+	i, err := strconv.Atoi(inner)
+	if err != nil || i < 0 {
+		return segment{}, "", fmt.Errorf("invalid index `%s`", inner)
+	}
+	return segment{kind: indexSegment, index: i}, s[end+1:], nil
+}
+
+// String returns the expression the path was parsed from.
+func (p Path) String() string {
+	return p.expr
+}
+
+// Select returns the values selected by the path within a document decoded by
+// `encoding/json` into `interface{}`. Wildcards select every element of an array
+// or every value of an object, in key order for objects.
+func (p Path) Select(doc interface{}) []interface{} {
+	values := []interface{}{doc}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, v := range values {
+			switch seg.kind {
+			case fieldSegment:
+				if obj, ok := v.(map[string]interface{}); ok {
+					if fv, ok := obj[seg.name]; ok {
+						next = append(next, fv)
+					}
+				}
+			case indexSegment:
+				if arr, ok := v.([]interface{}); ok && seg.index < len(arr) {
+					next = append(next, arr[seg.index])
+				}
+			case wildcardSegment:
+				switch c := v.(type) {
+				case map[string]interface{}:
+					for _, k := range sortedKeys(c) {
+						next = append(next, c[k])
+					}
+				case []interface{}:
+					next = append(next, c...)
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// Replace replaces every value selected by the path with the value fn returns for it. The
+// document is modified in place and returned, since replacing the root replaces the document.
+func (p Path) Replace(doc interface{}, fn func(v interface{}) interface{}) interface{} {
+	doc, _ = update(doc, p.segments, fn)
+	return doc
+}
+
+// Delete removes every value selected by the path from the object or array holding it.
+// The document is modified in place and returned, or nil when the path selects the root.
+func (p Path) Delete(doc interface{}) interface{} {
+	doc, _ = update(doc, p.segments, nil)
+	return doc
+}
+
+// update replaces the values selected by segs within v with the value fn returns for them,
+// or deletes them when fn is nil. It returns the updated value, and false when v itself is
+// deleted.
+func update(v interface{}, segs []segment, fn func(v interface{}) interface{}) (interface{}, bool) {
+	if len(segs) == 0 {
+		if fn == nil {
+			return nil, false
+		}
+		return fn(v), true
+	}
+
+	seg, rest := segs[0], segs[1:]
+	switch c := v.(type) {
+	case map[string]interface{}:
+		var keys []string
+		switch seg.kind {
+		case fieldSegment:
+			if _, ok := c[seg.name]; ok {
+				keys = []string{seg.name}
+			}
+		case wildcardSegment:
+			keys = sortedKeys(c)
+		}
+		for _, k := range keys {
+			if nv, keep := update(c[k], rest, fn); keep {
+				c[k] = nv
+			} else {
+				delete(c, k)
+			}
+		}
+	case []interface{}:
+		var indexes []int
+		switch seg.kind {
+		case indexSegment:
+			if seg.index < len(c) {
+				indexes = []int{seg.index}
+			}
+		case wildcardSegment:
+			for i := range c {
+				indexes = append(indexes, i)
+			}
+		}
+		deleted := map[int]bool{}
+		for _, i := range indexes {
+			if nv, keep := update(c[i], rest, fn); keep {
+				c[i] = nv
+			} else {
+				deleted[i] = true
+			}
+		}
+		if len(deleted) > 0 {
+			kept := make([]interface{}, 0, len(c)-len(deleted))
+			for i, e := range c {
+				if !deleted[i] {
+					kept = append(kept, e)
+				}
+			}
+			return kept, true
+		}
+	}
+	return v, true
+}
+
+// sortedKeys returns the keys of the object in order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
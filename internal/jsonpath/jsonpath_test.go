@@ -0,0 +1,93 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSelect tests the Parse function and the Select method on Path
+func TestSelect(t *testing.T) {
+
+	type unitTestCase struct {
+		expr   string
+		values []interface{}
+	}
+
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"body": "message",
+		"user": {"id": 1, "name": "jane"},
+		"items": [{"id": "a"}, {"id": "b"}, {"name": "c"}],
+		"odd key": [true]
+	}`), &doc)
+	assert.NoError(t, err)
+
+	for _, tCase := range []unitTestCase{
+		{expr: "$", values: []interface{}{doc}},
+		{expr: "$.body", values: []interface{}{"message"}},
+		{expr: "body", values: []interface{}{"message"}},
+		{expr: "$.user.id", values: []interface{}{float64(1)}},
+		{expr: "user.*", values: []interface{}{float64(1), "jane"}},
+		{expr: "$.items[1].id", values: []interface{}{"b"}},
+		{expr: "$.items[*].id", values: []interface{}{"a", "b"}},
+		{expr: "$['odd key'][0]", values: []interface{}{true}},
+		{expr: `$["user"]["name"]`, values: []interface{}{"jane"}},
+		{expr: "$.missing", values: nil},
+		{expr: "$.items[9]", values: nil},
+		{expr: "$.body.id", values: nil},
+	} {
+		t.Run(tCase.expr, func(t *testing.T) {
+			p, err := Parse(tCase.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expr, p.String())
+			assert.Equal(t, tCase.values, p.Select(doc))
+		})
+	}
+}
+
+// TestParseErrors tests that Parse rejects malformed expressions
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"$.", "$..a", "$[", "$[a]", "$[-1]", "$['a]", "$['a'x", "$a"} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := Parse(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestReplaceAndDelete tests the Replace and Delete methods on Path
+func TestReplaceAndDelete(t *testing.T) {
+
+	type unitTestCase struct {
+		expr     string
+		replaced string
+		deleted  string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{expr: "$.user.name", replaced: `{"user": {"id": 1, "name": "x"}, "items": [{"id": "a"}, {"id": "b"}]}`, deleted: `{"user": {"id": 1}, "items": [{"id": "a"}, {"id": "b"}]}`},
+		{expr: "$.items[*].id", replaced: `{"user": {"id": 1, "name": "jane"}, "items": [{"id": "x"}, {"id": "x"}]}`, deleted: `{"user": {"id": 1, "name": "jane"}, "items": [{}, {}]}`},
+		{expr: "$.items[0]", replaced: `{"user": {"id": 1, "name": "jane"}, "items": ["x", {"id": "b"}]}`, deleted: `{"user": {"id": 1, "name": "jane"}, "items": [{"id": "b"}]}`},
+		{expr: "$.items[*]", replaced: `{"user": {"id": 1, "name": "jane"}, "items": ["x", "x"]}`, deleted: `{"user": {"id": 1, "name": "jane"}, "items": []}`},
+		{expr: "$.user.*", replaced: `{"user": {"id": "x", "name": "x"}, "items": [{"id": "a"}, {"id": "b"}]}`, deleted: `{"user": {}, "items": [{"id": "a"}, {"id": "b"}]}`},
+		{expr: "$.missing", replaced: `{"user": {"id": 1, "name": "jane"}, "items": [{"id": "a"}, {"id": "b"}]}`, deleted: `{"user": {"id": 1, "name": "jane"}, "items": [{"id": "a"}, {"id": "b"}]}`},
+		{expr: "$", replaced: `"x"`, deleted: `null`},
+	} {
+		t.Run(tCase.expr, func(t *testing.T) {
+			p := MustParse(tCase.expr)
+			decode := func() interface{} {
+				var doc interface{}
+				assert.NoError(t, json.Unmarshal([]byte(`{"user": {"id": 1, "name": "jane"}, "items": [{"id": "a"}, {"id": "b"}]}`), &doc))
+				return doc
+			}
+
+			replaced, _ := json.Marshal(p.Replace(decode(), func(interface{}) interface{} { return "x" }))
+			assert.JSONEq(t, tCase.replaced, string(replaced))
+
+			deleted, _ := json.Marshal(p.Delete(decode()))
+			assert.JSONEq(t, tCase.deleted, string(deleted))
+		})
+	}
+}
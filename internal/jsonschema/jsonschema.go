@@ -0,0 +1,766 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema. It supports the validation keywords of draft 7 and
+// 2020-12 that apply to request bodies: `type`, `enum`, `const`, `properties`, `required`,
+// `additionalProperties`, `minProperties`, `maxProperties`, `items`, `minItems`, `maxItems`,
+// `uniqueItems`, `minLength`, `maxLength`, `pattern`, `minimum`, `maximum`, `exclusiveMinimum`,
+// `exclusiveMaximum`, `multipleOf`, `allOf`, `anyOf`, `oneOf`, `not` and local `$ref`s to
+// `$defs` or `definitions`, as well as the `nullable` keyword of OpenAPI 3.0. Other keywords,
+// such as `format`, are ignored.
+type Schema struct {
+	boolean *bool // set for the `true` and `false` schemas
+
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties    map[string]*Schema
+	required      []string
+	additional    *Schema
+	minProperties *int
+	maxProperties *int
+
+	items       *Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+
+	ref string
+	c   *compiler // resolves `$ref`s
+}
+
+// Violation defines a part of a document that does not conform to a schema.
+type Violation struct {
+	Path    string `json:"path"`    // path of the offending value (e.g., `$.items[0].id`)
+	Keyword string `json:"keyword"` // schema keyword that failed (e.g., `required`)
+	Message string `json:"message"` // human readable description
+}
+
+// compiler holds the document a schema was compiled from, so that `$ref`s can be resolved.
+type compiler struct {
+	root interface{}
+	refs map[string]*Schema
+}
+
+// Compile compiles a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+	root, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompiler(root).Compile(root, "#")
+}
+
+// Compiler compiles the schemas embedded in a larger document, such as an OpenAPI description,
+// resolving their `$ref`s against the whole document.
+type Compiler struct {
+	c *compiler
+}
+
+// NewCompiler returns a Compiler for the schemas of a document decoded by Decode.
+func NewCompiler(root interface{}) *Compiler {
+	return &Compiler{c: &compiler{root: root, refs: map[string]*Schema{}}}
+}
+
+// Compile compiles the schema v found at the given location (e.g., `#/components/schemas/Post`)
+// of the document.
+func (c *Compiler) Compile(v interface{}, loc string) (*Schema, error) {
+	s, err := c.c.compile(v, loc)
+	if err != nil {
+		return nil, err
+	}
+	// resolve every reference up front, so that invalid ones are reported at startup
+	for len(c.c.refs) > 0 {
+		n := len(c.c.refs)
+		for ref := range c.c.refs {
+			if _, err := c.c.resolve(ref); err != nil {
+				return nil, err
+			}
+		}
+		if len(c.c.refs) == n {
+			break
+		}
+	}
+	if err := c.c.checkCycles(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load compiles the JSON Schema held in a file.
+func Load(path string) (*Schema, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Compile(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return s, nil
+}
+
+// Decode decodes a JSON document, keeping numbers as `json.Number` as Validate expects.
+func Decode(data []byte) (interface{}, error) {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	return doc, nil
+}
+
+// compile compiles the schema found at the given location of the document.
+func (c *compiler) compile(v interface{}, loc string) (*Schema, error) {
+	s := &Schema{c: c}
+	switch t := v.(type) {
+	case bool:
+		s.boolean = &t
+		return s, nil
+	case map[string]interface{}:
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", loc)
+	}
+	m := v.(map[string]interface{})
+
+	var err error
+	if ref, ok := m["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, "#") {
+			return nil, fmt.Errorf("%s: only local references are supported, got `%s`", loc, ref)
+		}
+		s.ref = ref
+		if _, ok := c.refs[ref]; !ok {
+			c.refs[ref] = nil
+		}
+	}
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, e := range t {
+			name, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/type: must be a string or an array of strings", loc)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("%s/type: must be a string or an array of strings", loc)
+	}
+	for _, name := range s.types {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("%s/type: unknown type `%s`", loc, name)
+		}
+	}
+	// `nullable` is how OpenAPI 3.0 descriptions allow null values
+	if nullable, _ := m["nullable"].(bool); nullable && len(s.types) > 0 {
+		s.types = append(s.types, "null")
+	}
+
+	if e, ok := m["enum"]; ok {
+		if s.enum, ok = e.([]interface{}); !ok {
+			return nil, fmt.Errorf("%s/enum: must be an array", loc)
+		}
+	}
+	if cv, ok := m["const"]; ok {
+		s.constant, s.hasConst = cv, true
+	}
+
+	if p, ok := m["properties"]; ok {
+		props, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", loc)
+		}
+		s.properties = map[string]*Schema{}
+		for name, ps := range props {
+			if s.properties[name], err = c.compile(ps, loc+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r, ok := m["required"]; ok {
+		req, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be an array of strings", loc)
+		}
+		for _, e := range req {
+			name, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array of strings", loc)
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if s.additional, err = c.subschema(m, "additionalProperties", loc); err != nil {
+		return nil, err
+	}
+	if s.items, err = c.subschema(m, "items", loc); err != nil {
+		return nil, err
+	}
+	if s.not, err = c.subschema(m, "not", loc); err != nil {
+		return nil, err
+	}
+	if s.allOf, err = c.subschemas(m, "allOf", loc); err != nil {
+		return nil, err
+	}
+	if s.anyOf, err = c.subschemas(m, "anyOf", loc); err != nil {
+		return nil, err
+	}
+	if s.oneOf, err = c.subschemas(m, "oneOf", loc); err != nil {
+		return nil, err
+	}
+
+	for keyword, dst := range map[string]**int{
+		"minProperties": &s.minProperties, "maxProperties": &s.maxProperties,
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+	} {
+		if *dst, err = integer(m, keyword, loc); err != nil {
+			return nil, err
+		}
+	}
+	for keyword, dst := range map[string]**float64{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum, "exclusiveMaximum": &s.exclusiveMaximum,
+		"multipleOf": &s.multipleOf,
+	} {
+		if _, ok := m[keyword].(bool); ok && strings.HasPrefix(keyword, "exclusive") {
+			continue
+		}
+		if *dst, err = number(m, keyword, loc); err != nil {
+			return nil, err
+		}
+	}
+	// the boolean `exclusiveMinimum` and `exclusiveMaximum` of draft 4 and OpenAPI 3.0
+	// make `minimum` and `maximum` exclusive
+	if b, _ := m["exclusiveMinimum"].(bool); b {
+		s.exclusiveMinimum, s.minimum = s.minimum, nil
+	}
+	if b, _ := m["exclusiveMaximum"].(bool); b {
+		s.exclusiveMaximum, s.maximum = s.maximum, nil
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return nil, fmt.Errorf("%s/multipleOf: must be greater than 0", loc)
+	}
+
+	if u, ok := m["uniqueItems"].(bool); ok {
+		s.uniqueItems = u
+	}
+	if p, ok := m["pattern"]; ok {
+		expr, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", loc)
+		}
+		if s.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %s", loc, err.Error())
+		}
+	}
+	return s, nil
+}
+
+// subschema compiles the schema held by the keyword of m, if any.
+func (c *compiler) subschema(m map[string]interface{}, keyword string, loc string) (*Schema, error) {
+	v, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(v, loc+"/"+keyword)
+}
+
+// subschemas compiles the array of schemas held by the keyword of m, if any.
+func (c *compiler) subschemas(m map[string]interface{}, keyword string, loc string) ([]*Schema, error) {
+	v, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("%s/%s: must be a non-empty array of schemas", loc, keyword)
+	}
+	var schemas []*Schema
+	for i, e := range arr {
+		s, err := c.compile(e, loc+"/"+keyword+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, nil
+}
+
+// resolve returns the schema a local `$ref` points to, compiling it the first time.
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	if s := c.refs[ref]; s != nil {
+		return s, nil
+	}
+
+	v, err := Pointer(c.root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// register a placeholder first, so that recursive references terminate
+	s := &Schema{c: c}
+	c.refs[ref] = s
+	compiled, err := c.compile(v, ref)
+	if err != nil {
+		return nil, err
+	}
+	*s = *compiled
+	return s, nil
+}
+
+// checkCycles reports `$ref`s that lead back to themselves without descending into the instance
+// (through `properties`, `additionalProperties` or `items`), which validation would follow forever.
+func (c *compiler) checkCycles(root *Schema) error {
+	const (
+		onChain = 1
+		checked = 2
+	)
+	state := map[*Schema]int{}
+	pending := []*Schema{root}
+	var walk func(s *Schema, via string) error
+	walk = func(s *Schema, via string) error {
+		if s == nil || state[s] == checked {
+			return nil
+		}
+		if state[s] == onChain {
+			return fmt.Errorf("`$ref` %q is circular and never reaches a schema", via)
+		}
+		state[s] = onChain
+		next := append([]*Schema{s.not}, s.allOf...)
+		next = append(next, s.anyOf...)
+		next = append(next, s.oneOf...)
+		for _, sub := range next {
+			if err := walk(sub, via); err != nil {
+				return err
+			}
+		}
+		if s.ref != "" {
+			if err := walk(c.refs[s.ref], s.ref); err != nil {
+				return err
+			}
+		}
+		state[s] = checked
+		for _, sub := range s.properties {
+			pending = append(pending, sub)
+		}
+		pending = append(pending, s.additional, s.items)
+		return nil
+	}
+	for len(pending) > 0 {
+		s := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if err := walk(s, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pointer returns the value a local reference (e.g., `#/$defs/tag`) points to within a document.
+func Pointer(doc interface{}, ref string) (interface{}, error) {
+	v := doc
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("unresolvable reference `%s`", ref)
+			}
+			v = t[i]
+		default:
+			v = nil
+		}
+		if v == nil {
+			return nil, fmt.Errorf("unresolvable reference `%s`", ref)
+		}
+	}
+	return v, nil
+}
+
+// integer returns the non-negative integer held by the keyword of m, if any.
+func integer(m map[string]interface{}, keyword string, loc string) (*int, error) {
+	v, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", loc, keyword)
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil || i < 0 {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", loc, keyword)
+	}
+	return &i, nil
+}
+
+// number returns the number held by the keyword of m, if any.
+func number(m map[string]interface{}, keyword string, loc string) (*float64, error) {
+	v, ok := m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a number", loc, keyword)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: must be a number", loc, keyword)
+	}
+	return &f, nil
+}
+
+// Validate validates a document decoded by Decode against the schema and returns its violations.
+func (s *Schema) Validate(doc interface{}) []Violation {
+	return s.validate(doc, "$", nil)
+}
+
+// validate appends the violations of v, found at path, to vs.
+func (s *Schema) validate(v interface{}, path string, vs []Violation) []Violation {
+	if s.boolean != nil {
+		if !*s.boolean {
+			vs = append(vs, Violation{Path: path, Keyword: "false", Message: "no value is allowed"})
+		}
+		return vs
+	}
+	add := func(keyword string, format string, args ...interface{}) {
+		vs = append(vs, Violation{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.ref != "" {
+		ref, err := s.c.resolve(s.ref)
+		if err != nil {
+			add("$ref", "%s", err.Error())
+		} else {
+			vs = ref.validate(v, path, vs)
+		}
+	}
+
+	if len(s.types) > 0 && !matchesType(v, s.types) {
+		add("type", "must be of type %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		return vs
+	}
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("enum", "must be one of %s", compact(s.enum))
+		}
+	}
+	if s.hasConst && !equal(v, s.constant) {
+		add("const", "must be %s", compact(s.constant))
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := t[name]; !ok {
+				add("required", "missing required property `%s`", name)
+			}
+		}
+		if s.minProperties != nil && len(t) < *s.minProperties {
+			add("minProperties", "must have at least %d properties", *s.minProperties)
+		}
+		if s.maxProperties != nil && len(t) > *s.maxProperties {
+			add("maxProperties", "must have at most %d properties", *s.maxProperties)
+		}
+		for _, name := range sortedKeys(t) {
+			child := path + member(name)
+			if ps, ok := s.properties[name]; ok {
+				vs = ps.validate(t[name], child, vs)
+			} else if s.additional != nil {
+				if s.additional.boolean != nil && !*s.additional.boolean {
+					vs = append(vs, Violation{Path: child, Keyword: "additionalProperties", Message: "unexpected property"})
+				} else {
+					vs = s.additional.validate(t[name], child, vs)
+				}
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(t) < *s.minItems {
+			add("minItems", "must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(t) > *s.maxItems {
+			add("maxItems", "must have at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+			first := make(map[string]int, len(t))
+			reported := map[string]bool{}
+			for i, item := range t {
+				key := canonical(item)
+				j, seen := first[key]
+				if !seen {
+					first[key] = i
+				} else if !reported[key] {
+					reported[key] = true
+					add("uniqueItems", "item %d must not be equal to item %d", i, j)
+				}
+			}
+		}
+		if s.items != nil {
+			for i, e := range t {
+				vs = s.items.validate(e, path+"["+strconv.Itoa(i)+"]", vs)
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.minLength != nil && n < *s.minLength {
+			add("minLength", "must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			add("maxLength", "must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			add("pattern", "must match the pattern `%s`", s.pattern.String())
+		}
+
+	case json.Number:
+		f, _ := t.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			add("minimum", "must be greater than or equal to %v", *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			add("maximum", "must be less than or equal to %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+			add("exclusiveMinimum", "must be greater than %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+			add("exclusiveMaximum", "must be less than %v", *s.exclusiveMaximum)
+		}
+		if s.multipleOf != nil {
+			q := f / *s.multipleOf
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				add("multipleOf", "must be a multiple of %v", *s.multipleOf)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		vs = sub.validate(v, path, vs)
+	}
+	if len(s.anyOf) > 0 {
+		valid := false
+		for _, sub := range s.anyOf {
+			if len(sub.validate(v, path, nil)) == 0 {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			add("anyOf", "must match at least one of the schemas")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		n := 0
+		for _, sub := range s.oneOf {
+			if len(sub.validate(v, path, nil)) == 0 {
+				n++
+			}
+		}
+		if n != 1 {
+			add("oneOf", "must match exactly one of the schemas, matched %d", n)
+		}
+	}
+	if s.not != nil && len(s.not.validate(v, path, nil)) == 0 {
+		add("not", "must not match the schema")
+	}
+	return vs
+}
+
+// matchesType reports whether v is of one of the given types.
+func matchesType(v interface{}, types []string) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of v. Numbers without a fractional part are integers.
+func typeOf(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := t.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equal reports whether two decoded documents are equal, comparing numbers by value.
+func equal(a interface{}, b interface{}) bool {
+	switch at := a.(type) {
+	case json.Number:
+		bt, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, _ := at.Float64()
+		bf, _ := bt.Float64()
+		return af == bf
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, av := range at {
+			bv, ok := bt[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !equal(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// canonical returns an encoding of v that is the same for documents that are equal, sorting
+// object keys and comparing numbers by value.
+func canonical(v interface{}) string {
+	var b strings.Builder
+	var write func(v interface{})
+	write = func(v interface{}) {
+		switch t := v.(type) {
+		case json.Number:
+			if f, err := t.Float64(); err == nil {
+				b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+				return
+			}
+			b.WriteString(t.String())
+		case map[string]interface{}:
+			b.WriteByte('{')
+			for i, k := range sortedKeys(t) {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString(strconv.Quote(k))
+				b.WriteByte(':')
+				write(t[k])
+			}
+			b.WriteByte('}')
+		case []interface{}:
+			b.WriteByte('[')
+			for i, item := range t {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				write(item)
+			}
+			b.WriteByte(']')
+		default:
+			b.WriteString(compact(v))
+		}
+	}
+	write(v)
+	return b.String()
+}
+
+// member returns the path segment selecting the named property.
+func member(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "['" + name + "']"
+		}
+	}
+	if name == "" {
+		return "['']"
+	}
+	return "." + name
+}
+
+// compact returns the JSON representation of v.
+func compact(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
+
+// sortedKeys returns the keys of the object in order, so that violations are reported in a stable order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,152 @@
+package jsonschema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const postSchema = `{
+	"$defs": {
+		"tag": {"type": "string", "minLength": 1, "maxLength": 8}
+	},
+	"type": "object",
+	"required": ["title", "userId"],
+	"additionalProperties": false,
+	"properties": {
+		"title": {"type": "string", "pattern": "^[A-Z]"},
+		"body": {"type": ["string", "null"]},
+		"userId": {"type": "integer", "minimum": 1},
+		"rating": {"type": "number", "exclusiveMaximum": 5, "multipleOf": 0.5},
+		"status": {"enum": ["draft", "published"]},
+		"version": {"const": 1},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 3, "uniqueItems": true},
+		"meta": {"type": "object", "minProperties": 1, "additionalProperties": {"type": "string"}},
+		"id": {"oneOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+$"}]},
+		"slug": {"anyOf": [{"type": "null"}, {"type": "string"}], "not": {"const": "admin"}},
+		"score": {"allOf": [{"minimum": 0}, {"maximum": 100}]}
+	}
+}`
+
+// TestValidate tests the Validate method on Schema
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(postSchema))
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		body       string
+		violations []string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{body: `{"title": "Hello", "userId": 1}`},
+		{body: `{"title": "Hello", "userId": 1.0, "body": null, "rating": 4.5, "status": "draft", "version": 1.0}`},
+		{body: `{"title": "Hello", "userId": 1, "tags": ["a", "b"], "meta": {"k": "v"}, "id": "12", "slug": null, "score": 50}`},
+		{body: `[]`, violations: []string{"$ type"}},
+		{body: `{}`, violations: []string{"$ required", "$ required"}},
+		{body: `{"title": "hello", "userId": 0}`, violations: []string{"$.title pattern", "$.userId minimum"}},
+		{body: `{"title": "Hello", "userId": 1.5}`, violations: []string{"$.userId type"}},
+		{body: `{"title": "Hello", "userId": "1"}`, violations: []string{"$.userId type"}},
+		{body: `{"title": "Hello", "userId": 1, "extra": true, "odd key": 1}`, violations: []string{"$.extra additionalProperties", "$['odd key'] additionalProperties"}},
+		{body: `{"title": "Hello", "userId": 1, "rating": 5}`, violations: []string{"$.rating exclusiveMaximum"}},
+		{body: `{"title": "Hello", "userId": 1, "rating": 4.2}`, violations: []string{"$.rating multipleOf"}},
+		{body: `{"title": "Hello", "userId": 1, "status": "deleted", "version": 2}`, violations: []string{"$.status enum", "$.version const"}},
+		{body: `{"title": "Hello", "userId": 1, "tags": ["a", "", "a", "toolongtag"]}`, violations: []string{"$.tags maxItems", "$.tags uniqueItems", "$.tags[1] minLength", "$.tags[3] maxLength"}},
+		{body: `{"title": "Hello", "userId": 1, "meta": {}}`, violations: []string{"$.meta minProperties"}},
+		{body: `{"title": "Hello", "userId": 1, "meta": {"k": 1}}`, violations: []string{"$.meta.k type"}},
+		{body: `{"title": "Hello", "userId": 1, "id": "x"}`, violations: []string{"$.id oneOf"}},
+		{body: `{"title": "Hello", "userId": 1, "slug": 1}`, violations: []string{"$.slug anyOf"}},
+		{body: `{"title": "Hello", "userId": 1, "slug": "admin"}`, violations: []string{"$.slug not"}},
+		{body: `{"title": "Hello", "userId": 1, "score": 101}`, violations: []string{"$.score maximum"}},
+	} {
+		t.Run(fmt.Sprintf("body=%s", tCase.body), func(t *testing.T) {
+			doc, err := Decode([]byte(tCase.body))
+			assert.NoError(t, err)
+
+			var got []string
+			for _, v := range s.Validate(doc) {
+				assert.NotEmpty(t, v.Message)
+				got = append(got, v.Path+" "+v.Keyword)
+			}
+			assert.Equal(t, tCase.violations, got)
+		})
+	}
+}
+
+// TestUniqueItems tests that each repeated item is reported once, pointing at its first occurrence
+func TestUniqueItems(t *testing.T) {
+	s, err := Compile([]byte(`{"uniqueItems": true}`))
+	assert.NoError(t, err)
+
+	doc, _ := Decode([]byte(`[1, "a", 1.0, {"x": 1, "y": [2]}, 1, {"y": [2.0], "x": 1}, "b", [1, 2], [2, 1]]`))
+	var got []string
+	for _, v := range s.Validate(doc) {
+		got = append(got, v.Message)
+	}
+	assert.Equal(t, []string{"item 2 must not be equal to item 0", "item 5 must not be equal to item 3"}, got)
+}
+
+// TestRecursiveRef tests that a schema may reference itself
+func TestRecursiveRef(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"definitions": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/definitions/node"}}, "id": {"type": "integer"}}}},
+		"$ref": "#/definitions/node"
+	}`))
+	assert.NoError(t, err)
+
+	doc, _ := Decode([]byte(`{"id": 1, "children": [{"id": 2, "children": [{"id": "3"}]}]}`))
+	vs := s.Validate(doc)
+	assert.Len(t, vs, 1)
+	assert.Equal(t, "$.children[0].children[0].id", vs[0].Path)
+}
+
+// TestCircularRef tests that `$ref`s leading back to themselves without descending into the instance are rejected
+func TestCircularRef(t *testing.T) {
+	for _, schema := range []string{
+		`{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"not": {"$ref": "#"}}}, "properties": {"x": {"$ref": "#/$defs/a"}}, "anyOf": [{"$ref": "#/$defs/a"}]}`,
+	} {
+		_, err := Compile([]byte(schema))
+		assert.Error(t, err, schema)
+	}
+
+	_, err := Compile([]byte(`{"$defs": {"a": {"properties": {"next": {"$ref": "#/$defs/a"}}}}, "$ref": "#/$defs/a"}`))
+	assert.NoError(t, err)
+}
+
+// TestCompile tests that invalid schemas are reported by Compile and Load
+func TestCompile(t *testing.T) {
+	for _, schema := range []string{
+		`[]`,
+		`{"type": "text"}`,
+		`{"required": "id"}`,
+		`{"minLength": -1}`,
+		`{"maximum": "10"}`,
+		`{"multipleOf": 0}`,
+		`{"pattern": "("}`,
+		`{"anyOf": []}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "other.json#/a"}`,
+		`{"properties": {"a": 1}}`,
+		`{} {}`,
+	} {
+		_, err := Compile([]byte(schema))
+		assert.Error(t, err, schema)
+	}
+
+	s, err := Compile([]byte(`false`))
+	assert.NoError(t, err)
+	assert.Len(t, s.Validate(nil), 1)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(postSchema), 0644))
+	_, err = Load(path)
+	assert.NoError(t, err)
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
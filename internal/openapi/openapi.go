@@ -0,0 +1,661 @@
+// Package openapi validates requests and responses against an OpenAPI 3 description of an API.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// methods are the operations a path item may describe.
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is a compiled OpenAPI 3 description of an API.
+type Document struct {
+	paths []*pathItem // ordered from the most to the least specific
+}
+
+// pathItem defines the operations available on a path template (e.g., `/posts/{id}`).
+type pathItem struct {
+	template   string
+	re         *regexp.Regexp
+	names      []string // names of the path parameters, in the order they appear
+	literal    int      // number of characters outside of path parameters
+	operations map[string]*Operation
+}
+
+// Operation defines what the API accepts and returns for a method on a path.
+type Operation struct {
+	Method string // upper case HTTP method
+	Path   string // path template (e.g., `/posts/{id}`)
+	ID     string // `operationId`, if any
+
+	parameters []*parameter
+	body       *requestBody
+	responses  map[string]content // keyed by status code, lower case status code range (e.g., `2xx`) or `default`
+}
+
+// parameter defines a path, query, header or cookie parameter of an operation.
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	explode  bool               // whether array values are repeated rather than comma-separated
+	kind     string             // type the raw values are converted to before they are validated
+	itemKind string             // type the items of array values are converted to
+	schema   *jsonschema.Schema // nil when the parameter has no schema
+}
+
+// requestBody defines the request body of an operation.
+type requestBody struct {
+	required bool
+	content  content
+}
+
+// content maps media ranges (e.g., `application/json` or `image/*`) to the schema of their
+// documents, which is nil when the media type has no schema. A nil content accepts anything.
+type content map[string]*jsonschema.Schema
+
+// Error describes how a request or response does not conform to the description.
+type Error struct {
+	Status     int    // status code the request should be rejected with
+	Msg        string // human readable description
+	Violations []jsonschema.Violation
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// jsonNumber matches the values of parameters that are converted to numbers.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// pathParameter matches the path parameters of a path template.
+var pathParameter = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// Load compiles the OpenAPI description held in a JSON or YAML file.
+func Load(path string) (*Document, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return d, nil
+}
+
+// Parse compiles an OpenAPI 3 description written in JSON or YAML. The schemas it holds,
+// including those referenced from `#/components`, are compiled up front so that invalid
+// ones are reported at startup.
+func Parse(data []byte) (*Document, error) {
+	root, err := jsonschema.Decode(data)
+	if err != nil {
+		var y interface{}
+		if err := yaml.Unmarshal(data, &y); err != nil {
+			return nil, err
+		}
+		buf, err := json.Marshal(jsonValue(y))
+		if err != nil {
+			return nil, err
+		}
+		if root, err = jsonschema.Decode(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	m, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("description must be an object")
+	}
+	if version, _ := m["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version `%s`, expected 3.x", version)
+	}
+	paths, ok := m["paths"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("#/paths: must be an object")
+	}
+
+	c := &compiler{root: root, schemas: jsonschema.NewCompiler(root)}
+	d := &Document{}
+	for _, template := range sortedKeys(paths) {
+		item, err := c.pathItem(template, paths[template])
+		if err != nil {
+			return nil, err
+		}
+		d.paths = append(d.paths, item)
+	}
+
+	// concrete paths (e.g., `/posts/mine`) are matched before templated ones (e.g., `/posts/{id}`)
+	sort.SliceStable(d.paths, func(i, j int) bool {
+		a, b := d.paths[i], d.paths[j]
+		if len(a.names) != len(b.names) {
+			return len(a.names) < len(b.names)
+		}
+		return a.literal > b.literal
+	})
+	return d, nil
+}
+
+// Find returns the operation matching the method and path of a request, along with the values
+// of its path parameters. When no operation matches, allowed lists the methods described for
+// the path, which is empty when the path is not described at all. `HEAD` requests match the
+// `GET` operation of paths that do not describe one of their own.
+func (d *Document) Find(method string, path string) (op *Operation, params map[string]string, allowed []string) {
+	for _, item := range d.paths {
+		values := item.re.FindStringSubmatch(path)
+		if values == nil {
+			continue
+		}
+
+		op = item.operations[method]
+		if op == nil && method == http.MethodHead {
+			op = item.operations[http.MethodGet]
+		}
+		if op == nil {
+			for m := range item.operations {
+				allowed = append(allowed, m)
+			}
+			if item.operations[http.MethodGet] != nil && item.operations[http.MethodHead] == nil {
+				allowed = append(allowed, http.MethodHead)
+			}
+			sort.Strings(allowed)
+			return nil, nil, allowed
+		}
+
+		params = map[string]string{}
+		for i, name := range item.names {
+			params[name] = values[i+1]
+		}
+		return op, params, nil
+	}
+	return nil, nil, nil
+}
+
+// ValidateRequest validates the parameters and body of a request against the operation, given
+// the values of the path parameters returned by Find. Parameters that do not conform are
+// reported with a 400, unaccepted media types with a 415, bodies that are missing or are not
+// valid JSON with a 400, and bodies that do not conform to their schema with a 422.
+func (op *Operation) ValidateRequest(r *http.Request, params map[string]string, body []byte) *Error {
+	var violations []jsonschema.Violation
+	query := r.URL.Query()
+	for _, p := range op.parameters {
+		var values []string
+		switch p.in {
+		case "path":
+			if v, ok := params[p.name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[p.name]
+		case "header":
+			values = r.Header.Values(p.name)
+		case "cookie":
+			if c, err := r.Cookie(p.name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+
+		loc := p.in + "." + p.name
+		if len(values) == 0 {
+			if p.required {
+				violations = append(violations, jsonschema.Violation{
+					Path:    loc,
+					Keyword: "required",
+					Message: "missing required " + p.in + " parameter `" + p.name + "`",
+				})
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		for _, v := range p.schema.Validate(p.value(values)) {
+			v.Path = loc + strings.TrimPrefix(v.Path, "$")
+			violations = append(violations, v)
+		}
+	}
+	if len(violations) > 0 {
+		return &Error{
+			Status:     400,
+			Msg:        "request parameters do not conform to the API description of " + op.String(),
+			Violations: violations,
+		}
+	}
+
+	if op.body == nil {
+		return nil
+	}
+	if len(body) == 0 {
+		if op.body.required {
+			return &Error{Status: 400, Msg: "request body is required by " + op.String()}
+		}
+		return nil
+	}
+	return op.validateContent(op.body.content, r.Header.Get("Content-Type"), body, "request body")
+}
+
+// ValidateResponse validates the status code and body, of the given media type, of a response
+// to the operation. Every error it returns has a 502 status, since the client is not at fault.
+func (op *Operation) ValidateResponse(status int, contentType string, body []byte) *Error {
+	if op.responses == nil {
+		return nil
+	}
+
+	code := strconv.Itoa(status)
+	ct, ok := op.responses[code]
+	if !ok {
+		ct, ok = op.responses[code[:1]+"xx"]
+	}
+	if !ok {
+		ct, ok = op.responses["default"]
+	}
+	if !ok {
+		return &Error{Status: 502, Msg: "status code " + code + " is not described for " + op.String()}
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	if err := op.validateContent(ct, contentType, body, "response body"); err != nil {
+		err.Status = 502
+		return err
+	}
+	return nil
+}
+
+// String returns the method and path template of the operation (e.g., "`GET /posts/{id}`").
+func (op *Operation) String() string {
+	return "`" + op.Method + " " + op.Path + "`"
+}
+
+// validateContent validates a request or response body of the given media type against the
+// schema the content describes for it. Only JSON bodies are validated against schemas.
+func (op *Operation) validateContent(ct content, contentType string, body []byte, subject string) *Error {
+	if ct == nil {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	schema, ok := ct.lookup(mediaType)
+	if !ok {
+		return &Error{
+			Status: 415,
+			Msg:    fmt.Sprintf("%s media type `%s` is not one of `%s` described for %s", subject, mediaType, strings.Join(sortedKeys(ct), ", "), op.String()),
+		}
+	}
+	if schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+
+	doc, err := jsonschema.Decode(body)
+	if err != nil {
+		return &Error{Status: 400, Msg: subject + " is not valid JSON: " + err.Error()}
+	}
+	if violations := schema.Validate(doc); len(violations) > 0 {
+		return &Error{
+			Status:     422,
+			Msg:        subject + " does not conform to the API description of " + op.String(),
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+// lookup returns the schema of the most specific media range matching the media type.
+func (ct content) lookup(mediaType string) (*jsonschema.Schema, bool) {
+	if s, ok := ct[mediaType]; ok {
+		return s, true
+	}
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if s, ok := ct[mediaType[:i]+"/*"]; ok {
+			return s, true
+		}
+	}
+	s, ok := ct["*/*"]
+	return s, ok
+}
+
+// isJSON reports whether documents of the media type are JSON.
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// value converts the raw values of a parameter to the type its schema describes, so that
+// `?limit=10` is validated as a number. Values that cannot be converted are left as strings,
+// so that they are reported as being of the wrong type.
+func (p *parameter) value(values []string) interface{} {
+	if p.kind != "array" {
+		return convert(values[0], p.kind)
+	}
+	items := []interface{}{}
+	for _, v := range values {
+		parts := []string{v}
+		if !p.explode {
+			parts = strings.Split(v, ",")
+		}
+		for _, part := range parts {
+			items = append(items, convert(part, p.itemKind))
+		}
+	}
+	return items
+}
+
+// convert converts a raw parameter value to the given type, if it can.
+func convert(s string, kind string) interface{} {
+	switch kind {
+	case "integer", "number":
+		if jsonNumber.MatchString(s) {
+			return json.Number(s)
+		}
+	case "boolean":
+		switch s {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+	return s
+}
+
+// compiler compiles the parts of a description, resolving their `$ref`s against the whole of it.
+type compiler struct {
+	root    interface{}
+	schemas *jsonschema.Compiler
+}
+
+// pathItem compiles the operations described for a path template.
+func (c *compiler) pathItem(template string, v interface{}) (*pathItem, error) {
+	loc := "#/paths/" + escape(template)
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("%s: path must start with `/`", loc)
+	}
+	m, loc, err := c.resolve(v, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &pathItem{template: template, operations: map[string]*Operation{}}
+	pattern := "^"
+	last := 0
+	for _, match := range pathParameter.FindAllStringSubmatchIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:match[0]]) + "([^/]+)"
+		item.names = append(item.names, template[match[2]:match[3]])
+		item.literal += match[0] - last
+		last = match[1]
+	}
+	pattern += regexp.QuoteMeta(template[last:]) + "$"
+	item.literal += len(template) - last
+	item.re = regexp.MustCompile(pattern)
+
+	common, err := c.parameters(m, loc)
+	if err != nil {
+		return nil, err
+	}
+	for _, method := range methods {
+		v, ok := m[method]
+		if !ok {
+			continue
+		}
+		op, err := c.operation(strings.ToUpper(method), template, v, loc+"/"+method, common)
+		if err != nil {
+			return nil, err
+		}
+		item.operations[op.Method] = op
+	}
+	return item, nil
+}
+
+// operation compiles an operation, which inherits the parameters common to its path.
+func (c *compiler) operation(method string, template string, v interface{}, loc string, common []*parameter) (*Operation, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an object", loc)
+	}
+	op := &Operation{Method: method, Path: template}
+	op.ID, _ = m["operationId"].(string)
+
+	params, err := c.parameters(m, loc)
+	if err != nil {
+		return nil, err
+	}
+	op.parameters = params
+	// parameters of the operation override those of the path with the same name and location
+	for _, p := range common {
+		overridden := false
+		for _, q := range params {
+			if q.name == p.name && q.in == p.in {
+				overridden = true
+			}
+		}
+		if !overridden {
+			op.parameters = append(op.parameters, p)
+		}
+	}
+
+	if v, ok := m["requestBody"]; ok {
+		rb, rbLoc, err := c.resolve(v, loc+"/requestBody")
+		if err != nil {
+			return nil, err
+		}
+		op.body = &requestBody{}
+		op.body.required, _ = rb["required"].(bool)
+		if op.body.content, err = c.content(rb, rbLoc); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, ok := m["responses"]; ok {
+		responses, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/responses: must be an object", loc)
+		}
+		op.responses = map[string]content{}
+		for _, code := range sortedKeys(responses) {
+			resp, respLoc, err := c.resolve(responses[code], loc+"/responses/"+escape(code))
+			if err != nil {
+				return nil, err
+			}
+			if op.responses[strings.ToLower(code)], err = c.content(resp, respLoc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return op, nil
+}
+
+// parameters compiles the parameters of a path item or operation.
+func (c *compiler) parameters(m map[string]interface{}, loc string) ([]*parameter, error) {
+	v, ok := m["parameters"]
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s/parameters: must be an array", loc)
+	}
+
+	var params []*parameter
+	for i, e := range arr {
+		pm, pLoc, err := c.resolve(e, loc+"/parameters/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+
+		p := &parameter{}
+		p.name, _ = pm["name"].(string)
+		p.in, _ = pm["in"].(string)
+		if p.name == "" {
+			return nil, fmt.Errorf("%s/name: must be a non-empty string", pLoc)
+		}
+		switch p.in {
+		case "path", "query", "header", "cookie":
+		default:
+			return nil, fmt.Errorf("%s/in: must be one of 'path', 'query', 'header' or 'cookie'", pLoc)
+		}
+		p.required, _ = pm["required"].(bool)
+		if p.in == "path" {
+			p.required = true
+		}
+
+		// query and cookie parameters default to the exploded `form` style, others to `simple`
+		style, _ := pm["style"].(string)
+		explode, ok := pm["explode"].(bool)
+		if !ok {
+			explode = (p.in == "query" || p.in == "cookie") && (style == "" || style == "form")
+		}
+		p.explode = explode
+
+		if sv, ok := pm["schema"]; ok {
+			if p.schema, err = c.schemas.Compile(sv, pLoc+"/schema"); err != nil {
+				return nil, err
+			}
+			p.kind = c.kind(sv)
+			if p.kind == "array" {
+				if sm, _, err := c.resolve(sv, pLoc+"/schema"); err == nil {
+					p.itemKind = c.kind(sm["items"])
+				}
+			}
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// content compiles the schemas of the media types held by the `content` of a request body
+// or response.
+func (c *compiler) content(m map[string]interface{}, loc string) (content, error) {
+	v, ok := m["content"]
+	if !ok {
+		return nil, nil
+	}
+	media, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s/content: must be an object", loc)
+	}
+
+	ct := content{}
+	for _, name := range sortedKeys(media) {
+		mLoc := loc + "/content/" + escape(name)
+		mt, ok := media[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an object", mLoc)
+		}
+		mediaType, _, err := mime.ParseMediaType(name)
+		if err != nil {
+			mediaType = strings.ToLower(name)
+		}
+		var schema *jsonschema.Schema
+		if sv, ok := mt["schema"]; ok {
+			if schema, err = c.schemas.Compile(sv, mLoc+"/schema"); err != nil {
+				return nil, err
+			}
+		}
+		ct[mediaType] = schema
+	}
+	return ct, nil
+}
+
+// kind returns the type of the values a schema describes, ignoring `null`, or an empty string.
+func (c *compiler) kind(v interface{}) string {
+	m, _, err := c.resolve(v, "")
+	if err != nil {
+		return ""
+	}
+	switch t := m["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, e := range t {
+			if name, _ := e.(string); name != "null" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// resolve follows the `$ref`s of an object, if any, to the object they point to along with
+// its location.
+func (c *compiler) resolve(v interface{}, loc string) (map[string]interface{}, string, error) {
+	// references are followed a bounded number of times, so that cycles terminate
+	for i := 0; i < 32; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, loc, fmt.Errorf("%s: must be an object", loc)
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, loc, nil
+		}
+		if !strings.HasPrefix(ref, "#") {
+			return nil, loc, fmt.Errorf("%s: only local references are supported, got `%s`", loc, ref)
+		}
+		target, err := jsonschema.Pointer(c.root, ref)
+		if err != nil {
+			return nil, loc, fmt.Errorf("%s: %s", loc, err.Error())
+		}
+		v, loc = target, ref
+	}
+	return nil, loc, fmt.Errorf("%s: too many nested references", loc)
+}
+
+// escape escapes a key for use within a JSON pointer.
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// jsonValue converts a document decoded from YAML to its JSON equivalent, so that mappings
+// with keys that are not strings (e.g., unquoted status codes) become objects.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonValue(e)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonValue(e)
+		}
+	}
+	return v
+}
+
+// sortedKeys returns the keys of a map in order, so that descriptions compile deterministically.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]interface{}:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case content:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,275 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const description = `
+openapi: 3.0.3
+info:
+  title: Posts
+  version: "1.0"
+paths:
+  /posts:
+    get:
+      operationId: listPosts
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 1, maximum: 100}
+        - name: tag
+          in: query
+          schema: {type: array, items: {type: string, maxLength: 8}}
+        - name: draft
+          in: query
+          schema: {type: boolean}
+      responses:
+        200:
+          description: posts
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: '#/components/schemas/Post'}
+    post:
+      operationId: createPost
+      parameters:
+        - $ref: '#/components/parameters/ApiKey'
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/NewPost'}
+          text/*: {}
+      responses:
+        2XX:
+          description: created
+        default:
+          description: error
+  /posts/{id}:
+    parameters:
+      - name: id
+        in: path
+        schema: {type: integer}
+    get:
+      responses:
+        200:
+          description: post
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Post'}
+    delete:
+      responses:
+        204:
+          description: deleted
+  /posts/mine:
+    get:
+      responses:
+        200:
+          description: posts of the client
+components:
+  parameters:
+    ApiKey:
+      name: X-Api-Key
+      in: header
+      required: true
+      schema: {type: string, minLength: 4}
+  schemas:
+    NewPost:
+      type: object
+      required: [title]
+      properties:
+        title: {type: string}
+        rating: {type: number, minimum: 0, maximum: 5, exclusiveMaximum: true}
+        body: {type: string, nullable: true}
+    Post:
+      allOf:
+        - $ref: '#/components/schemas/NewPost'
+        - type: object
+          required: [id]
+          properties:
+            id: {type: integer}
+`
+
+// TestFind tests the Find method on Document
+func TestFind(t *testing.T) {
+	d, err := Parse([]byte(description))
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		method  string
+		path    string
+		op      string
+		params  map[string]string
+		allowed []string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "GET", path: "/posts", op: "`GET /posts`", params: map[string]string{}},
+		{method: "HEAD", path: "/posts", op: "`GET /posts`", params: map[string]string{}},
+		{method: "POST", path: "/posts", op: "`POST /posts`", params: map[string]string{}},
+		{method: "GET", path: "/posts/1", op: "`GET /posts/{id}`", params: map[string]string{"id": "1"}},
+		{method: "GET", path: "/posts/mine", op: "`GET /posts/mine`", params: map[string]string{}},
+		{method: "DELETE", path: "/posts/mine", allowed: []string{"GET", "HEAD"}},
+		{method: "PUT", path: "/posts/1", allowed: []string{"DELETE", "GET", "HEAD"}},
+		{method: "GET", path: "/posts/1/comments"},
+		{method: "GET", path: "/comments"},
+		{method: "GET", path: "/posts/"},
+	} {
+		t.Run(fmt.Sprintf("method=%s,path=%s", tCase.method, tCase.path), func(t *testing.T) {
+			op, params, allowed := d.Find(tCase.method, tCase.path)
+			if tCase.op == "" {
+				assert.Nil(t, op)
+			} else if assert.NotNil(t, op) {
+				assert.Equal(t, tCase.op, op.String())
+			}
+			assert.Equal(t, tCase.params, params)
+			assert.Equal(t, tCase.allowed, allowed)
+		})
+	}
+}
+
+// TestValidateRequest tests the ValidateRequest method on Operation
+func TestValidateRequest(t *testing.T) {
+	d, err := Parse([]byte(description))
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		method      string
+		target      string
+		contentType string
+		apiKey      string
+		body        string
+		status      int
+		violations  []string
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "GET", target: "/posts"},
+		{method: "GET", target: "/posts?limit=10&tag=go&tag=http&draft=false"},
+		{method: "GET", target: "/posts?limit=0", status: 400, violations: []string{"query.limit minimum"}},
+		{method: "GET", target: "/posts?limit=ten", status: 400, violations: []string{"query.limit type"}},
+		{method: "GET", target: "/posts?draft=yes", status: 400, violations: []string{"query.draft type"}},
+		{method: "GET", target: "/posts?tag=go&tag=toolongtag", status: 400, violations: []string{"query.tag[1] maxLength"}},
+		{method: "GET", target: "/posts/abc", status: 400, violations: []string{"path.id type"}},
+		{method: "GET", target: "/posts/12"},
+		{method: "POST", target: "/posts", contentType: "application/json", apiKey: "secret", body: `{"title": "a", "rating": 4.5, "body": null}`},
+		{method: "POST", target: "/posts", contentType: "application/json; charset=utf-8", apiKey: "secret", body: `{"title": "a"}`},
+		{method: "POST", target: "/posts", contentType: "text/plain", apiKey: "secret", body: `anything`},
+		{method: "POST", target: "/posts", contentType: "application/json", body: `{"title": "a"}`, status: 400, violations: []string{"header.X-Api-Key required"}},
+		{method: "POST", target: "/posts", contentType: "application/json", apiKey: "abc", body: `{"title": "a"}`, status: 400, violations: []string{"header.X-Api-Key minLength"}},
+		{method: "POST", target: "/posts", contentType: "application/json", apiKey: "secret", status: 400},
+		{method: "POST", target: "/posts", contentType: "application/json", apiKey: "secret", body: `{"title": `, status: 400},
+		{method: "POST", target: "/posts", contentType: "application/xml", apiKey: "secret", body: `<post/>`, status: 415},
+		{method: "POST", target: "/posts", contentType: "application/json", apiKey: "secret", body: `{"rating": 5, "body": 1}`, status: 422, violations: []string{"$ required", "$.body type", "$.rating exclusiveMaximum"}},
+	} {
+		t.Run(fmt.Sprintf("method=%s,target=%s,body=%s", tCase.method, tCase.target, tCase.body), func(t *testing.T) {
+			r := httptest.NewRequest(tCase.method, tCase.target, bytes.NewBufferString(tCase.body))
+			if tCase.contentType != "" {
+				r.Header.Set("Content-Type", tCase.contentType)
+			}
+			if tCase.apiKey != "" {
+				r.Header.Set("X-Api-Key", tCase.apiKey)
+			}
+
+			op, params, _ := d.Find(r.Method, r.URL.Path)
+			assert.NotNil(t, op)
+
+			err := op.ValidateRequest(r, params, []byte(tCase.body))
+			if tCase.status == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			if !assert.NotNil(t, err) {
+				return
+			}
+			assert.Equal(t, tCase.status, err.Status)
+			assert.NotEmpty(t, err.Error())
+
+			var got []string
+			for _, v := range err.Violations {
+				got = append(got, v.Path+" "+v.Keyword)
+			}
+			assert.Equal(t, tCase.violations, got)
+		})
+	}
+}
+
+// TestValidateResponse tests the ValidateResponse method on Operation
+func TestValidateResponse(t *testing.T) {
+	d, err := Parse([]byte(description))
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		method  string
+		path    string
+		status  int
+		body    string
+		invalid bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "GET", path: "/posts/1", status: 200, body: `{"id": 1, "title": "a"}`},
+		{method: "GET", path: "/posts/1", status: 200, body: `{"title": "a"}`, invalid: true},
+		{method: "GET", path: "/posts/1", status: 200, body: `not json`, invalid: true},
+		{method: "GET", path: "/posts/1", status: 404, body: `{}`, invalid: true},
+		{method: "GET", path: "/posts", status: 200, body: `[{"id": 1, "title": "a"}]`},
+		{method: "HEAD", path: "/posts", status: 200},
+		{method: "POST", path: "/posts", status: 201, body: `{"id": 1}`},
+		{method: "POST", path: "/posts", status: 500, body: `{}`},
+		{method: "DELETE", path: "/posts/1", status: 204},
+	} {
+		t.Run(fmt.Sprintf("method=%s,path=%s,status=%d", tCase.method, tCase.path, tCase.status), func(t *testing.T) {
+			op, _, _ := d.Find(tCase.method, tCase.path)
+			assert.NotNil(t, op)
+
+			err := op.ValidateResponse(tCase.status, "application/json", []byte(tCase.body))
+			if !tCase.invalid {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equal(t, 502, err.Status)
+			}
+		})
+	}
+}
+
+// TestParse tests that invalid descriptions are reported by Parse and Load
+func TestParse(t *testing.T) {
+	for _, doc := range []string{
+		`[]`,
+		`{"openapi": "2.0", "paths": {}}`,
+		`{"openapi": "3.0.0"}`,
+		`{"openapi": "3.0.0", "paths": {"posts": {}}}`,
+		`{"openapi": "3.0.0", "paths": {"/posts": {"get": {"parameters": [{"name": "a", "in": "body"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/posts": {"get": {"parameters": [{"$ref": "#/components/parameters/missing"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/posts": {"post": {"requestBody": {"content": {"application/json": {"schema": {"type": "text"}}}}}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/posts": {"get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/missing"}}}}}}}}}`,
+		"openapi: [3.0.0",
+	} {
+		_, err := Parse([]byte(doc))
+		assert.Error(t, err, doc)
+	}
+
+	// JSON descriptions are supported as well
+	d, err := Parse([]byte(`{"openapi": "3.1.0", "paths": {"/posts": {"get": {}}}}`))
+	assert.NoError(t, err)
+	op, _, _ := d.Find("GET", "/posts")
+	assert.NotNil(t, op)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openapi.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(description), 0644))
+	_, err = Load(path)
+	assert.NoError(t, err)
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,753 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expr defines a compiled expression, a small subset of the Common Expression Language (CEL):
+//   - literals: strings ('a' or "a"), numbers, `true`, `false`, `null` and lists (`['a', 'b']`)
+//   - variables, fields (`body.user.role`) and indexes (`headers['x-api-key']`, `body.items[0]`)
+//   - operators, by increasing precedence: `||`, `&&`, `==`, `!=`, `<`, `<=`, `>`, `>=`, `in`,
+//     `+`, `-`, `*`, `/`, `%`, and the unary `!` and `-`
+//   - functions: `size(x)`, and the string methods `startsWith`, `endsWith`, `contains`,
+//     `matches` (RE2 syntax), `lower`, `upper` and `inCIDR` (e.g., `client_ip.inCIDR('10.0.0.0/8')`)
+//
+// Missing fields, and fields of `null`, evaluate to `null` rather than to an error, and `null`
+// is false wherever a boolean is expected, so that `body.user.admin` holds for bodies lacking it.
+type Expr struct {
+	src  string
+	root node
+}
+
+// node defines a node of the syntax tree of an expression.
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+// Compile parses an expression, whose variables must be among the given names.
+func Compile(src string, names []string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, names: names}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected `%s` at offset %d", t.text, t.pos)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression with the given variables.
+func (e *Expr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return e.root.eval(vars)
+}
+
+// Bool evaluates the expression with the given variables, which must result in a boolean or `null`.
+func (e *Expr) Bool(vars map[string]interface{}) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return truth(v)
+}
+
+// token kinds
+const (
+	tokEOF = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+// token defines a lexical token of an expression.
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// punctuation lists the operators and delimiters of expressions, longest first.
+var punctuation = []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", "[", "]", ",", ".", "!", "<", ">", "+", "-", "*", "/", "%"}
+
+// lex splits an expression into tokens.
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+next:
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] == '.' || (src[i] >= '0' && src[i] <= '9')) {
+				i++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], pos: start})
+		case c == '\'' || c == '"':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at offset %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+					continue
+				}
+				b.WriteByte(src[i])
+			}
+			toks = append(toks, token{kind: tokString, text: b.String(), pos: start})
+		default:
+			for _, p := range punctuation {
+				if strings.HasPrefix(src[i:], p) {
+					toks = append(toks, token{kind: tokPunct, text: p, pos: i})
+					i += len(p)
+					continue next
+				}
+			}
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("unexpected character %q at offset %d", r, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+// parser parses the tokens of an expression by recursive descent.
+type parser struct {
+	toks  []token
+	pos   int
+	names []string
+}
+
+// peek returns the current token.
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+// accept consumes the current token if it is the given punctuation, or keyword.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the current token, which must be the given punctuation.
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return fmt.Errorf("expected `%s` at offset %d, found `%s`", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var r node
+		if r, err = p.parseAnd(); err == nil {
+			l = &logical{and: false, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseComparison()
+	for err == nil && p.accept("&&") {
+		var r node
+		if r, err = p.parseComparison(); err == nil {
+			l = &logical{and: true, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binary{op: op, l: l, r: r}, nil
+		}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	l, err := p.parseMultiplicative()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != tokPunct || (op != "+" && op != "-") {
+			break
+		}
+		p.pos++
+		var r node
+		if r, err = p.parseMultiplicative(); err == nil {
+			l = &binary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	l, err := p.parseUnary()
+	for err == nil {
+		op := p.peek().text
+		if p.peek().kind != tokPunct || (op != "*" && op != "/" && op != "%") {
+			break
+		}
+		p.pos++
+		var r node
+		if r, err = p.parseUnary(); err == nil {
+			l = &binary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &unary{op: op, x: x}, nil
+		}
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	x, err := p.parsePrimary()
+	for err == nil {
+		switch {
+		case p.accept("."):
+			t := p.peek()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected a field or method at offset %d, found `%s`", t.pos, t.text)
+			}
+			p.pos++
+			if p.accept("(") {
+				var args []node
+				if args, err = p.parseArgs(")"); err == nil {
+					x, err = newCall(t, x, args)
+				}
+				continue
+			}
+			x = &index{x: x, key: &literal{v: t.text}}
+		case p.accept("["):
+			var key node
+			if key, err = p.parseOr(); err == nil {
+				err = p.expect("]")
+			}
+			x = &index{x: x, key: key}
+		default:
+			return x, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number `%s` at offset %d", t.text, t.pos)
+		}
+		return &literal{v: f}, nil
+	case tokString:
+		return &literal{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literal{v: true}, nil
+		case "false":
+			return &literal{v: false}, nil
+		case "null":
+			return &literal{v: nil}, nil
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			return newCall(t, nil, args)
+		}
+		for _, name := range p.names {
+			if name == t.text {
+				return &variable{name: t.text}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown variable `%s` at offset %d, must be one of '%s'", t.text, t.pos, strings.Join(p.names, "', '"))
+	case tokPunct:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			elems, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &list{elems: elems}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected `%s` at offset %d", t.text, t.pos)
+}
+
+// parseArgs parses a comma-separated list of expressions, up to the given closing punctuation.
+func (p *parser) parseArgs(end string) ([]node, error) {
+	var args []node
+	if p.accept(end) {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(end) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// literal defines a constant.
+type literal struct {
+	v interface{}
+}
+
+func (n *literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.v, nil
+}
+
+// variable defines a reference to a variable.
+type variable struct {
+	name string
+}
+
+func (n *variable) eval(vars map[string]interface{}) (interface{}, error) {
+	return vars[n.name], nil
+}
+
+// list defines a list of expressions.
+type list struct {
+	elems []node
+}
+
+func (n *list) eval(vars map[string]interface{}) (interface{}, error) {
+	l := make([]interface{}, len(n.elems))
+	for i, e := range n.elems {
+		v, err := e.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		l[i] = v
+	}
+	return l, nil
+}
+
+// index defines a field of a map, or an element of a list.
+type index struct {
+	x, key node
+}
+
+func (n *index) eval(vars map[string]interface{}) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch c := x.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("fields must be strings, not %s", typeOf(key))
+		}
+		return c[k], nil
+	case []interface{}:
+		f, ok := key.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("indexes must be integers, not %s", typeOf(key))
+		}
+		if f < 0 || int(f) >= len(c) {
+			return nil, nil
+		}
+		return c[int(f)], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeOf(x))
+}
+
+// unary defines the negation of a boolean or a number.
+type unary struct {
+	op string
+	x  node
+}
+
+func (n *unary) eval(vars map[string]interface{}) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, err := truth(x)
+		return !b, err
+	}
+	f, ok := x.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", typeOf(x))
+	}
+	return -f, nil
+}
+
+// logical defines the short-circuit conjunction, or disjunction, of two booleans.
+type logical struct {
+	and  bool
+	l, r node
+}
+
+func (n *logical) eval(vars map[string]interface{}) (interface{}, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := truth(l)
+	if err != nil || lb != n.and {
+		return lb, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return truth(r)
+}
+
+// binary defines comparisons and arithmetic.
+type binary struct {
+	op   string
+	l, r node
+}
+
+func (n *binary) eval(vars map[string]interface{}) (interface{}, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "in":
+		switch c := r.(type) {
+		case []interface{}:
+			for _, e := range c {
+				if reflect.DeepEqual(l, e) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			k, ok := l.(string)
+			_, found := c[k]
+			return ok && found, nil
+		case string:
+			s, ok := l.(string)
+			return ok && strings.Contains(c, s), nil
+		case nil:
+			return false, nil
+		}
+		return nil, fmt.Errorf("cannot look for a value in %s", typeOf(r))
+	}
+
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply `%s` to string and %s", n.op, typeOf(r))
+		}
+		switch n.op {
+		case "+":
+			return ls + rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+		return nil, fmt.Errorf("cannot apply `%s` to strings", n.op)
+	}
+	if ll, ok := l.([]interface{}); ok && n.op == "+" {
+		rl, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot apply `+` to list and %s", typeOf(r))
+		}
+		return append(append([]interface{}{}, ll...), rl...), nil
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply `%s` to %s and %s", n.op, typeOf(l), typeOf(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/", "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if n.op == "%" {
+			return math.Mod(lf, rf), nil
+		}
+		return lf / rf, nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	}
+	return lf >= rf, nil
+}
+
+// call defines a call of a function, or of a method of recv.
+type call struct {
+	name string
+	recv node
+	args []node
+	re   *regexp.Regexp // pattern of `matches` calls with a literal argument
+}
+
+// methods lists the string methods and the number of their arguments.
+var methods = map[string]int{
+	"startsWith": 1,
+	"endsWith":   1,
+	"contains":   1,
+	"matches":    1,
+	"lower":      0,
+	"upper":      0,
+	"inCIDR":     1,
+	"size":       0,
+}
+
+// newCall checks and returns the call of the function, or method, named by t.
+func newCall(t token, recv node, args []node) (node, error) {
+	c := &call{name: t.text, recv: recv, args: args}
+	if recv == nil {
+		if t.text != "size" || len(args) != 1 {
+			return nil, fmt.Errorf("unknown function `%s` at offset %d, only `size(x)` is supported", t.text, t.pos)
+		}
+		c.recv, c.args = args[0], nil
+		return c, nil
+	}
+
+	n, ok := methods[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown method `%s` at offset %d", t.text, t.pos)
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("method `%s` at offset %d takes %d argument(s)", t.text, t.pos, n)
+	}
+	if lit, ok := firstArg(args).(*literal); ok {
+		s, _ := lit.v.(string)
+		switch t.text {
+		case "matches":
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern at offset %d: %s", t.pos, err.Error())
+			}
+			c.re = re
+		case "inCIDR":
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return nil, fmt.Errorf("invalid CIDR block at offset %d: %s", t.pos, err.Error())
+			}
+		}
+	}
+	return c, nil
+}
+
+// firstArg returns the first argument, if any.
+func firstArg(args []node) node {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
+
+func (n *call) eval(vars map[string]interface{}) (interface{}, error) {
+	recv, err := n.recv.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	for _, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	if n.name == "size" {
+		switch c := recv.(type) {
+		case string:
+			return float64(utf8.RuneCountInString(c)), nil
+		case []interface{}:
+			return float64(len(c)), nil
+		case map[string]interface{}:
+			return float64(len(c)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("cannot take the size of %s", typeOf(recv))
+	}
+
+	if recv == nil {
+		if n.name == "lower" || n.name == "upper" {
+			return nil, nil
+		}
+		return false, nil
+	}
+	s, ok := recv.(string)
+	if !ok {
+		return nil, fmt.Errorf("method `%s` applies to strings, not %s", n.name, typeOf(recv))
+	}
+	switch n.name {
+	case "lower":
+		return strings.ToLower(s), nil
+	case "upper":
+		return strings.ToUpper(s), nil
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("the argument of method `%s` must be a string, not %s", n.name, typeOf(args[0]))
+	}
+	switch n.name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "matches":
+		re := n.re
+		if re == nil {
+			if re, err = regexp.Compile(arg); err != nil {
+				return nil, err
+			}
+		}
+		return re.MatchString(s), nil
+	}
+	// inCIDR
+	_, block, err := net.ParseCIDR(arg)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(s)
+	return ip != nil && block.Contains(ip), nil
+}
+
+// truth returns the boolean value of v, `null` being false.
+func truth(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected a boolean, not %s", typeOf(v))
+}
+
+// typeOf returns the name of the type of a value.
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
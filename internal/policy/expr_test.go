@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpr tests the Eval method on Expr
+func TestExpr(t *testing.T) {
+	vars := map[string]interface{}{
+		"method":    "POST",
+		"path":      "/admin/users",
+		"headers":   map[string]interface{}{"x-api-key": "k1", "content-type": "application/json"},
+		"client_ip": "10.1.2.3",
+		"body": map[string]interface{}{
+			"user":  map[string]interface{}{"role": "admin", "age": float64(42)},
+			"items": []interface{}{"a", "b", "c"},
+		},
+		"unverified_claims": nil,
+	}
+
+	type unitTestCase struct {
+		expr     string
+		expected interface{}
+		err      bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		// literals and operators
+		{expr: `1 + 2 * 3`, expected: float64(7)},
+		{expr: `(1 + 2) * 3 % 4`, expected: float64(1)},
+		{expr: `-2 - -3`, expected: float64(1)},
+		{expr: `'a' + "b"`, expected: "ab"},
+		{expr: `'it\'s'`, expected: "it's"},
+		{expr: `[1, 'a'] + [null]`, expected: []interface{}{float64(1), "a", nil}},
+		{expr: `!true || false && true`, expected: false},
+		{expr: `1 < 2 && 'a' <= 'b' && 3 >= 3 && 4 > 3.5`, expected: true},
+		// variables, fields and indexes
+		{expr: `method == 'POST' && path.startsWith('/admin')`, expected: true},
+		{expr: `headers['x-api-key'] in ['k1', 'k2']`, expected: true},
+		{expr: `body.user.role == 'admin' && body.user.age >= 18`, expected: true},
+		{expr: `body.items[1]`, expected: "b"},
+		{expr: `body.items[5]`, expected: nil},
+		{expr: `'role' in body.user`, expected: true},
+		{expr: `'min' in body.user.role`, expected: true},
+		// missing fields, and fields of null, are null
+		{expr: `body.missing.deeper`, expected: nil},
+		{expr: `unverified_claims.sub == 'jane'`, expected: false},
+		{expr: `!body.user.banned`, expected: true},
+		{expr: `'x' in unverified_claims`, expected: false},
+		// functions and methods
+		{expr: `size(body.items) == 3 && body.items.size() == 3 && size('hé') == 2`, expected: true},
+		{expr: `size(unverified_claims)`, expected: float64(0)},
+		{expr: `path.endsWith('users') && path.contains('min/') && path.matches('^/admin/[a-z]+$')`, expected: true},
+		{expr: `method.lower() + headers['x-api-key'].upper()`, expected: "postK1"},
+		{expr: `client_ip.inCIDR('10.0.0.0/8') && !client_ip.inCIDR('192.168.0.0/16')`, expected: true},
+		{expr: `path.matches('^/' + 'admin')`, expected: true},
+		// type errors
+		{expr: `body.user.age + 'a'`, err: true},
+		{expr: `body.user.role - 1`, err: true},
+		{expr: `1 / 0`, err: true},
+		{expr: `body.items['a']`, err: true},
+		{expr: `method && true`, err: true},
+		{expr: `method.startsWith(1)`, err: true},
+		{expr: `body.user.age.lower()`, err: true},
+	} {
+		t.Run(fmt.Sprintf("expr=%s", tCase.expr), func(t *testing.T) {
+			e, err := Compile(tCase.expr, Variables)
+			assert.NoError(t, err)
+
+			v, err := e.Eval(vars)
+			if tCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tCase.expected, v)
+		})
+	}
+}
+
+// TestCompile tests that Compile rejects invalid expressions
+func TestCompile(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`method ==`,
+		`(method`,
+		`'unterminated`,
+		`method # 1`,
+		`user == 'jane'`,
+		`exists(body)`,
+		`path.trim()`,
+		`path.startsWith()`,
+		`path.matches('(')`,
+		`client_ip.inCIDR('10.0.0.0')`,
+		`method == 'GET' method`,
+		`1.2.3`,
+	} {
+		_, err := Compile(expr, Variables)
+		assert.Error(t, err, expr)
+	}
+}
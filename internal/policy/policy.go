@@ -0,0 +1,241 @@
+// Package policy admits, denies, tags or routes requests according to rules written as
+// expressions over the method, path, headers, query, client IP, JSON body and unverified
+// auth claims of requests.
+package policy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Actions of policy rules.
+const (
+	ActionAllow = "allow" // admits the request without evaluating the following rules
+	ActionDeny  = "deny"  // rejects the request
+	ActionTag   = "tag"   // adds a header naming the rule to the request and evaluates the following rules
+	ActionRoute = "route" // forwards the request to another backend service
+)
+
+// What happens when the expression of a rule cannot be evaluated.
+const (
+	OnErrorDeny = "deny" // rejects the request, whatever the action of the rule
+	OnErrorSkip = "skip" // deems the rule not to match
+)
+
+// DefaultTagHeader is added to requests matched by rules with the `tag` action that do not set one.
+const DefaultTagHeader = "X-Proxy-Policy-Match"
+
+// Variables lists the variables expressions may reference:
+//   - `method`: method of the request (e.g., `POST`)
+//   - `path`: path of the request (e.g., `/posts/1`)
+//   - `headers`: first value of each header, by lower case name (e.g., `headers['x-api-key']`)
+//   - `query`: first value of each query parameter, by name
+//   - `client_ip`: IP address of the client
+//   - `body`: JSON body of the request, `null` when it is empty or not JSON
+//   - `unverified_claims`: claims of the JWT bearer token of the `Authorization` header, `null`
+//     when there is none. The signature of the token is NOT verified, so any client can forge
+//     them: they must not be used to allow requests, unless a gateway in front of the proxy
+//     verifies tokens.
+var Variables = []string{"method", "path", "headers", "query", "client_ip", "body", "unverified_claims"}
+
+// Rule defines a condition on requests and the action taken on the requests meeting it.
+type Rule struct {
+	Name    string `json:"name"`     // name of the rule reported to clients and in logs
+	When    string `json:"when"`     // expression that must hold for the action to be taken
+	Action  string `json:"action"`   // what happens to matching requests: 'allow', 'deny', 'tag' or 'route', defaults to 'deny'
+	Status  int    `json:"status"`   // status requests denied by the rule are answered with, defaults to that of denied requests
+	Header  string `json:"header"`   // header added to requests by the 'tag' action, defaults to `X-Proxy-Policy-Match`
+	Target  string `json:"target"`   // URL of the backend service requests are forwarded to by the 'route' action
+	DryRun  bool   `json:"dry_run"`  // whether matches are only reported, so that the rule can be measured before it is enforced
+	OnError string `json:"on_error"` // what happens when the expression cannot be evaluated: 'deny' or 'skip', defaults to 'deny'
+
+	expr *Expr
+}
+
+// Policy defines an ordered list of rules.
+type Policy struct {
+	rules []Rule
+}
+
+// Decision defines the outcome of evaluating a policy against a request.
+type Decision struct {
+	Rule   *Rule   // rule with the `allow`, `deny` or `route` action that decided, nil when none matched
+	Failed bool    // whether Rule could not be evaluated, in which case the request is denied whatever its action
+	Tags   []Rule  // rules with the `tag` action that matched
+	DryRun []Rule  // rules in dry-run mode that matched, whatever their action
+	Errors []error // errors of the rules that could not be evaluated
+}
+
+// New compiles the expressions of the rules and returns the policy they form.
+func New(rules []Rule) (*Policy, error) {
+	p := &Policy{rules: make([]Rule, len(rules))}
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d: a name is required", i)
+		}
+		switch r.Action {
+		case "":
+			r.Action = ActionDeny
+		case ActionAllow, ActionDeny, ActionTag, ActionRoute:
+		default:
+			return nil, fmt.Errorf("rule `%s`: invalid action %q must be one of 'allow', 'deny', 'tag' or 'route'", r.Name, r.Action)
+		}
+		switch r.OnError {
+		case "":
+			r.OnError = OnErrorDeny
+		case OnErrorDeny, OnErrorSkip:
+		default:
+			return nil, fmt.Errorf("rule `%s`: invalid on_error %q must be one of 'deny' or 'skip'", r.Name, r.OnError)
+		}
+		if r.Action == ActionTag && r.Header == "" {
+			r.Header = DefaultTagHeader
+		}
+		if r.Status != 0 && (r.Status < 400 || r.Status > 599) {
+			return nil, fmt.Errorf("rule `%s`: invalid status %d must be between 400 and 599", r.Name, r.Status)
+		}
+		if r.Action == ActionRoute {
+			u, err := url.Parse(r.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("rule `%s`: the target of the 'route' action must be an http(s) URL", r.Name)
+			}
+		}
+
+		expr, err := Compile(r.When, Variables)
+		if err != nil {
+			return nil, fmt.Errorf("rule `%s`: %s", r.Name, err.Error())
+		}
+		r.expr = expr
+		p.rules[i] = r
+	}
+	return p, nil
+}
+
+// Load reads a JSON array of rules from the given file and compiles them.
+func Load(filename string) (*Policy, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(buf, &rules); err != nil {
+		return nil, err
+	}
+	return New(rules)
+}
+
+// Len returns the number of rules of the policy.
+func (p *Policy) Len() int {
+	return len(p.rules)
+}
+
+// TagHeaders returns the headers set by the rules with the `tag` action, which are removed from
+// requests before the policy is evaluated so that clients cannot forge the tags.
+func (p *Policy) TagHeaders() []string {
+	var headers []string
+	seen := map[string]bool{}
+	for _, r := range p.rules {
+		h := http.CanonicalHeaderKey(r.Header)
+		if r.Action != ActionTag || seen[h] {
+			continue
+		}
+		seen[h] = true
+		headers = append(headers, h)
+	}
+	return headers
+}
+
+// Evaluate evaluates the rules, in order, against the request sent by the client at clientIP
+// with the given body. Rules with the `tag` action, and rules in dry-run mode, are collected, and
+// evaluation stops at the first matching rule with any other action. A rule that cannot be
+// evaluated stops it as well, so that the request is denied, unless the rule is in dry-run mode
+// or its errors are skipped.
+func (p *Policy) Evaluate(r *http.Request, clientIP string, body []byte) Decision {
+	var d Decision
+	vars := variables(r, clientIP, body)
+	for i := range p.rules {
+		rule := &p.rules[i]
+		ok, err := rule.expr.Bool(vars)
+		if err != nil {
+			d.Errors = append(d.Errors, fmt.Errorf("rule `%s`: %s", rule.Name, err.Error()))
+			if rule.DryRun || rule.OnError == OnErrorSkip {
+				continue
+			}
+			d.Rule = rule
+			d.Failed = true
+			break
+		}
+		if !ok {
+			continue
+		}
+		if rule.DryRun {
+			d.DryRun = append(d.DryRun, *rule)
+			continue
+		}
+		if rule.Action == ActionTag {
+			d.Tags = append(d.Tags, *rule)
+			continue
+		}
+		d.Rule = rule
+		break
+	}
+	return d
+}
+
+// variables returns the variables of expressions for the request.
+func variables(r *http.Request, clientIP string, body []byte) map[string]interface{} {
+	headers := map[string]interface{}{}
+	for k, v := range r.Header {
+		if len(v) > 0 {
+			headers[strings.ToLower(k)] = v[0]
+		}
+	}
+	query := map[string]interface{}{}
+	for k, v := range r.URL.Query() {
+		if len(v) > 0 {
+			query[k] = v[0]
+		}
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		doc = nil
+	}
+
+	return map[string]interface{}{
+		"method":            r.Method,
+		"path":              r.URL.Path,
+		"headers":           headers,
+		"query":             query,
+		"client_ip":         clientIP,
+		"body":              doc,
+		"unverified_claims": unverifiedClaims(r.Header.Get("Authorization")),
+	}
+}
+
+// unverifiedClaims returns the claims of the JWT bearer token of an `Authorization` header, or nil.
+// The signature of the token is not verified.
+func unverifiedClaims(authorization string) interface{} {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSpace(authorization[len(prefix):]), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEvaluate tests the Evaluate method on Policy
+func TestEvaluate(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "large", When: `size(body.items) > 2`, Action: ActionTag},
+		{Name: "trial", When: `path == '/trial'`, DryRun: true},
+		{Name: "beta", When: `headers['x-beta'] == 'true' || unverified_claims.beta == true`, Action: ActionRoute, Target: "http://beta.internal:8080"},
+		{Name: "internal", When: `client_ip.inCIDR('10.0.0.0/8')`, Action: ActionAllow},
+		{Name: "admins", When: `path.startsWith('/admin')`, Status: 403},
+		{Name: "broken", When: `body.count + 1 > 2`, OnError: OnErrorSkip},
+		{Name: "strict", When: `body.count * 2 > 2`},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, p.Len())
+
+	token := "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"beta": true}`)) + ".sig"
+
+	type unitTestCase struct {
+		name     string
+		path     string
+		headers  map[string]string
+		clientIP string
+		body     string
+		rule     string
+		failed   bool
+		tags     []string
+		dryRun   []string
+		errors   int
+	}
+
+	for _, tCase := range []unitTestCase{
+		{name: "no rule matches", path: "/posts", body: `{"count": 1}`},
+		{name: "tagged", path: "/posts", body: `{"items": [1, 2, 3], "count": 1}`, tags: []string{"large"}},
+		{name: "routed", path: "/posts", headers: map[string]string{"X-Beta": "true"}, body: `{"items": [1, 2, 3]}`, rule: "beta", tags: []string{"large"}},
+		{name: "allowed", path: "/admin", clientIP: "10.0.0.1", rule: "internal"},
+		{name: "denied", path: "/admin/users", clientIP: "192.168.0.1", rule: "admins"},
+		// rules in dry-run mode do not stop the evaluation
+		{name: "dry run", path: "/trial", clientIP: "10.0.0.1", rule: "internal", dryRun: []string{"trial"}},
+		{name: "claims", path: "/posts", headers: map[string]string{"Authorization": "Bearer " + token}, body: `{"count": 1}`, rule: "beta"},
+		// rules that cannot be evaluated deny the request, unless their errors are skipped
+		{name: "error", path: "/posts", body: `{"count": "one"}`, rule: "strict", failed: true, errors: 2},
+		{name: "not json", path: "/posts", body: `not json`, rule: "strict", failed: true, errors: 2},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tCase.path, strings.NewReader(tCase.body))
+			for k, v := range tCase.headers {
+				r.Header.Set(k, v)
+			}
+
+			d := p.Evaluate(r, tCase.clientIP, []byte(tCase.body))
+			if tCase.rule == "" {
+				assert.Nil(t, d.Rule)
+			} else if assert.NotNil(t, d.Rule) {
+				assert.Equal(t, tCase.rule, d.Rule.Name)
+			}
+			assert.Equal(t, tCase.failed, d.Failed)
+			var tags []string
+			for _, rule := range d.Tags {
+				tags = append(tags, rule.Name)
+				assert.Equal(t, DefaultTagHeader, rule.Header)
+			}
+			assert.Equal(t, tCase.tags, tags)
+			var dryRun []string
+			for _, rule := range d.DryRun {
+				dryRun = append(dryRun, rule.Name)
+			}
+			assert.Equal(t, tCase.dryRun, dryRun)
+			assert.Len(t, d.Errors, tCase.errors)
+		})
+	}
+}
+
+// TestNew tests that New rejects invalid rules
+func TestNew(t *testing.T) {
+	for _, rule := range []Rule{
+		{When: `true`},
+		{Name: "a", When: `true`, Action: "quarantine"},
+		{Name: "a", When: `true`, Status: 302},
+		{Name: "a", When: `true`, Action: ActionRoute},
+		{Name: "a", When: `true`, Action: ActionRoute, Target: "ftp://backend"},
+		{Name: "a", When: `true`, OnError: "allow"},
+		{Name: "a", When: `user == 1`},
+		{Name: "a"},
+	} {
+		_, err := New([]Rule{rule})
+		assert.Error(t, err, rule.Name+": "+rule.When)
+	}
+}
+
+// TestLoad tests the Load function
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "policy.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name": "no-delete", "when": "method == 'DELETE'"}]`), 0644))
+	p, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.Len())
+	assert.Equal(t, ActionDeny, p.rules[0].Action)
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"name": "a"}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package proxyserver
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"go.uber.org/zap"
+)
+
+// WithBlocklist enables the rules of the filter returned by blocklist, which is called for
+// every request so that reloaded rules take effect without a restart.
+func (s *ProxyServer) WithBlocklist(blocklist func() *filter.Filter) *ProxyServer {
+	s.blocklist = blocklist
+	return s
+}
+
+// WithRejectIn sets the parts of requests checked for the `rejectWith` phrase: any of the
+// `path`, the decoded `query` values, the `headers` (only those named by headers, when set) and
+// the `body`, which alone is checked by default. It must be set before WithRejectAction.
+func (s *ProxyServer) WithRejectIn(parts []string, headers []string) *ProxyServer {
+	s.rejectIn = parts
+	s.rejectHeaders = headers
+	return s
+}
+
+// WithRejectAction sets what happens to requests containing the `rejectWith` phrase: they are
+// rejected by default, but may have the phrase masked with replacement, have the JSON fields
+// holding it dropped, or be tagged with a header instead. The phrase is normalized by the
+// normalizer, and checked against the parts of requests, set beforehand with WithNormalizer
+// and WithRejectIn.
+func (s *ProxyServer) WithRejectAction(action string, replacement string) *ProxyServer {
+	s.rejectAction = action
+	s.rejectReplacement = replacement
+	s.compileRejectValues()
+	s.rejectFilter = nil
+	bodyOnly := len(s.rejectHeaders) == 0 && (len(s.rejectIn) == 0 || (len(s.rejectIn) == 1 && s.rejectIn[0] == filter.PartBody))
+	if (action == "" || action == filter.ActionReject) && bodyOnly || s.rejectWith == "" {
+		return s
+	}
+
+	f, err := filter.New([]filter.Rule{{
+		Phrase:      s.rejectWith,
+		Exact:       s.rejectExact,
+		Insensitive: s.rejectInsensitive,
+		Action:      action,
+		Replacement: replacement,
+		In:          s.rejectIn,
+		Headers:     s.rejectHeaders,
+	}}, s.normalizer)
+	if err != nil {
+		s.logger.Error("invalid reject action", zap.Error(err))
+		return s
+	}
+	s.rejectFilter = f
+	return s
+}
+
+// compileRejectValues compiles the filter checking the values of JSON bodies for the
+// `rejectWith` phrase, once they are parsed, in addition to the raw body. Phrases escaped within
+// JSON strings (e.g., `\u0062ad`) only appear once the body is parsed.
+func (s *ProxyServer) compileRejectValues() {
+	s.rejectValues = nil
+	if s.rejectWith == "" {
+		return
+	}
+	body := len(s.rejectIn) == 0
+	for _, part := range s.rejectIn {
+		body = body || part == filter.PartBody
+	}
+	if !body {
+		return
+	}
+
+	f, err := filter.New([]filter.Rule{{
+		Phrase:      s.rejectWith,
+		Exact:       s.rejectExact,
+		Insensitive: s.rejectInsensitive,
+		Action:      s.rejectAction,
+		Replacement: s.rejectReplacement,
+		Scope:       filter.ScopeValues,
+	}}, s.normalizer)
+	if err != nil {
+		s.logger.Error("invalid reject action", zap.Error(err))
+		return
+	}
+	s.rejectValues = f
+}
+
+// checkBlocklist checks the request body against the rules of the blocklist and returns the
+// body to forward. Please refer to the `applyRules` method for what each action does.
+func (s *ProxyServer) checkBlocklist(r *http.Request, b string) (string, error) {
+	return s.applyRules(r, s.blocklist(), CheckBlocklist, b)
+}
+
+// applyRules applies the actions of the rules of the filter matched by the request, whose body
+// is b, and returns the body to forward. Matches of rules with the `log` action are logged and
+// those with the `tag` action add a header naming the rule to the request. The first match of a
+// rule with the `reject` action is returned as an error naming the rule, or its phrase when it
+// has none, along with where it was matched.
+// Rules with the `mask` or `drop` action rewrite the body, which is rejected in the same way if
+// it still matches one of them once rewritten. The actions of rules in dry-run mode, or of every
+// rule when the check runs in dry-run mode, are only logged and counted.
+func (s *ProxyServer) applyRules(r *http.Request, f *filter.Filter, check string, b string) (string, error) {
+	rewrite := false
+	for _, m := range f.MatchRequest(r, b) {
+		rule := m.Rule
+		if rule.Action != filter.ActionLog && s.shadowed(r, check, rule.Label(), rule.DryRun, rule.Action) {
+			continue
+		}
+		switch rule.Action {
+		case filter.ActionLog:
+			s.logger.Info("blocklist rule matched", zap.String("rule", rule.Label()), zap.String("in", m.Where()))
+		case filter.ActionTag:
+			s.logger.Info("blocklist rule matched, tagging request", zap.String("rule", rule.Label()), zap.String("in", m.Where()))
+			if !containsValue(r.Header.Values(rule.Header), rule.Label()) {
+				r.Header.Add(rule.Header, rule.Label())
+			}
+		case filter.ActionMask, filter.ActionDrop:
+			s.logger.Info("blocklist rule matched, rewriting request", zap.String("rule", rule.Label()), zap.String("in", m.Where()))
+			rewrite = true
+		default:
+			s.logger.Info("blocklist rule matched, rejecting request", zap.String("rule", rule.Label()), zap.String("in", m.Where()))
+			return "", rejection(m)
+		}
+	}
+	if !rewrite {
+		return b, nil
+	}
+
+	rewritten, err := f.Rewrite(b)
+	if err != nil {
+		s.logger.Info("unable to rewrite request, rejecting request", zap.Error(err))
+		return "", errors.New("rejected because the request body could not be rewritten: " + err.Error())
+	}
+	// the matched text must never be forwarded, even when it cannot be rewritten away
+	for _, rule := range f.Match(rewritten) {
+		if (rule.Action == filter.ActionMask || rule.Action == filter.ActionDrop) && !rule.DryRun {
+			s.logger.Info("blocklist rule still matched once rewritten, rejecting request", zap.String("rule", rule.Label()))
+			return "", rejection(filter.Match{Rule: rule, Part: filter.PartBody})
+		}
+	}
+	metrics.Add("rewritten_requests", 1)
+	return rewritten, nil
+}
+
+// rejection returns the error rejecting a request matched by a rule, naming where it matched.
+func rejection(m filter.Match) error {
+	msg := "rejected because `" + m.Rule.Phrase + "` found within " + m.Where()
+	if m.Rule.Name != "" {
+		msg = "rejected by rule `" + m.Rule.Name + "` matched within " + m.Where()
+	}
+	return &ruleError{rule: m.Rule.Label(), status: m.Rule.Status, msg: msg}
+}
+
+// containsValue reports whether the values of a header include v.
+func containsValue(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceBody replaces the body of the request, which was read as old, when it has been
+// rewritten, recomputing its Content-Length. It returns the body as it is now.
+func replaceBody(r *http.Request, old []byte, body string) []byte {
+	if body == string(old) {
+		return old
+	}
+	r.Body = ioutil.NopCloser(strings.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Length")
+	return []byte(body)
+}
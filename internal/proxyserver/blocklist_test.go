@@ -0,0 +1,236 @@
+package proxyserver
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestBlocklist tests the ServeHTTP method on ProxyServer with a blocklist
+func TestBlocklist(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	f, err := filter.New([]filter.Rule{
+		{Phrase: "bad_message", Exact: true},
+		{Phrase: "SUSPICIOUS", Insensitive: true, Action: filter.ActionLog},
+		{Name: "card-number", Pattern: `\b\d{4}( ?\d{4}){3}\b`},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	current := f
+
+	s := newDuplicateTestServer(t, &hits, 0).
+		WithBlocklist(func() *filter.Filter { return current })
+
+	w := servePost(ctx, s, `{"body": "bad_message"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected because `+"`bad_message`"+` found within request body"}`, w.Body.String())
+
+	w = servePost(ctx, s, `{"card": "4111 1111 1111 1111"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected by rule `+"`card-number`"+` matched within request body"}`, w.Body.String())
+
+	assert.Equal(t, 200, servePost(ctx, s, `{"body": "bad_messages"}`).Code)
+	assert.Equal(t, 200, servePost(ctx, s, `{"body": "suspicious"}`).Code)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	// reloaded rules take effect for the next request
+	current, err = filter.New([]filter.Rule{{Phrase: "suspicious"}}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 401, servePost(ctx, s, `{"body": "suspicious"}`).Code)
+	assert.Equal(t, 200, servePost(ctx, s, `{"body": "bad_message"}`).Code)
+}
+
+// newEchoTestServer creates a server whose backend responds with the body, Content-Length and
+// `X-Proxy-Filter-Match` header of the requests it receives.
+func newEchoTestServer(t *testing.T, hits *int32) *ProxyServer {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		buf, _ := json.Marshal(map[string]string{
+			"body":   string(body),
+			"length": strconv.FormatInt(r.ContentLength, 10),
+			"tag":    r.Header.Get(filter.DefaultTagHeader),
+		})
+		w.Write(buf)
+	}))
+	t.Cleanup(backend.Close)
+	return NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop())
+}
+
+// TestBlocklistActions tests the ServeHTTP method on ProxyServer with rules rewriting or tagging requests
+func TestBlocklistActions(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	f, err := filter.New([]filter.Rule{
+		{Phrase: "bad_message", Action: filter.ActionMask},
+		{Phrase: "secret", Action: filter.ActionDrop},
+		{Name: "suspicious", Phrase: "suspicious", Action: filter.ActionTag},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	s := newEchoTestServer(t, &hits).WithBlocklist(func() *filter.Filter { return f })
+
+	type echo struct {
+		Body   string `json:"body"`
+		Length string `json:"length"`
+		Tag    string `json:"tag"`
+	}
+	send := func(body string) (int, echo) {
+		w := servePost(ctx, s, body)
+		var e echo
+		json.Unmarshal(w.Body.Bytes(), &e)
+		return w.Code, e
+	}
+
+	code, e := send(`{"body": "a bad_message"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"body":"a ***"}`, e.Body)
+	assert.Equal(t, strconv.Itoa(len(e.Body)), e.Length)
+
+	code, e = send(`{"body": "hello", "token": "my secret"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"body":"hello"}`, e.Body)
+	assert.Equal(t, "16", e.Length)
+
+	code, e = send(`{"body": "suspicious"}`)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"body": "suspicious"}`, e.Body)
+	assert.Equal(t, "suspicious", e.Tag)
+
+	// the phrase is never forwarded, even when it cannot be rewritten away
+	code, _ = send(`{"bad_message": "key"}`)
+	assert.Equal(t, 401, code)
+	code, _ = send(`secret`)
+	assert.Equal(t, 401, code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+}
+
+// TestRejectAction tests the ServeHTTP method on ProxyServer with an action in place of rejecting `rejectWith`
+func TestRejectAction(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	s := newEchoTestServer(t, &hits)
+	s.rejectWith = "BAD_MESSAGE"
+	s.rejectInsensitive = true
+	s.WithRejectAction(filter.ActionMask, "[filtered]")
+
+	w := servePost(ctx, s, `{"body": "a bad_message"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"body": "{\"body\":\"a [filtered]\"}", "length": "23", "tag": ""}`, w.Body.String())
+
+	// requests are rejected by default
+	s.WithRejectAction(filter.ActionReject, "")
+	assert.Equal(t, 401, servePost(ctx, s, `{"body": "a bad_message"}`).Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+// TestRejectEscapes tests that the `rejectWith` phrase is found within JSON bodies once their escape sequences are unescaped
+func TestRejectEscapes(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	s := newEchoTestServer(t, &hits)
+	s.rejectWith = "bad_message"
+	s.WithRejectAction("", "")
+
+	w := servePost(ctx, s, `{"body": "a \u0062ad_message"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), "rejected because `bad_message` found within request body")
+
+	s.WithRejectAction(filter.ActionMask, "[filtered]")
+	w = servePost(ctx, s, `{"body": "a \u0062ad_message"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"body": "{\"body\":\"a [filtered]\"}", "length": "23", "tag": ""}`, w.Body.String())
+
+	s.WithRejectAction(filter.ActionTag, "")
+	w = servePost(ctx, s, `{"body": "bad_message \u0062ad_message"}`)
+	assert.Equal(t, 200, w.Code)
+	// the request is tagged whether the phrase is found within the raw body or its values
+	assert.Contains(t, w.Body.String(), `"tag":"bad_message"`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+// TestRequestParts tests the ServeHTTP method on ProxyServer with rules checked against the path, query and headers
+func TestRequestParts(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	f, err := filter.New([]filter.Rule{
+		{Phrase: "bad_message", In: []string{filter.PartQuery, filter.PartBody}},
+		{Name: "admin", Phrase: "/admin", In: []string{filter.PartPath}},
+		{Name: "scanner", Phrase: "sqlmap", Insensitive: true, In: []string{filter.PartHeaders}, Headers: []string{"User-Agent"}},
+		{Name: "suspicious", Phrase: "suspicious", Action: filter.ActionTag, In: []string{filter.PartHeaders}},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	s := newEchoTestServer(t, &hits).WithBlocklist(func() *filter.Filter { return f })
+
+	w := serveGet(s, "/posts?q=a%20bad_message")
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected because `+"`bad_message`"+` found within query parameter `+"`q`"+`"}`, w.Body.String())
+
+	w = serveGet(s, "/admin/users")
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected by rule `+"`admin`"+` matched within request path"}`, w.Body.String())
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "SQLMap/1.7")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected by rule `+"`scanner`"+` matched within header `+"`User-Agent`"+`"}`, w.Body.String())
+
+	// only the selected headers are checked, and the path and headers are not checked by body rules
+	r = httptest.NewRequest("GET", "/posts/bad_message?sqlmap=1", nil)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Note", "sqlmap suspicious")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"body": "", "length": "0", "tag": "suspicious"}`, w.Body.String())
+
+	assert.Equal(t, 401, servePost(ctx, s, `{"body": "bad_message"}`).Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+// TestRejectIn tests the ServeHTTP method on ProxyServer with the `rejectWith` phrase checked outside the body
+func TestRejectIn(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	s := newEchoTestServer(t, &hits)
+	s.rejectWith = "bad_message"
+	s.rejectExact = true
+	s.WithRejectIn([]string{filter.PartQuery, filter.PartHeaders, filter.PartBody}, []string{"X-Note"}).
+		WithRejectAction(filter.ActionReject, "")
+
+	w := serveGet(s, "/posts?q=bad_message")
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected because `+"`bad_message`"+` found within query parameter `+"`q`"+`"}`, w.Body.String())
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Note", "bad_message")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, 401, w.Code)
+
+	w = servePost(ctx, s, `{"body": "bad_message"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.JSONEq(t, `{"code": "401", "msg": "rejected because `+"`bad_message`"+` found within request body"}`, w.Body.String())
+
+	assert.Equal(t, 200, serveGet(s, "/posts?q=bad_messages").Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,148 @@
+package proxyserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/cache"
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"go.uber.org/zap"
+)
+
+const (
+	// warningStale is sent when a stale response is served while it is revalidated.
+	warningStale = `110 - "Response is Stale"`
+	// warningRevalidationFailed is sent when a stale response is served because the backend failed.
+	warningRevalidationFailed = `111 - "Revalidation Failed"`
+)
+
+// isCacheable reports whether responses to the request may be cached.
+// Only safe methods are cached.
+func isCacheable(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// cacheKey returns the key used to store responses to the request.
+func cacheKey(r *http.Request) string {
+	return r.Method + " " + r.URL.String()
+}
+
+// serveCached serves the request from the cache when a fresh or stale-while-revalidate
+// entry exists. Otherwise it requests the backend service and stores the response.
+// If the backend returns a 5xx or cannot be reached, an entry within the stale-if-error
+// window is served in place of the error.
+func (s *ProxyServer) serveCached(w http.ResponseWriter, r *http.Request, rt *Route, op *openapi.Operation, body []byte, reqID string) {
+	key := cacheKey(r)
+	e, f := s.cache.Lookup(key)
+	switch f {
+	case cache.Fresh:
+		s.writeCached(w, e, reqID, "HIT", "")
+		return
+	case cache.Stale:
+		s.writeCached(w, e, reqID, "STALE", warningStale)
+		s.revalidate(key, r, op)
+		return
+	}
+
+	resp, code, err := s.fetch(r, rt, body)
+	resp, code, err = s.checkResponse(op, resp, code, err)
+	if err != nil || resp.StatusCode >= 500 {
+		if e != nil && s.cache.ServableOnError(e) {
+			s.logger.Warn("backend service failed, serving stale response", zap.String("key", key))
+			s.writeCached(w, e, reqID, "STALE", warningRevalidationFailed)
+			return
+		}
+		if err != nil {
+			s.writeError(w, ErrorBadGateway, code, err.Error())
+			return
+		}
+	} else {
+		s.storeResponse(key, r, resp)
+	}
+
+	w.Header().Set("X-Cache", "MISS")
+	s.writeResponse(w, resp, reqID)
+}
+
+// revalidate refreshes the entry stored for key in the background. The response is validated
+// and redacted as any other before it is stored. Only one revalidation per key is in flight at
+// a time.
+func (s *ProxyServer) revalidate(key string, r *http.Request, op *openapi.Operation) {
+	if !s.cache.BeginRevalidation(key) {
+		return
+	}
+
+	// the client request may be cancelled once the stale response is written
+	req := r.Clone(context.Background())
+	go func() {
+		defer s.cache.EndRevalidation(key)
+		resp, code, err := s.requestBackendService(req)
+		resp, _, err = s.checkResponse(op, resp, code, err)
+		if err != nil || resp.StatusCode >= 500 {
+			s.logger.Warn("background revalidation failed", zap.String("key", key))
+			return
+		}
+		s.storeResponse(key, req, resp)
+	}()
+}
+
+// storeResponse stores successful responses that the backend has not marked as uncacheable.
+// Responses to requests carrying credentials (`Authorization` or `Cookie`) may be meant for
+// that client alone, so they are only stored when the backend marks them as `public`. Responses
+// with a `Vary` header depend on request headers that are not part of the cache key, so they
+// are never stored.
+func (s *ProxyServer) storeResponse(key string, r *http.Request, resp *backendResponse) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return
+	}
+	cc := resp.Header.Get("Cache-Control")
+	if hasDirective(cc, "no-store") || hasDirective(cc, "private") {
+		return
+	}
+	if (r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "") && !hasDirective(cc, "public") {
+		return
+	}
+	if len(resp.Header.Values("Vary")) > 0 {
+		return
+	}
+
+	err := s.cache.Store(key, &cache.Entry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       resp.Body,
+	})
+	if err != nil {
+		s.logger.Error("failed to store response", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// hasDirective reports whether the `Cache-Control` header value holds the directive.
+func hasDirective(cc string, directive string) bool {
+	for _, d := range strings.Split(cc, ",") {
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			d = d[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(d), directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCached writes a cached entry to the client along with `X-Cache`, `Age` and,
+// for stale responses, `Warning` headers.
+func (s *ProxyServer) writeCached(w http.ResponseWriter, e *cache.Entry, reqID string, status string, warning string) {
+	w.Header().Set("X-Cache", status)
+	w.Header().Set("Age", strconv.Itoa(int(s.cache.Age(e).Seconds())))
+	if warning != "" {
+		w.Header().Set("Warning", warning)
+	}
+
+	s.writeResponse(w, &backendResponse{
+		StatusCode: e.StatusCode,
+		Header:     e.Header,
+		Body:       e.Body,
+	}, reqID)
+}
@@ -0,0 +1,200 @@
+package proxyserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/cache"
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestBackend creates a backend service that counts its requests and fails
+// with a 503 while `failing` is set.
+func newTestBackend(t *testing.T, hits *int32, failing *int32) *httptest.Server {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if atomic.LoadInt32(failing) == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// serveGet sends a GET request through the server and returns the recorded response.
+func serveGet(s *ProxyServer, uri string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", uri, nil)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+// TestCache tests the ServeHTTP method on ProxyServer with a response cache
+func TestCache(t *testing.T) {
+
+	t.Run("fresh", func(t *testing.T) {
+		var hits, failing int32
+		backend := newTestBackend(t, &hits, &failing)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithCache(cache.New(cache.NewMemoryStorage(), time.Hour, 0, 0))
+
+		w := serveGet(s, "/posts/1")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+
+		w = serveGet(s, "/posts/1")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, `{"id": 1}`, w.Body.String())
+		assert.NotEmpty(t, w.Header().Get("X-Proxy-Request-ID"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		var hits int32
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			if r.URL.Path == "/public" {
+				w.Header().Set("Cache-Control", "public, max-age=60")
+			}
+			w.Write([]byte(`{"user": "` + r.Header.Get("Authorization") + `"}`))
+		}))
+		t.Cleanup(backend.Close)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithCache(cache.New(cache.NewMemoryStorage(), time.Hour, 0, 0))
+
+		serve := func(uri string, header string, value string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", uri, nil)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set(header, value)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			return w
+		}
+
+		// responses to requests carrying credentials are never served to other clients
+		serve("/private", "Authorization", "alice")
+		serve("/private", "Cookie", "session=alice")
+		w := serveGet(s, "/private")
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, `{"user": ""}`, w.Body.String())
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+		// unless they are public
+		serve("/public", "Authorization", "alice")
+		w = serveGet(s, "/public")
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		var hits int32
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			switch r.URL.Path {
+			case "/language":
+				w.Header().Set("Vary", "Accept-Language")
+			case "/any":
+				w.Header().Set("Vary", "*")
+			}
+			w.Write([]byte(`{"language": "` + r.Header.Get("Accept-Language") + `"}`))
+		}))
+		t.Cleanup(backend.Close)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithCache(cache.New(cache.NewMemoryStorage(), time.Hour, 0, 0))
+
+		// responses varying on request headers are never served to other requests
+		for _, uri := range []string{"/language", "/any"} {
+			r := httptest.NewRequest("GET", uri, nil)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Accept-Language", "fr")
+			s.ServeHTTP(httptest.NewRecorder(), r)
+			w := serveGet(s, uri)
+			assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+			assert.Equal(t, `{"language": ""}`, w.Body.String())
+		}
+		assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("stale while revalidate", func(t *testing.T) {
+		var hits, failing int32
+		backend := newTestBackend(t, &hits, &failing)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithCache(cache.New(cache.NewMemoryStorage(), 0, time.Hour, 0))
+
+		serveGet(s, "/posts/1")
+		w := serveGet(s, "/posts/1")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+		assert.Equal(t, warningStale, w.Header().Get("Warning"))
+
+		// the stale response triggers a background revalidation
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 2 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("revalidation checks responses", func(t *testing.T) {
+		var hits int32
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.Write([]byte(`{"id": 1}`))
+				return
+			}
+			w.Write([]byte(`{"hit": 2}`))
+		}))
+		t.Cleanup(backend.Close)
+		doc, err := openapi.Parse([]byte(testDescription))
+		assert.NoError(t, err)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithOpenAPI(doc, false, true).
+			WithCache(cache.New(cache.NewMemoryStorage(), 0, time.Hour, 0))
+
+		serveGet(s, "/posts/1")
+		assert.Equal(t, "STALE", serveGet(s, "/posts/1").Header().Get("X-Cache"))
+
+		// wait for the revalidation to end, the response it fetched does not conform
+		key := "GET " + backend.URL + "/posts/1"
+		assert.Eventually(t, func() bool {
+			if atomic.LoadInt32(&hits) < 2 || !s.cache.BeginRevalidation(key) {
+				return false
+			}
+			s.cache.EndRevalidation(key)
+			return true
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, `{"id": 1}`, serveGet(s, "/posts/1").Body.String())
+	})
+
+	t.Run("stale if error", func(t *testing.T) {
+		var hits, failing int32
+		backend := newTestBackend(t, &hits, &failing)
+		s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithCache(cache.New(cache.NewMemoryStorage(), 0, 0, time.Hour))
+
+		serveGet(s, "/posts/1")
+
+		// backend 5xx
+		atomic.StoreInt32(&failing, 1)
+		w := serveGet(s, "/posts/1")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+		assert.Equal(t, warningRevalidationFailed, w.Header().Get("Warning"))
+		assert.Equal(t, `{"id": 1}`, w.Body.String())
+
+		// backend unreachable
+		backend.Close()
+		w = serveGet(s, "/posts/1")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, warningRevalidationFailed, w.Header().Get("Warning"))
+
+		// nothing cached for this resource
+		w = serveGet(s, "/posts/2")
+		assert.Equal(t, 502, w.Code)
+	})
+}
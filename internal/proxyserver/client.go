@@ -0,0 +1,46 @@
+package proxyserver
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// WithClientIDHeader sets the header identifying clients, such as an API key header.
+// Clients that do not send the header, or every client when it is not set, are
+// identified by their IP address.
+func (s *ProxyServer) WithClientIDHeader(header string) *ProxyServer {
+	s.clientIDHeader = header
+	return s
+}
+
+// WithPriorRequestTTL sets how long the prior request of each client is remembered
+// in order to detect consecutive requests.
+func (s *ProxyServer) WithPriorRequestTTL(ttl time.Duration) *ProxyServer {
+	s.priorRequestTTL = ttl
+	return s
+}
+
+// clientID returns the identity of the client that sent the request.
+func (s *ProxyServer) clientID(r *http.Request) string {
+	if s.clientIDHeader != "" {
+		if v := r.Header.Get(s.clientIDHeader); v != "" {
+			return "header:" + v
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP returns the IP address of the client that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// priorRequestKey returns the state store key holding the prior request of the client.
+func priorRequestKey(client string) string {
+	return "prior-request:" + client
+}
@@ -0,0 +1,110 @@
+package proxyserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// coalescedCall defines an in-flight backend request that concurrent identical
+// requests wait on.
+type coalescedCall struct {
+	wg   sync.WaitGroup
+	resp *backendResponse
+	code int
+	err  error
+	dups int
+}
+
+// coalescer collapses identical concurrent backend requests into a single call.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// do executes fn once for all concurrent callers sharing the same key and returns
+// its results to each of them. `shared` is true for callers that waited on
+// another caller's request. When fn panics, the callers waiting on it are handed a
+// bad gateway error before the panic goes on in the caller that executed it.
+func (c *coalescer) do(key string, fn func() (*backendResponse, int, error)) (resp *backendResponse, code int, err error, shared bool) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = map[string]*coalescedCall{}
+	}
+	if call, ok := c.calls[key]; ok {
+		call.dups++
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.resp, call.code, call.err, true
+	}
+	call := &coalescedCall{}
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	done := false
+	defer func() {
+		if !done {
+			call.resp, call.code, call.err = nil, 502, errors.New("bad gateway")
+			c.release(key, call)
+		}
+	}()
+	call.resp, call.code, call.err = fn()
+	done = true
+	c.release(key, call)
+
+	return call.resp, call.code, call.err, false
+}
+
+// release hands the results of the call to the callers waiting on it and forgets it.
+func (c *coalescer) release(key string, call *coalescedCall) {
+	call.wg.Done()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+}
+
+// isSafeMethod reports whether the request method is safe to coalesce.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// coalesceKey returns a fingerprint of the prepared request. Like `RequestCopy`,
+// it covers the method, target and the headers that affect the response.
+func coalesceKey(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.String() + "\n"))
+	for _, k := range []string{"Accept", "Content-Type", "Authorization", "Cookie"} {
+		for _, v := range r.Header.Values(k) {
+			h.Write([]byte(k + ": " + v + "\n"))
+		}
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fetch requests the backend service, coalescing identical concurrent safe requests
+// when the route has opted in.
+func (s *ProxyServer) fetch(r *http.Request, rt *Route, body []byte) (*backendResponse, int, error) {
+	if rt == nil || !rt.Coalesce || !isSafeMethod(r.Method) {
+		return s.requestBackendService(r)
+	}
+
+	resp, code, err, shared := s.coalescer.do(coalesceKey(r, body), func() (*backendResponse, int, error) {
+		return s.requestBackendService(r)
+	})
+	if shared {
+		metrics.Add("coalesced_requests", 1)
+		s.logger.Debug("coalesced request", zap.String("path", r.URL.Path))
+	}
+	return resp, code, err
+}
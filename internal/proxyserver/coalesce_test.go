@@ -0,0 +1,125 @@
+package proxyserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestCoalesce tests that identical concurrent requests share a single backend request
+func TestCoalesce(t *testing.T) {
+
+	type unitTestCase struct {
+		name     string
+		method   string
+		coalesce bool
+		hits     int32 // expected number of backend requests
+	}
+
+	const clients = 5
+
+	for _, tCase := range []unitTestCase{
+		{name: "coalesced get", method: "GET", coalesce: true, hits: 1},
+		{name: "route not opted in", method: "GET", coalesce: false, hits: clients},
+		{name: "unsafe method", method: "POST", coalesce: true, hits: clients},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			var hits int32
+			release := make(chan struct{})
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				<-release
+				w.Write([]byte(`{"id": 1}`))
+			}))
+			defer backend.Close()
+
+			s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+				WithRoutes([]Route{{Prefix: "/posts", Coalesce: tCase.coalesce}})
+
+			var wg sync.WaitGroup
+			codes := make([]int, clients)
+			for i := 0; i < clients; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					r := httptest.NewRequest(tCase.method, "/posts/1", nil)
+					r.Header.Set("Content-Type", "application/json")
+					w := httptest.NewRecorder()
+					s.ServeHTTP(w, r)
+					codes[i] = w.Code
+				}(i)
+			}
+
+			// wait for every client to reach the backend or join the in-flight request
+			assert.Eventually(t, func() bool {
+				s.coalescer.mu.Lock()
+				defer s.coalescer.mu.Unlock()
+				joined := int32(0)
+				for _, c := range s.coalescer.calls {
+					joined += int32(c.dups)
+				}
+				return atomic.LoadInt32(&hits)+joined == clients
+			}, time.Second, time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			assert.Equal(t, tCase.hits, atomic.LoadInt32(&hits))
+			for _, code := range codes {
+				assert.Equal(t, 200, code)
+			}
+		})
+	}
+}
+
+// TestCoalescePanic tests that callers waiting on a request that panics are handed an error
+func TestCoalescePanic(t *testing.T) {
+	var c coalescer
+	release := make(chan struct{})
+	leader := make(chan interface{})
+	go func() {
+		defer func() { leader <- recover() }()
+		c.do("key", func() (*backendResponse, int, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.calls["key"] != nil
+	}, time.Second, time.Millisecond)
+
+	type result struct {
+		code int
+		err  error
+	}
+	waiter := make(chan result)
+	go func() {
+		_, code, err, shared := c.do("key", func() (*backendResponse, int, error) {
+			t.Error("the in-flight call should be shared")
+			return nil, 0, nil
+		})
+		assert.True(t, shared)
+		waiter <- result{code, err}
+	}()
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.calls["key"].dups == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	// the panic goes on in the leader, once the waiter is released
+	assert.Equal(t, "boom", <-leader)
+	got := <-waiter
+	assert.Equal(t, 502, got.code)
+	assert.Error(t, got.err)
+	assert.Empty(t, c.calls)
+}
@@ -0,0 +1,148 @@
+package proxyserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultContentTypes lists the media types of the request bodies accepted when none are set.
+var DefaultContentTypes = []string{"application/json", "application/*+json"}
+
+// ParseContentTypes parses a comma-separated list of accepted media types, which may hold
+// wildcards: `*/*`, a type followed by `/*` (e.g., `text/*`) or a structured syntax suffix
+// (e.g., `application/*+json`). Parameters are ignored.
+func ParseContentTypes(spec string) ([]string, error) {
+	var types []string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		mt, err := parseMediaRange(item)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, mt)
+	}
+	return types, nil
+}
+
+// parseMediaRange parses an accepted media type, returning it in lower case without parameters.
+func parseMediaRange(s string) (string, error) {
+	mt, _, err := mime.ParseMediaType(s)
+	if err != nil || strings.Count(mt, "/") != 1 || strings.HasPrefix(mt, "/") || strings.HasSuffix(mt, "/") {
+		return "", fmt.Errorf("invalid media type `%s`", s)
+	}
+	return mt, nil
+}
+
+// WithContentTypes sets the media types of the request bodies accepted, DefaultContentTypes
+// when empty, which routes may override. Requests without a body are accepted whatever their
+// Content-Type, or lack thereof, when skipBodyless is set. Bodies of JSON media types
+// (`application/json` or `+json`) must be well-formed JSON when validateJSON is set.
+func (s *ProxyServer) WithContentTypes(types []string, skipBodyless bool, validateJSON bool) *ProxyServer {
+	s.contentTypes = types
+	s.skipBodyless = skipBodyless
+	s.validateJSON = validateJSON
+	return s
+}
+
+// checkContentType validates the Content-Type of the request against the media types accepted
+// by its route, or by the server, and rejects others with a 415. It returns false when a
+// response has been written.
+func (s *ProxyServer) checkContentType(w http.ResponseWriter, r *http.Request, rt *Route) bool {
+	if s.skipBodyless && r.ContentLength == 0 && len(r.TransferEncoding) == 0 {
+		return true
+	}
+
+	accepted := s.contentTypes
+	if rt != nil && len(rt.ContentTypes) > 0 {
+		accepted = rt.ContentTypes
+	}
+	if len(accepted) == 0 {
+		accepted = DefaultContentTypes
+	}
+
+	ct := r.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err == nil && acceptsMediaType(accepted, mt) {
+		return true
+	}
+	if s.shadowed(r, CheckContentType, "", false, "reject") {
+		return true
+	}
+
+	msg := "Content-Type header must be one of `" + strings.Join(accepted, "`, `") + "`"
+	switch {
+	case ct == "":
+		msg = "Content-Type header is missing, it must be one of `" + strings.Join(accepted, "`, `") + "`"
+	case err != nil:
+		msg = "Content-Type header `" + ct + "` is not a valid media type"
+	}
+	s.writeError(w, ErrorUnsupportedMediaType, 415, msg)
+	return false
+}
+
+// checkJSONBody validates that bodies of JSON media types are well-formed JSON, when enabled,
+// and rejects others with a 400. It returns false when a response has been written.
+func (s *ProxyServer) checkJSONBody(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if !s.validateJSON || len(body) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !isJSONMediaType(mt) || json.Valid(body) {
+		return true
+	}
+	if s.shadowed(r, CheckContentType, "", false, "reject") {
+		return true
+	}
+	s.writeError(w, ErrorInvalidRequest, 400, "request body is not well-formed JSON")
+	return false
+}
+
+// hasJSONBody reports whether the request has a body of a JSON media type.
+func hasJSONBody(r *http.Request) bool {
+	if r.ContentLength == 0 && len(r.TransferEncoding) == 0 {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && isJSONMediaType(mt)
+}
+
+// acceptsMediaType reports whether the media type matches any of the accepted media types.
+func acceptsMediaType(accepted []string, mt string) bool {
+	for _, a := range accepted {
+		if matchMediaType(a, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType reports whether the media type matches the accepted one, which may hold
+// wildcards. Both are in lower case, as returned by `mime.ParseMediaType`.
+func matchMediaType(accepted string, mt string) bool {
+	if accepted == "*/*" || accepted == mt {
+		return true
+	}
+	i, j := strings.Index(accepted, "/"), strings.Index(mt, "/")
+	if i < 0 || j < 0 || accepted[:i] != mt[:j] {
+		return false
+	}
+	subtype := accepted[i+1:]
+	switch {
+	case subtype == "*":
+		return true
+	case strings.HasPrefix(subtype, "*+"):
+		return strings.HasSuffix(mt[j+1:], subtype[1:])
+	}
+	return false
+}
+
+// isJSONMediaType reports whether the media type is that of JSON documents.
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
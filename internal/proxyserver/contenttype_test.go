@@ -0,0 +1,121 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseContentTypes tests the ParseContentTypes function
+func TestParseContentTypes(t *testing.T) {
+	types, err := ParseContentTypes(" application/json, Application/*+JSON ,text/*; charset=utf-8,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"application/json", "application/*+json", "text/*"}, types)
+
+	for _, spec := range []string{"json", "application/", "/json", "application/json/x", "application json"} {
+		_, err := ParseContentTypes(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestMatchMediaType tests the matchMediaType function
+func TestMatchMediaType(t *testing.T) {
+
+	type unitTestCase struct {
+		accepted string
+		mt       string
+		matched  bool
+	}
+
+	for _, tCase := range []unitTestCase{
+		{accepted: "application/json", mt: "application/json", matched: true},
+		{accepted: "application/json", mt: "application/problem+json", matched: false},
+		{accepted: "application/*+json", mt: "application/problem+json", matched: true},
+		{accepted: "application/*+json", mt: "application/vnd.api+json", matched: true},
+		{accepted: "application/*+json", mt: "application/json", matched: false},
+		{accepted: "application/*+json", mt: "text/x+json", matched: false},
+		{accepted: "application/*+json", mt: "application/jsonx", matched: false},
+		{accepted: "text/*", mt: "text/plain", matched: true},
+		{accepted: "text/*", mt: "application/text", matched: false},
+		{accepted: "*/*", mt: "image/png", matched: true},
+	} {
+		t.Run(fmt.Sprintf("accepted=%s/mt=%s/matched=%t", tCase.accepted, tCase.mt, tCase.matched), func(t *testing.T) {
+			assert.Equal(t, tCase.matched, matchMediaType(tCase.accepted, tCase.mt))
+		})
+	}
+}
+
+// TestContentTypes tests the ServeHTTP method on ProxyServer with accepted content types
+func TestContentTypes(t *testing.T) {
+
+	type unitTestCase struct {
+		method string
+		target string
+		ct     string
+		body   string
+		code   int
+		msg    string
+	}
+
+	serve := func(s *ProxyServer, tCase unitTestCase) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(tCase.method, tCase.target, strings.NewReader(tCase.body))
+		if tCase.ct != "" {
+			r.Header.Set("Content-Type", tCase.ct)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		var hits int32
+		s := newEchoTestServer(t, &hits)
+
+		for _, tCase := range []unitTestCase{
+			{method: "POST", target: "/posts", ct: "application/json", body: `{"a": 1}`, code: 200},
+			{method: "POST", target: "/posts", ct: "Application/JSON; charset=utf-8", body: `{"a": 2}`, code: 200},
+			{method: "POST", target: "/posts", ct: "application/merge-patch+json", body: `{"a": 3}`, code: 200},
+			{method: "POST", target: "/posts", ct: "text/plain", body: `{"a": 4}`, code: 415, msg: "Content-Type header must be one of `application/json`, `application/*+json`"},
+			{method: "POST", target: "/posts", ct: "application/json; charset", body: `{"a": 5}`, code: 415, msg: "Content-Type header `application/json; charset` is not a valid media type"},
+			{method: "GET", target: "/posts", code: 415, msg: "Content-Type header is missing, it must be one of `application/json`, `application/*+json`"},
+			// the body is not checked for well-formedness by default
+			{method: "POST", target: "/posts", ct: "application/json", body: `{"a": `, code: 200},
+		} {
+			t.Run(fmt.Sprintf("%s/ct=%s", tCase.method, tCase.ct), func(t *testing.T) {
+				w := serve(s, tCase)
+				assert.Equal(t, tCase.code, w.Code)
+				if tCase.msg != "" {
+					assert.JSONEq(t, `{"code": "415", "msg": "`+tCase.msg+`"}`, w.Body.String())
+				}
+			})
+		}
+		assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("routes, body-less requests and JSON validation", func(t *testing.T) {
+		var hits int32
+		s := newEchoTestServer(t, &hits).
+			WithContentTypes([]string{"application/json"}, true, true).
+			WithRoutes([]Route{{Prefix: "/uploads", ContentTypes: []string{"text/*", "application/*+json"}}})
+
+		for _, tCase := range []unitTestCase{
+			{method: "GET", target: "/posts", code: 200},
+			{method: "DELETE", target: "/posts/1", ct: "text/plain", code: 200},
+			{method: "POST", target: "/posts", ct: "application/problem+json", body: `{"a": 1}`, code: 415},
+			{method: "POST", target: "/posts", ct: "application/json", body: `{"a": `, code: 400},
+			{method: "POST", target: "/uploads", ct: "text/csv", body: `a,b`, code: 200},
+			{method: "POST", target: "/uploads", ct: "application/problem+json", body: `{"a": 2}`, code: 200},
+			{method: "POST", target: "/uploads", ct: "application/problem+json", body: `[1,`, code: 400},
+			{method: "POST", target: "/uploads", ct: "application/json", body: `{"a": 3}`, code: 415},
+		} {
+			t.Run(fmt.Sprintf("%s %s/ct=%s", tCase.method, tCase.target, tCase.ct), func(t *testing.T) {
+				assert.Equal(t, tCase.code, serve(s, tCase).Code)
+			})
+		}
+		assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+	})
+}
@@ -0,0 +1,74 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Checks that may run in dry-run mode, where their decisions are logged and counted but the
+// requests they would reject, or rewrite, are forwarded as they are.
+const (
+	CheckMethod      = "method"       // methods not allowed on the route, or other than `POST`, `PUT` and `PATCH` when `bodyMethodsOnly` is set
+	CheckContentType = "content_type" // requests whose Content-Type is not accepted, or whose JSON body is not well-formed
+	CheckReject      = "reject"       // the `rejectWith` phrase
+	CheckBlocklist   = "blocklist"    // the rules of the blocklist
+	CheckSecrets     = "secrets"      // the detectors of secrets
+	CheckPolicy      = "policy"       // the rules of the policy
+	CheckRateLimit   = "rate_limit"   // the rate limit
+	CheckJSONLimits  = "json_limits"  // the structural limits of JSON request bodies
+)
+
+// checks lists every check that may run in dry-run mode.
+var checks = []string{CheckMethod, CheckContentType, CheckReject, CheckBlocklist, CheckSecrets, CheckPolicy, CheckRateLimit, CheckJSONLimits}
+
+// ParseDryRun parses a comma-separated list of checks run in dry-run mode, or `all`.
+func ParseDryRun(spec string) (map[string]bool, error) {
+	dryRun := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case item == "all":
+			for _, c := range checks {
+				dryRun[c] = true
+			}
+		default:
+			known := false
+			for _, c := range checks {
+				known = known || c == item
+			}
+			if !known {
+				return nil, fmt.Errorf("unknown check `%s`, must be one of '%s' or 'all'", item, strings.Join(checks, "', '"))
+			}
+			dryRun[item] = true
+		}
+	}
+	return dryRun, nil
+}
+
+// WithDryRun runs the given checks in dry-run mode: the requests they would reject, or
+// rewrite, are forwarded as they are, and their would-be decisions are logged and counted.
+// Rules of the blocklist and of the policy may also run in dry-run mode on their own.
+func (s *ProxyServer) WithDryRun(checks map[string]bool) *ProxyServer {
+	s.dryRunChecks = checks
+	return s
+}
+
+// shadowed reports whether the decision of a check, or of one of its rules, is not enforced
+// because either runs in dry-run mode. If so, the would-be decision is logged and counted.
+func (s *ProxyServer) shadowed(r *http.Request, check string, rule string, ruleDryRun bool, decision string) bool {
+	if !s.dryRunChecks[check] && !ruleDryRun {
+		return false
+	}
+	metrics.Add("dry_run_"+check, 1)
+	s.logger.Warn("dry run, decision not enforced",
+		zap.String("check", check),
+		zap.String("rule", rule),
+		zap.String("decision", decision),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path))
+	return true
+}
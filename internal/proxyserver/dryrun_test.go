@@ -0,0 +1,114 @@
+package proxyserver
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// dryRunCount returns the number of decisions of the check that were not enforced.
+func dryRunCount(check string) int64 {
+	if v, ok := metrics.Get("dry_run_" + check).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// TestParseDryRun tests the ParseDryRun function
+func TestParseDryRun(t *testing.T) {
+	checks, err := ParseDryRun(" blocklist, rate_limit ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{CheckBlocklist: true, CheckRateLimit: true}, checks)
+
+	checks, err = ParseDryRun("all")
+	assert.NoError(t, err)
+	assert.Len(t, checks, 8)
+
+	_, err = ParseDryRun("blocklist,openapi")
+	assert.Error(t, err)
+}
+
+// TestDryRun tests the ServeHTTP method on ProxyServer with checks in dry-run mode
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	f, err := filter.New([]filter.Rule{
+		{Phrase: "bad_message"},
+		{Name: "trial", Phrase: "maybe_bad", DryRun: true},
+		{Phrase: "sensitive", Action: filter.ActionMask},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	sc, err := redact.ParseScanner("card:redact", "")
+	assert.NoError(t, err)
+	p, err := policy.New([]policy.Rule{{Name: "no-drafts", When: `body.status == 'draft'`}})
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		checks   string
+		body     string
+		expected int
+		check    string // check whose would-be decision is counted
+		forward  string // body forwarded to the backend, when expected is 200
+	}
+
+	for _, tCase := range []unitTestCase{
+		// rules in dry-run mode never reject, nor rewrite, requests
+		{body: `{"body": "maybe_bad"}`, expected: 200, check: CheckBlocklist, forward: `{"body": "maybe_bad"}`},
+		{body: `{"body": "bad_message"}`, expected: 401},
+		{checks: "blocklist", body: `{"body": "bad_message"}`, expected: 200, check: CheckBlocklist, forward: `{"body": "bad_message"}`},
+		{checks: "blocklist", body: `{"body": "sensitive"}`, expected: 200, check: CheckBlocklist, forward: `{"body": "sensitive"}`},
+		{checks: "reject", body: `{"body": "rejected_word"}`, expected: 200, check: CheckReject, forward: `{"body": "rejected_word"}`},
+		{checks: "secrets", body: `{"card": "4111111111111111"}`, expected: 200, check: CheckSecrets, forward: `{"card": "4111111111111111"}`},
+		{checks: "policy", body: `{"status": "draft"}`, expected: 200, check: CheckPolicy, forward: `{"status": "draft"}`},
+		{body: `{"status": "draft"}`, expected: 403},
+	} {
+		t.Run(fmt.Sprintf("checks=%s/body=%s", tCase.checks, tCase.body), func(t *testing.T) {
+			var hits int32
+			s := newEchoTestServer(t, &hits).WithSecretScanner(sc).WithPolicy(p)
+			s.rejectWith = "rejected_word"
+			s.WithBlocklist(func() *filter.Filter { return f })
+			checks, err := ParseDryRun(tCase.checks)
+			assert.NoError(t, err)
+			s.WithDryRun(checks)
+
+			count := dryRunCount(tCase.check)
+			w := servePost(ctx, s, tCase.body)
+			assert.Equal(t, tCase.expected, w.Code)
+			if tCase.expected == 200 {
+				assert.Contains(t, w.Body.String(), fmt.Sprintf(`"body":%q`, tCase.forward))
+				assert.Equal(t, count+1, dryRunCount(tCase.check))
+			}
+		})
+	}
+
+	t.Run("method, content type and rate limit", func(t *testing.T) {
+		var hits int32
+		s := newEchoTestServer(t, &hits).WithRateLimit(0.001, 1, RateLimitByIP, "")
+		s.bodyMethodsOnly = true
+		s.WithDryRun(map[string]bool{CheckMethod: true, CheckContentType: true, CheckRateLimit: true})
+
+		methods, contentTypes, limits := dryRunCount(CheckMethod), dryRunCount(CheckContentType), dryRunCount(CheckRateLimit)
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest("GET", "/posts", strings.NewReader(""))
+			r.Header.Set("Content-Type", "text/plain")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Empty(t, w.Header().Get("RateLimit-Remaining"))
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+		assert.Equal(t, methods+2, dryRunCount(CheckMethod))
+		assert.Equal(t, contentTypes+2, dryRunCount(CheckContentType))
+		assert.Equal(t, limits+1, dryRunCount(CheckRateLimit))
+	})
+}
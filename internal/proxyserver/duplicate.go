@@ -0,0 +1,206 @@
+package proxyserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"go.uber.org/zap"
+)
+
+// Duplicate strategies, these determine how consecutive identical requests from a client are answered.
+const (
+	DuplicateDelay    = "delay"    // delay the request, then proxy it
+	DuplicateReject   = "reject"   // respond with a 429 and a `Retry-After` header
+	DuplicateConflict = "conflict" // respond with a 409
+	DuplicateReplay   = "replay"   // replay the response to the prior request
+)
+
+// errDuplicate is used to release the resources claimed by a duplicate request that was not proxied.
+var errDuplicate = errors.New("duplicate request")
+
+// duplicateRecord defines the stored outcome of the prior request of a client, used by the replay strategy.
+type duplicateRecord struct {
+	Fingerprint string           `json:"fingerprint"`
+	Response    *backendResponse `json:"response,omitempty"` // nil while the prior request is in flight
+}
+
+// duplicateClaim defines the prior request of a client whose response is to be stored for replay.
+type duplicateClaim struct {
+	client      string
+	fingerprint string
+}
+
+// WithDuplicateStrategy sets how consecutive identical requests from a client are answered.
+// By default, they are delayed.
+func (s *ProxyServer) WithDuplicateStrategy(strategy string) *ProxyServer {
+	s.duplicateStrategy = strategy
+	return s
+}
+
+// WithDuplicateEscalation enables exponential escalation (tarpitting) for repeated duplicates:
+// the delay, or the `Retry-After` of the reject strategy, doubles with every further duplicate
+// up to the given maximum. It starts from the request delay, so it has no effect when that is 0.
+func (s *ProxyServer) WithDuplicateEscalation(maxDelay time.Duration) *ProxyServer {
+	s.duplicateMaxDelay = maxDelay
+	return s
+}
+
+// duplicateCountKey returns the state store key counting the consecutive duplicates of the client.
+func duplicateCountKey(client string) string {
+	return "duplicates:" + client
+}
+
+// priorResponseKey returns the state store key holding the response to the prior request of the client.
+func priorResponseKey(client string) string {
+	return "prior-response:" + client
+}
+
+// checkDuplicate detects whether the request is identical to the prior request of the client and, if
+// so, answers it according to the duplicate strategy. It returns false when the request must not be
+// proxied, in which case a response has been written unless the client cancelled the request. For the
+// replay strategy, a claim is returned so that the response to the request can be stored.
+func (s *ProxyServer) checkDuplicate(w http.ResponseWriter, r *http.Request, client string, fingerprint string) (claim *duplicateClaim, proceed bool) {
+	ctx := r.Context()
+
+	// the prior request of each client is swapped atomically in the state store, so that
+	// concurrent requests, from any replica, each compare against exactly one prior request
+	prior, err := s.store.Swap(ctx, priorRequestKey(client), []byte(fingerprint), s.priorRequestTTL)
+	if err != nil && !errors.Is(err, statestore.ErrNotFound) {
+		s.logger.Error("state store failure", zap.Error(err))
+	}
+
+	if string(prior) != fingerprint {
+		return s.claimDuplicate(ctx, r, client, fingerprint), true
+	}
+
+	metrics.Add("duplicate_requests", 1)
+	d := s.duplicateDelay(ctx, client)
+
+	switch s.duplicateStrategy {
+	case DuplicateReject:
+		secs := int(math.Ceil(d.Seconds()))
+		if secs < 1 {
+			secs = 1
+		}
+		s.logger.Info("consecutive requests detected, rejecting request", zap.String("client", client))
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		s.writeError(w, ErrorDuplicateRequest, 429, "duplicate request, retry after "+strconv.Itoa(secs)+" seconds")
+		return nil, false
+
+	case DuplicateConflict:
+		s.logger.Info("consecutive requests detected, rejecting request", zap.String("client", client))
+		s.writeError(w, ErrorDuplicateRequest, 409, "duplicate request")
+		return nil, false
+
+	case DuplicateReplay:
+		return s.replayDuplicate(w, r, client, fingerprint)
+	}
+
+	s.logger.Info("consecutive requests detected, delaying response", zap.String("client", client), zap.Duration("delay", d))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil, true
+	case <-ctx.Done():
+		s.logger.Info("client cancelled delayed request", zap.String("client", client))
+		return nil, false
+	}
+}
+
+// duplicateDelay returns the delay for a duplicate of the client. Without escalation it is the
+// request delay, otherwise it doubles with every consecutive duplicate up to the maximum delay.
+func (s *ProxyServer) duplicateDelay(ctx context.Context, client string) time.Duration {
+	d := time.Duration(s.requestDelay) * time.Second
+	if s.duplicateMaxDelay <= 0 {
+		return d
+	}
+
+	n, err := s.store.Incr(ctx, duplicateCountKey(client), s.priorRequestTTL)
+	if err != nil {
+		s.logger.Error("state store failure", zap.Error(err))
+		return d
+	}
+	for i := int64(1); i < n && d < s.duplicateMaxDelay; i++ {
+		d *= 2
+	}
+	if d > s.duplicateMaxDelay {
+		d = s.duplicateMaxDelay
+	}
+	return d
+}
+
+// claimDuplicate resets the duplicate count of the client and, for the replay strategy, returns a
+// claim for the request. Unsafe requests are recorded as in flight so that their duplicates are
+// not proxied until a response can be replayed.
+func (s *ProxyServer) claimDuplicate(ctx context.Context, r *http.Request, client string, fingerprint string) *duplicateClaim {
+	if s.duplicateMaxDelay > 0 {
+		if err := s.store.Delete(ctx, duplicateCountKey(client)); err != nil {
+			s.logger.Error("state store failure", zap.Error(err))
+		}
+	}
+	if s.duplicateStrategy != DuplicateReplay {
+		return nil
+	}
+
+	if !isSafeMethod(r.Method) {
+		s.storeDuplicate(ctx, client, &duplicateRecord{Fingerprint: fingerprint})
+	}
+	return &duplicateClaim{client: client, fingerprint: fingerprint}
+}
+
+// replayDuplicate writes the stored response to the prior request of the client. Duplicates of
+// unsafe requests still in flight receive a 409. When no response is stored, because the prior
+// request failed or was served from the cache, the request is proxied.
+func (s *ProxyServer) replayDuplicate(w http.ResponseWriter, r *http.Request, client string, fingerprint string) (*duplicateClaim, bool) {
+	buf, err := s.store.Get(r.Context(), priorResponseKey(client))
+	if err != nil && !errors.Is(err, statestore.ErrNotFound) {
+		s.logger.Error("state store failure", zap.Error(err))
+	}
+
+	var rec duplicateRecord
+	if err != nil || json.Unmarshal(buf, &rec) != nil || rec.Fingerprint != fingerprint {
+		return s.claimDuplicate(r.Context(), r, client, fingerprint), true
+	}
+	if rec.Response == nil {
+		s.writeError(w, ErrorDuplicateRequest, 409, "duplicate request, the prior request is still being processed")
+		return nil, false
+	}
+
+	s.logger.Info("consecutive requests detected, replaying response", zap.String("client", client))
+	w.Header().Set("X-Proxy-Replayed", "true")
+	s.writeResponse(w, rec.Response, w.Header().Get("X-Proxy-Request-ID"))
+	return nil, false
+}
+
+// completeDuplicate stores the backend response for the claim returned by `checkDuplicate`.
+// Failed requests are forgotten so that their duplicates are proxied.
+func (s *ProxyServer) completeDuplicate(ctx context.Context, claim *duplicateClaim, resp *backendResponse, err error) {
+	if claim == nil {
+		return
+	}
+	if err != nil || resp.StatusCode >= 500 {
+		if err := s.store.Delete(ctx, priorResponseKey(claim.client)); err != nil {
+			s.logger.Error("state store failure", zap.Error(err))
+		}
+		return
+	}
+	s.storeDuplicate(ctx, claim.client, &duplicateRecord{Fingerprint: claim.fingerprint, Response: resp})
+}
+
+// storeDuplicate stores the record for the prior request of the client.
+func (s *ProxyServer) storeDuplicate(ctx context.Context, client string, rec *duplicateRecord) {
+	buf, err := json.Marshal(rec)
+	if err == nil {
+		err = s.store.Set(ctx, priorResponseKey(client), buf, s.priorRequestTTL)
+	}
+	if err != nil {
+		s.logger.Error("state store failure", zap.Error(err))
+	}
+}
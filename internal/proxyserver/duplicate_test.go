@@ -0,0 +1,163 @@
+package proxyserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newDuplicateTestServer creates a server in front of a backend that counts its requests.
+func newDuplicateTestServer(t *testing.T, hits *int32, delay uint) *ProxyServer {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(hits, 1)
+		w.Write([]byte(fmt.Sprintf(`{"hit": %d}`, n)))
+	}))
+	t.Cleanup(backend.Close)
+	return NewProxyServer(false, backend.URL, delay, false, "", false, false, zap.NewNop())
+}
+
+// servePost sends a POST request through the server and returns the recorded response.
+func servePost(ctx context.Context, s *ProxyServer, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/posts", bytes.NewBufferString(body)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+// TestDuplicateStrategies tests the ServeHTTP method on ProxyServer with each duplicate strategy
+func TestDuplicateStrategies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reject", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 3).WithDuplicateStrategy(DuplicateReject)
+
+		assert.Equal(t, 200, servePost(ctx, s, `{"body": "a"}`).Code)
+		w := servePost(ctx, s, `{"body": "a"}`)
+		assert.Equal(t, 429, w.Code)
+		assert.Equal(t, "3", w.Header().Get("Retry-After"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 3).WithDuplicateStrategy(DuplicateConflict)
+
+		assert.Equal(t, 200, servePost(ctx, s, `{"body": "a"}`).Code)
+		assert.Equal(t, 409, servePost(ctx, s, `{"body": "a"}`).Code)
+		assert.Equal(t, 200, servePost(ctx, s, `{"body": "b"}`).Code)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("whitespace", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 3).WithDuplicateStrategy(DuplicateConflict)
+
+		// bodies differing only in whitespace are duplicates under the default fingerprint,
+		// even though their `Content-Length` differs
+		for i, body := range []string{`{"a":1}`, `{ "a": 1 }`} {
+			r := httptest.NewRequest("POST", "/posts", bytes.NewBufferString(body)).WithContext(ctx)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Content-Length", fmt.Sprint(len(body)))
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			assert.Equal(t, []int{200, 409}[i], w.Code)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 3).WithDuplicateStrategy(DuplicateReplay)
+		core, logs := observer.New(zap.InfoLevel)
+		s.logger = zap.New(core)
+
+		w := servePost(ctx, s, `{"body": "a"}`)
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, `{"hit": 1}`, w.Body.String())
+
+		w = servePost(ctx, s, `{"body": "a"}`)
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "true", w.Header().Get("X-Proxy-Replayed"))
+		assert.Equal(t, `{"hit": 1}`, w.Body.String())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+		// the replay keeps the request id of the duplicate
+		processing := logs.FilterMessage("processing").All()
+		assert.Equal(t, processing[len(processing)-1].ContextMap()["X-Proxy-Request-ID"], w.Header().Get("X-Proxy-Request-ID"))
+
+		// the response to another request is never replayed
+		w = servePost(ctx, s, `{"body": "b"}`)
+		assert.Equal(t, `{"hit": 2}`, w.Body.String())
+		assert.Empty(t, w.Header().Get("X-Proxy-Replayed"))
+	})
+
+	t.Run("replay in flight", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 3).WithDuplicateStrategy(DuplicateReplay)
+
+		r := httptest.NewRequest("POST", "/posts", nil)
+		client := s.clientID(r)
+		fp := s.fingerprint.sum(r, s.targetURL, nil)
+		_, proceed := s.checkDuplicate(httptest.NewRecorder(), r, client, fp)
+		assert.True(t, proceed)
+
+		w := httptest.NewRecorder()
+		_, proceed = s.checkDuplicate(w, r, client, fp)
+		assert.False(t, proceed)
+		assert.Equal(t, 409, w.Code)
+	})
+
+	t.Run("delay cancelled", func(t *testing.T) {
+		var hits int32
+		s := newDuplicateTestServer(t, &hits, 10)
+
+		assert.Equal(t, 200, servePost(ctx, s, `{"body": "a"}`).Code)
+
+		cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		servePost(cctx, s, `{"body": "a"}`)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+}
+
+// TestDuplicateEscalation tests the duplicateDelay method on ProxyServer
+func TestDuplicateEscalation(t *testing.T) {
+	ctx := context.Background()
+
+	type unitTestCase struct {
+		maxDelay time.Duration
+		delays   []time.Duration
+	}
+
+	for _, tCase := range []unitTestCase{
+		{maxDelay: 0, delays: []time.Duration{2 * time.Second, 2 * time.Second, 2 * time.Second}},
+		{maxDelay: 10 * time.Second, delays: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}},
+	} {
+		t.Run(fmt.Sprintf("maxDelay=%s", tCase.maxDelay), func(t *testing.T) {
+			s := NewProxyServer(false, "", 2, false, "", false, false, zap.NewNop()).
+				WithDuplicateEscalation(tCase.maxDelay)
+			for _, d := range tCase.delays {
+				assert.Equal(t, d, s.duplicateDelay(ctx, "ip:10.0.0.1"))
+			}
+
+			// a different request resets the escalation
+			if tCase.maxDelay > 0 {
+				s.claimDuplicate(ctx, httptest.NewRequest("POST", "/", nil), "ip:10.0.0.1", "fingerprint")
+				assert.Equal(t, 2*time.Second, s.duplicateDelay(ctx, "ip:10.0.0.1"))
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package proxyserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonschema"
+	"go.uber.org/zap"
+)
+
+// Classes of the errors written to clients, whose status may be overridden with WithErrorStatus.
+const (
+	ErrorInvalidRequest       = "invalid_request"        // malformed request bodies or parameters (400)
+	ErrorRejectedContent      = "rejected_content"       // requests rejected by the `rejectWith` phrase or a blocklist rule (401)
+	ErrorSecretDetected       = "secret_detected"        // request bodies carrying a secret (401)
+	ErrorPolicyDenied         = "policy_denied"          // requests denied by a policy rule (403)
+	ErrorNotFound             = "not_found"              // paths the OpenAPI description does not define (404)
+	ErrorMethodNotAllowed     = "method_not_allowed"     // methods the route, or the OpenAPI description, does not allow (405)
+	ErrorDuplicateRequest     = "duplicate_request"      // consecutive identical requests from the same client (409 or 429)
+	ErrorIdempotencyConflict  = "idempotency_conflict"   // reuses of an Idempotency-Key (409 or 422)
+	ErrorUnsupportedMediaType = "unsupported_media_type" // request bodies whose Content-Type is not supported (415)
+	ErrorSchemaViolation      = "schema_violation"       // request bodies that do not conform to their schema (422)
+	ErrorLimitExceeded        = "limit_exceeded"         // request bodies exceeding a structural JSON limit (413)
+	ErrorRateLimited          = "rate_limited"           // clients exceeding their rate limit (429)
+	ErrorInternal             = "internal_error"         // failures of the proxy itself (500)
+	ErrorBadGateway           = "bad_gateway"            // backend services that cannot be reached, or respond invalidly (502)
+	ErrorUnavailable          = "unavailable"            // shared state that cannot be reached (503)
+)
+
+// errorClasses lists every class of error.
+var errorClasses = []string{
+	ErrorInvalidRequest, ErrorRejectedContent, ErrorSecretDetected, ErrorPolicyDenied, ErrorNotFound, ErrorMethodNotAllowed,
+	ErrorDuplicateRequest, ErrorIdempotencyConflict, ErrorUnsupportedMediaType, ErrorSchemaViolation,
+	ErrorLimitExceeded, ErrorRateLimited, ErrorInternal, ErrorBadGateway, ErrorUnavailable,
+}
+
+// errorTitles are the short, human-readable summaries of the classes of errors.
+var errorTitles = map[string]string{
+	ErrorInvalidRequest:       "Invalid request",
+	ErrorRejectedContent:      "Rejected content",
+	ErrorSecretDetected:       "Secret detected",
+	ErrorPolicyDenied:         "Denied by policy",
+	ErrorNotFound:             "Not found",
+	ErrorMethodNotAllowed:     "Method not allowed",
+	ErrorDuplicateRequest:     "Duplicate request",
+	ErrorIdempotencyConflict:  "Idempotency conflict",
+	ErrorUnsupportedMediaType: "Unsupported media type",
+	ErrorSchemaViolation:      "Schema violation",
+	ErrorLimitExceeded:        "Limit exceeded",
+	ErrorRateLimited:          "Rate limited",
+	ErrorInternal:             "Internal error",
+	ErrorBadGateway:           "Bad gateway",
+	ErrorUnavailable:          "Unavailable",
+}
+
+// DefaultProblemTypeBase prefixes the class of errors to form the type URI of problem details.
+const DefaultProblemTypeBase = "urn:proxy-service:error:"
+
+// proxyError defines an error written to the client.
+type proxyError struct {
+	class      string
+	status     int
+	msg        string
+	rule       string // rule, or detector, that rejected the request, if any
+	violations []jsonschema.Violation
+}
+
+// problemDetails defines an RFC 7807 problem details document, extended with the request ID,
+// the rule that rejected the request and the violations, if any.
+type problemDetails struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail"`
+	Instance   string                 `json:"instance,omitempty"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Rule       string                 `json:"rule,omitempty"`
+	Violations []jsonschema.Violation `json:"violations,omitempty"`
+}
+
+// ruleError defines the rejection of a request by a rule, or detector.
+type ruleError struct {
+	rule   string
+	status int // status the rule rejects requests with, the default of their class when 0
+	msg    string
+}
+
+// Error returns the message of the rejection.
+func (e *ruleError) Error() string {
+	return e.msg
+}
+
+// ParseErrorStatus parses a comma-separated list of error classes, each followed by the status
+// written for errors of that class (e.g., `rejected_content:422,secret_detected:403`).
+func ParseErrorStatus(spec string) (map[string]int, error) {
+	statuses := map[string]int{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.Index(item, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("missing status of error class `%s`", item)
+		}
+		class := strings.TrimSpace(item[:i])
+		known := false
+		for _, c := range errorClasses {
+			known = known || c == class
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown error class `%s`, must be one of '%s'", class, strings.Join(errorClasses, "', '"))
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(item[i+1:]))
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid status of error class `%s` must be between 400 and 599", class)
+		}
+		statuses[class] = status
+	}
+	return statuses, nil
+}
+
+// WithErrorStatus overrides the status written for errors of the given classes. Rules that set
+// a status of their own take precedence.
+func (s *ProxyServer) WithErrorStatus(statuses map[string]int) *ProxyServer {
+	s.errorStatus = statuses
+	return s
+}
+
+// WithErrorTemplate writes errors as the given template rather than as `{"code", "msg"}`.
+func (s *ProxyServer) WithErrorTemplate(t *ErrorTemplate) *ProxyServer {
+	s.errorTemplate = t
+	return s
+}
+
+// WithProblemDetails writes errors as RFC 7807 `application/problem+json` documents rather than
+// as `{"code", "msg"}`. Their type is a stable URI made of typeBase, or DefaultProblemTypeBase when
+// empty, followed by the class of the error (e.g., `urn:proxy-service:error:rejected_content`).
+// An error template set with WithErrorTemplate takes precedence.
+func (s *ProxyServer) WithProblemDetails(typeBase string) *ProxyServer {
+	if typeBase == "" {
+		typeBase = DefaultProblemTypeBase
+	}
+	s.problemTypeBase = typeBase
+	return s
+}
+
+// writeRejection writes the rejection of a request of the given class. Its status is that of the
+// rule that rejected it, if set, or otherwise that of the class, code unless overridden.
+func (s *ProxyServer) writeRejection(w http.ResponseWriter, class string, code int, err error) {
+	e := &proxyError{class: class, status: code, msg: err.Error()}
+	if status, ok := s.errorStatus[class]; ok {
+		e.status = status
+	}
+	var re *ruleError
+	if errors.As(err, &re) {
+		e.rule = re.rule
+		if re.status != 0 {
+			e.status = re.status
+		}
+	}
+	s.writeProxyError(w, e)
+}
+
+// writeProxyError writes and logs an error, as the error template when one is set, as problem
+// details when enabled, or otherwise as the `proxyErrorResponse` struct.
+func (s *ProxyServer) writeProxyError(w http.ResponseWriter, e *proxyError) {
+	codeString := strconv.Itoa(e.status)
+	errJSON := proxyErrorResponse{
+		Code:       codeString,
+		Msg:        e.msg,
+		Violations: e.violations,
+	}
+
+	s.logger.Info("response", zap.String("class", e.class), zap.String("rule", e.rule), zap.Any("error", errJSON))
+
+	reqID := w.Header().Get("X-Proxy-Request-ID")
+	contentType := "application/json"
+	var body interface{} = &errJSON
+	switch {
+	case s.errorTemplate != nil:
+		body = s.errorTemplate.render(map[string]interface{}{
+			"request_id": reqID,
+			"status":     e.status,
+			"code":       codeString,
+			"class":      e.class,
+			"msg":        e.msg,
+			"rule":       e.rule,
+			"timestamp":  time.Now().UTC().Format(time.RFC3339),
+			"violations": violationsOf(e.violations),
+		})
+	case s.problemTypeBase != "":
+		contentType = "application/problem+json"
+		problem := &problemDetails{
+			Type:       s.problemTypeBase + e.class,
+			Title:      errorTitles[e.class],
+			Status:     e.status,
+			Detail:     e.msg,
+			RequestID:  reqID,
+			Rule:       e.rule,
+			Violations: e.violations,
+		}
+		if reqID != "" {
+			problem.Instance = "urn:uuid:" + reqID
+		}
+		body = problem
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		buf = []byte("{\"code\": \"" + codeString + "\", \"msg\": \"There was a response that could not be serialized into JSON\"}")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.WriteHeader(e.status)
+
+	_, writeErr := w.Write(buf)
+	if writeErr != nil {
+		// avoid unnecessary log / stderr messages in the unlikely event `w.Write()` returns an error
+		_ = writeErr
+	}
+}
+
+// violationsOf returns the violations, which are never nil so that they are written as an array.
+func violationsOf(violations []jsonschema.Violation) []jsonschema.Violation {
+	if violations == nil {
+		return []jsonschema.Violation{}
+	}
+	return violations
+}
+
+// templateVariable matches a reference to a variable within the string values of error templates.
+var templateVariable = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// templateVariables lists the variables error templates may reference.
+var templateVariables = []string{"request_id", "status", "code", "class", "msg", "rule", "timestamp", "violations"}
+
+// ErrorTemplate defines the JSON document written for errors, such as a company-wide error
+// envelope. Its string values may reference variables as `{{name}}`: `request_id`, `status`,
+// `code` (the status as a string), `class`, `msg`, `rule`, `timestamp` and `violations`.
+// A string consisting of a single reference is replaced by the value of the variable itself,
+// so that `"{{status}}"` is written as a number and `"{{violations}}"` as an array.
+type ErrorTemplate struct {
+	doc interface{}
+}
+
+// LoadErrorTemplate reads an error template from the given file.
+func LoadErrorTemplate(filename string) (*ErrorTemplate, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseErrorTemplate(buf)
+}
+
+// ParseErrorTemplate parses an error template, which must be a JSON document referencing known
+// variables only.
+func ParseErrorTemplate(data []byte) (*ErrorTemplate, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var err error
+	walkTemplate(doc, func(s string) interface{} {
+		for _, m := range templateVariable.FindAllStringSubmatch(s, -1) {
+			known := false
+			for _, v := range templateVariables {
+				known = known || v == m[1]
+			}
+			if !known && err == nil {
+				err = fmt.Errorf("unknown variable `%s`, must be one of '%s'", m[1], strings.Join(templateVariables, "', '"))
+			}
+		}
+		return s
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ErrorTemplate{doc: doc}, nil
+}
+
+// render returns a copy of the template with its references replaced by the given variables.
+func (t *ErrorTemplate) render(vars map[string]interface{}) interface{} {
+	return walkTemplate(t.doc, func(s string) interface{} {
+		if m := templateVariable.FindStringSubmatch(s); m != nil && m[0] == s {
+			return vars[m[1]]
+		}
+		return templateVariable.ReplaceAllStringFunc(s, func(ref string) string {
+			v := vars[templateVariable.FindStringSubmatch(ref)[1]]
+			if s, ok := v.(string); ok {
+				return s
+			}
+			buf, _ := json.Marshal(v)
+			return string(buf)
+		})
+	})
+}
+
+// walkTemplate returns a copy of v with its string values replaced by fn.
+func walkTemplate(v interface{}, fn func(s string) interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, e := range c {
+			m[k] = walkTemplate(e, fn)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(c))
+		for i, e := range c {
+			a[i] = walkTemplate(e, fn)
+		}
+		return a
+	case string:
+		return fn(c)
+	}
+	return v
+}
@@ -0,0 +1,154 @@
+package proxyserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseErrorStatus tests the ParseErrorStatus function
+func TestParseErrorStatus(t *testing.T) {
+	statuses, err := ParseErrorStatus(" rejected_content:422 , secret_detected:403,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{ErrorRejectedContent: 422, ErrorSecretDetected: 403}, statuses)
+
+	for _, spec := range []string{"rejected_content", "rejected:422", "rejected_content:302", "rejected_content:x"} {
+		_, err := ParseErrorStatus(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestErrorStatus tests the ServeHTTP method on ProxyServer with overridden error statuses
+func TestErrorStatus(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	f, err := filter.New([]filter.Rule{
+		{Name: "forbidden", Phrase: "forbidden_word", Status: 403},
+		{Phrase: "bad_message"},
+	}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+
+	s := newEchoTestServer(t, &hits)
+	s.WithBlocklist(func() *filter.Filter { return f })
+
+	type unitTestCase struct {
+		statuses map[string]int
+		body     string
+		expected int
+	}
+
+	for _, tCase := range []unitTestCase{
+		{body: `{"body": "bad_message"}`, expected: 401},
+		{statuses: map[string]int{ErrorRejectedContent: 422}, body: `{"body": "bad_message"}`, expected: 422},
+		// rules setting a status take precedence over their class
+		{statuses: map[string]int{ErrorRejectedContent: 422}, body: `{"body": "forbidden_word"}`, expected: 403},
+	} {
+		t.Run(fmt.Sprintf("statuses=%v/body=%s", tCase.statuses, tCase.body), func(t *testing.T) {
+			s.WithErrorStatus(tCase.statuses)
+			w := servePost(ctx, s, tCase.body)
+			assert.Equal(t, tCase.expected, w.Code)
+		})
+	}
+}
+
+// TestErrorTemplate tests the ServeHTTP method on ProxyServer with an error template
+func TestErrorTemplate(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	tmpl, err := ParseErrorTemplate([]byte(`{"error": {
+		"id": "{{request_id}}",
+		"status": "{{status}}",
+		"type": "{{class}}",
+		"message": "{{ msg }} ({{rule}})",
+		"time": "{{timestamp}}",
+		"details": "{{violations}}"
+	}}`))
+	assert.NoError(t, err)
+
+	f, err := filter.New([]filter.Rule{{Name: "bad", Phrase: "bad_message"}}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	s := newEchoTestServer(t, &hits).WithErrorTemplate(tmpl)
+	s.WithBlocklist(func() *filter.Filter { return f })
+
+	w := servePost(ctx, s, `{"body": "bad_message"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp struct {
+		Error struct {
+			ID      string        `json:"id"`
+			Status  int           `json:"status"`
+			Type    string        `json:"type"`
+			Message string        `json:"message"`
+			Time    string        `json:"time"`
+			Details []interface{} `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, w.Header().Get("X-Proxy-Request-ID"), resp.Error.ID)
+	assert.NotEmpty(t, resp.Error.ID)
+	assert.Equal(t, 401, resp.Error.Status)
+	assert.Equal(t, ErrorRejectedContent, resp.Error.Type)
+	assert.Equal(t, "rejected by rule `bad` matched within request body (bad)", resp.Error.Message)
+	assert.NotNil(t, resp.Error.Details)
+	_, err = time.Parse(time.RFC3339, resp.Error.Time)
+	assert.NoError(t, err)
+
+	// unknown variables and documents that are not JSON are invalid templates
+	_, err = ParseErrorTemplate([]byte(`{"id": "{{request}}"}`))
+	assert.Error(t, err)
+	_, err = ParseErrorTemplate([]byte(`{{msg}}`))
+	assert.Error(t, err)
+}
+
+// TestProblemDetails tests the ServeHTTP method on ProxyServer with problem details enabled
+func TestProblemDetails(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	f, err := filter.New([]filter.Rule{{Name: "bad", Phrase: "bad_message"}}, textnorm.Normalizer{})
+	assert.NoError(t, err)
+	s := newEchoTestServer(t, &hits).WithProblemDetails("")
+	s.WithBlocklist(func() *filter.Filter { return f })
+
+	w := servePost(ctx, s, `{"body": "bad_message"}`)
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	reqID := w.Header().Get("X-Proxy-Request-ID")
+	assert.JSONEq(t, `{
+		"type": "urn:proxy-service:error:rejected_content",
+		"title": "Rejected content",
+		"status": 401,
+		"detail": "rejected by rule `+"`bad`"+` matched within request body",
+		"instance": "urn:uuid:`+reqID+`",
+		"request_id": "`+reqID+`",
+		"rule": "bad"
+	}`, w.Body.String())
+
+	// the type of problems is made of the base URI and the class of the error
+	s.WithProblemDetails("https://errors.example.com/")
+	s.bodyMethodsOnly = true
+	w = serveGet(s, "/posts")
+	assert.Equal(t, 405, w.Code)
+
+	var problem problemDetails
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "https://errors.example.com/method_not_allowed", problem.Type)
+	assert.Equal(t, "Method not allowed", problem.Title)
+	assert.Equal(t, 405, problem.Status)
+	assert.Empty(t, problem.Rule)
+
+	// every class of error has a title
+	for _, class := range errorClasses {
+		assert.NotEmpty(t, errorTitles[class], class)
+	}
+}
@@ -0,0 +1,140 @@
+package proxyserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonpath"
+)
+
+// DefaultFingerprintHeaders is the subset of common, non-auth, related headers that
+// are part of the fingerprint unless others are configured. `Content-Length` is left out, as
+// JSON bodies differing only in whitespace are the same request.
+var DefaultFingerprintHeaders = []string{
+	"Host",
+	"Accept",
+	"User-Agent",
+	"Connection",
+	"Content-Type",
+	"Accept-Encoding",
+}
+
+// Fingerprint defines the parts of a request that are compared in order to detect
+// consecutive requests. The method, target and path are always part of it.
+type Fingerprint struct {
+	headers    []string
+	query      []string
+	bodyFields []jsonpath.Path
+}
+
+// fingerprintDoc defines the canonical representation of a request that is hashed.
+// It is marshalled into JSON, which sorts map keys.
+type fingerprintDoc struct {
+	Method    string              `json:"method"`
+	TargetURL string              `json:"target_url"`
+	Path      string              `json:"path"`
+	Query     map[string][]string `json:"query"`
+	Header    map[string][]string `json:"header"`
+	Body      json.RawMessage     `json:"body,omitempty"`
+	RawBody   []byte              `json:"raw_body,omitempty"`
+}
+
+// NewFingerprint constructor creates a new Fingerprint made up of the given headers, query
+// parameters and JSON body fields (e.g., `$.user.id`). When no query parameters are given,
+// every query parameter is part of the fingerprint. When no body fields are given, the whole
+// body is. JSON bodies are canonicalized, so that key order and whitespace do not matter.
+func NewFingerprint(headers []string, query []string, bodyFields []string) (*Fingerprint, error) {
+	f := &Fingerprint{query: query}
+	for _, h := range headers {
+		f.headers = append(f.headers, http.CanonicalHeaderKey(h))
+	}
+	for _, expr := range bodyFields {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.bodyFields = append(f.bodyFields, p)
+	}
+	return f, nil
+}
+
+// WithFingerprint sets the parts of a request compared to detect consecutive requests.
+func (s *ProxyServer) WithFingerprint(f *Fingerprint) *ProxyServer {
+	s.fingerprint = f
+	return s
+}
+
+// sum returns a SHA-256 hash of the canonical representation of the request.
+func (f *Fingerprint) sum(r *http.Request, targetURL string, body []byte) string {
+	doc := fingerprintDoc{
+		Method:    r.Method,
+		TargetURL: targetURL,
+		Path:      r.URL.Path,
+		Query:     map[string][]string{},
+		Header:    map[string][]string{},
+	}
+
+	q := r.URL.Query()
+	if len(f.query) == 0 {
+		doc.Query = q
+	}
+	for _, k := range f.query {
+		if vv, ok := q[k]; ok {
+			doc.Query[k] = vv
+		}
+	}
+
+	// `Host` is not part of `r.Header` for incoming requests
+	for _, k := range f.headers {
+		if k == "Host" {
+			doc.Header[k] = []string{r.Host}
+			continue
+		}
+		if vv := r.Header.Values(k); len(vv) > 0 {
+			doc.Header[k] = vv
+		}
+	}
+
+	doc.Body, doc.RawBody = f.canonicalBody(body)
+
+	buf, err := json.Marshal(&doc)
+	if err != nil {
+		// every field is marshallable, but fall back to the raw body regardless
+		buf = append([]byte(r.Method+" "+r.URL.String()+"\n"), body...)
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalBody returns the canonical JSON of the body, or of the configured body fields.
+// Bodies that are not valid JSON are returned raw.
+func (f *Fingerprint) canonicalBody(body []byte) (json.RawMessage, []byte) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil || d.More() {
+		return nil, body
+	}
+
+	var selected interface{} = doc
+	if len(f.bodyFields) > 0 {
+		fields := map[string][]interface{}{}
+		for _, p := range f.bodyFields {
+			fields[p.String()] = p.Select(doc)
+		}
+		selected = fields
+	}
+
+	buf, err := json.Marshal(selected)
+	if err != nil {
+		return nil, body
+	}
+	return buf, nil
+}
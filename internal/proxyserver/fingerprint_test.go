@@ -0,0 +1,121 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFingerprint tests the sum method on Fingerprint
+func TestFingerprint(t *testing.T) {
+
+	type unitTestCase struct {
+		name       string
+		headers    []string
+		query      []string
+		bodyFields []string
+		a, b       *fingerprintRequest
+		same       bool
+	}
+
+	defaults := DefaultFingerprintHeaders
+
+	for _, tCase := range []unitTestCase{
+		{
+			name: "key order and whitespace", headers: defaults, same: true,
+			a: &fingerprintRequest{uri: "/posts", body: `{"a": 1, "b": [1, 2]}`},
+			b: &fingerprintRequest{uri: "/posts", body: `{"b":[1,2],"a":1}`},
+		},
+		{
+			name: "different body", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts", body: `{"a": 1}`},
+			b: &fingerprintRequest{uri: "/posts", body: `{"a": 2}`},
+		},
+		{
+			name: "large numbers", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts", body: `{"a": 9007199254740993}`},
+			b: &fingerprintRequest{uri: "/posts", body: `{"a": 9007199254740992}`},
+		},
+		{
+			name: "raw body", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts", body: `not json`},
+			b: &fingerprintRequest{uri: "/posts", body: `not  json`},
+		},
+		{
+			name: "selected body fields", headers: defaults, bodyFields: []string{"$.user.id"}, same: true,
+			a: &fingerprintRequest{uri: "/posts", body: `{"user": {"id": 1}, "nonce": "a"}`},
+			b: &fingerprintRequest{uri: "/posts", body: `{"user": {"id": 1}, "nonce": "b"}`},
+		},
+		{
+			name: "selected body fields differ", headers: defaults, bodyFields: []string{"$.user.id"}, same: false,
+			a: &fingerprintRequest{uri: "/posts", body: `{"user": {"id": 1}}`},
+			b: &fingerprintRequest{uri: "/posts", body: `{"user": {"id": 2}}`},
+		},
+		{
+			name: "all query parameters", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts?id=1&ts=1"},
+			b: &fingerprintRequest{uri: "/posts?id=1&ts=2"},
+		},
+		{
+			name: "selected query parameters", headers: defaults, query: []string{"id"}, same: true,
+			a: &fingerprintRequest{uri: "/posts?id=1&ts=1"},
+			b: &fingerprintRequest{uri: "/posts?ts=2&id=1"},
+		},
+		{
+			name: "accept encoding", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts", header: map[string]string{"Accept-Encoding": "gzip"}},
+			b: &fingerprintRequest{uri: "/posts", header: map[string]string{"Accept-Encoding": "br"}},
+		},
+		{
+			name: "unselected header", headers: []string{"accept"}, same: true,
+			a: &fingerprintRequest{uri: "/posts", header: map[string]string{"Accept": "*/*", "User-Agent": "a"}},
+			b: &fingerprintRequest{uri: "/posts", header: map[string]string{"Accept": "*/*", "User-Agent": "b"}},
+		},
+		{
+			name: "different path", headers: defaults, same: false,
+			a: &fingerprintRequest{uri: "/posts/1"},
+			b: &fingerprintRequest{uri: "/posts/2"},
+		},
+	} {
+		t.Run(fmt.Sprintf("name=%s/same=%t", tCase.name, tCase.same), func(t *testing.T) {
+			f, err := NewFingerprint(tCase.headers, tCase.query, tCase.bodyFields)
+			assert.NoError(t, err)
+
+			a := f.sum(tCase.a.request(), "http://backend", []byte(tCase.a.body))
+			b := f.sum(tCase.b.request(), "http://backend", []byte(tCase.b.body))
+			assert.Len(t, a, 64)
+			if tCase.same {
+				assert.Equal(t, a, b)
+			} else {
+				assert.NotEqual(t, a, b)
+			}
+		})
+	}
+
+	t.Run("invalid body field", func(t *testing.T) {
+		_, err := NewFingerprint(nil, nil, []string{"$.user["})
+		assert.Error(t, err)
+	})
+}
+
+// fingerprintRequest defines a request used by TestFingerprint.
+type fingerprintRequest struct {
+	uri    string
+	body   string
+	header map[string]string
+}
+
+// request returns the described request.
+func (fr *fingerprintRequest) request() *http.Request {
+	r := httptest.NewRequest("POST", fr.uri, strings.NewReader(fr.body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(fr.body)))
+	for k, v := range fr.header {
+		r.Header.Set(k, v)
+	}
+	return r
+}
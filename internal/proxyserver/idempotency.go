@@ -0,0 +1,130 @@
+package proxyserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// idempotencyStoreTimeout bounds storing the outcome of a request, which must not be cancelled
+// along with the request, lest its key remain in progress for the whole TTL.
+const idempotencyStoreTimeout = 5 * time.Second
+
+// idempotencyRecord defines the stored outcome of a request carrying an `Idempotency-Key` header.
+type idempotencyRecord struct {
+	Fingerprint string           `json:"fingerprint"`
+	Response    *backendResponse `json:"response,omitempty"` // nil while the original request is in flight
+}
+
+// idempotencyClaim defines a key claimed by the first request carrying it.
+type idempotencyClaim struct {
+	key         string // state store key
+	fingerprint string
+}
+
+// WithIdempotency enables `Idempotency-Key` handling for POST and PATCH requests.
+// Responses are stored and replayed to retries for the given TTL.
+func (s *ProxyServer) WithIdempotency(ttl time.Duration) *ProxyServer {
+	s.idempotencyTTL = ttl
+	return s
+}
+
+// idempotencyClient returns the identity of the client that sent the request, along with its
+// `Authorization` header, so that clients never share `Idempotency-Key` values.
+func (s *ProxyServer) idempotencyClient(r *http.Request) string {
+	return s.clientID(r) + "\n" + r.Header.Get("Authorization")
+}
+
+// idempotencyKey returns the state store key for the given `Idempotency-Key` header value sent
+// by the client. The client is hashed, since it may hold credentials.
+func idempotencyKey(client string, key string) string {
+	sum := sha256.Sum256([]byte(client))
+	return "idempotency:" + hex.EncodeToString(sum[:]) + ":" + key
+}
+
+// checkIdempotency handles requests carrying an `Idempotency-Key` header. The first request
+// with a key, per client, is let through and its claim returned so that its response can be stored.
+// Retries with the same request receive the stored response, retries with a different request
+// receive a 422, and retries made while the first request is in flight receive a 409. It returns
+// false when a response has already been written to the client.
+func (s *ProxyServer) checkIdempotency(w http.ResponseWriter, r *http.Request, body []byte) (claim *idempotencyClaim, proceed bool) {
+	if s.idempotencyTTL == 0 || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+		return nil, true
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		return nil, true
+	}
+
+	client := s.idempotencyClient(r)
+	sum := sha256.Sum256([]byte(client + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + string(body)))
+	rec := idempotencyRecord{Fingerprint: hex.EncodeToString(sum[:])}
+	buf, err := json.Marshal(&rec)
+	if err != nil {
+		s.writeError(w, ErrorInternal, 500, "unable to store idempotency record")
+		return nil, false
+	}
+
+	// claim the key, unless a record for it already exists
+	storeKey := idempotencyKey(client, key)
+	claimed, err := s.store.SetNX(r.Context(), storeKey, buf, s.idempotencyTTL)
+	if err == nil && !claimed {
+		buf, err = s.store.Get(r.Context(), storeKey)
+	}
+	if err != nil {
+		s.logger.Error("state store failure", zap.Error(err))
+		s.writeError(w, ErrorUnavailable, 503, "unable to verify Idempotency-Key `"+key+"`")
+		return nil, false
+	}
+	if claimed {
+		return &idempotencyClaim{key: storeKey, fingerprint: rec.Fingerprint}, true
+	}
+
+	var stored idempotencyRecord
+	if err := json.Unmarshal(buf, &stored); err != nil {
+		s.writeError(w, ErrorInternal, 500, "unable to read idempotency record")
+		return nil, false
+	}
+
+	switch {
+	case stored.Fingerprint != rec.Fingerprint:
+		s.writeError(w, ErrorIdempotencyConflict, 422, "Idempotency-Key `"+key+"` was already used with a different request")
+	case stored.Response == nil:
+		s.writeError(w, ErrorIdempotencyConflict, 409, "a request with Idempotency-Key `"+key+"` is still being processed")
+	default:
+		s.logger.Info("replaying stored response", zap.String("Idempotency-Key", key))
+		w.Header().Set("Idempotent-Replayed", "true")
+		s.writeResponse(w, stored.Response, w.Header().Get("X-Proxy-Request-ID"))
+	}
+	return nil, false
+}
+
+// completeIdempotency stores the backend response for the claim returned by `checkIdempotency`.
+// Failed requests release the key so that the client may retry them. The outcome is stored even
+// when the client has disconnected.
+func (s *ProxyServer) completeIdempotency(claim *idempotencyClaim, resp *backendResponse, err error) {
+	if claim == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+	defer cancel()
+	if err != nil || resp.StatusCode >= 500 {
+		if err := s.store.Delete(ctx, claim.key); err != nil {
+			s.logger.Error("state store failure", zap.Error(err))
+		}
+		return
+	}
+
+	buf, err := json.Marshal(&idempotencyRecord{Fingerprint: claim.fingerprint, Response: resp})
+	if err == nil {
+		err = s.store.Set(ctx, claim.key, buf, s.idempotencyTTL)
+	}
+	if err != nil {
+		s.logger.Error("state store failure", zap.Error(err))
+	}
+}
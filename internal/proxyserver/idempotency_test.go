@@ -0,0 +1,147 @@
+package proxyserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestIdempotency tests the handling of requests carrying an `Idempotency-Key` header
+func TestIdempotency(t *testing.T) {
+	var hits int32
+	release := make(chan struct{}, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"id": %d}`, n)
+	}))
+	defer backend.Close()
+
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+		WithIdempotency(time.Hour)
+	core, logs := observer.New(zap.InfoLevel)
+	s.logger = zap.New(core)
+
+	post := func(uri string, key string, body string, auth ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", uri, bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		if len(auth) > 0 {
+			r.Header.Set("Authorization", auth[0])
+		}
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		first := post("/payments", "key-1", `{"amount": 10}`)
+		assert.Equal(t, 201, first.Code)
+		assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+		retry := post("/payments", "key-1", `{"amount": 10}`)
+		assert.Equal(t, 201, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+		// the replay keeps the request id of the retry
+		processing := logs.FilterMessage("processing").All()
+		reqID := processing[len(processing)-1].ContextMap()["X-Proxy-Request-ID"]
+		assert.Equal(t, reqID, retry.Header().Get("X-Proxy-Request-ID"))
+	})
+
+	t.Run("different body", func(t *testing.T) {
+		w := post("/payments", "key-1", `{"amount": 20}`)
+		assert.Equal(t, 422, w.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		post("/payments", "", `{"amount": 10}`)
+		post("/payments", "", `{"amount": 10}`)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("other client", func(t *testing.T) {
+		w := post("/payments", "key-1", `{"amount": 10}`, "Bearer other")
+		assert.Equal(t, 201, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, `{"id": 4}`, w.Body.String())
+	})
+
+	t.Run("in flight", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			post("/slow", "key-2", `{"amount": 10}`)
+			close(done)
+		}()
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 5 }, time.Second, time.Millisecond)
+
+		w := post("/slow", "key-2", `{"amount": 10}`)
+		assert.Equal(t, 409, w.Code)
+
+		release <- struct{}{}
+		<-done
+	})
+}
+
+// contextStore is a memory store that fails writes made with a done context, as networked stores do.
+type contextStore struct {
+	*statestore.MemoryStore
+}
+
+func (c contextStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.MemoryStore.Set(ctx, key, value, ttl)
+}
+
+func (c contextStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.MemoryStore.Delete(ctx, key)
+}
+
+// TestIdempotencyDisconnect tests that a client disconnecting does not leave its key in progress
+func TestIdempotencyDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(201)
+	}))
+	defer backend.Close()
+
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+		WithStateStore(contextStore{statestore.NewMemoryStore(0)}).
+		WithIdempotency(time.Hour)
+
+	post := func(ctx context.Context) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/payments", bytes.NewBufferString(`{"amount": 10}`)).WithContext(ctx)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	post(ctx)
+	assert.Equal(t, 201, post(context.Background()).Code)
+}
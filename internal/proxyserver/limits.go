@@ -0,0 +1,39 @@
+package proxyserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonlimit"
+	"go.uber.org/zap"
+)
+
+// WithJSONLimits enforces structural limits on JSON request bodies, such as their nesting
+// depth, so that pathological documents never reach the JSON parsers of backend services.
+func (s *ProxyServer) WithJSONLimits(l jsonlimit.Limits) *ProxyServer {
+	s.jsonLimits = l
+	return s
+}
+
+// checkJSONLimits checks the request body against the structural limits, which are checked
+// while it is parsed. Bodies exceeding a limit receive a 413 naming the limit, whereas bodies
+// that are not valid JSON are left to the other checks. It returns false when a response has
+// been written.
+func (s *ProxyServer) checkJSONLimits(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if !s.jsonLimits.Enabled() || !hasBody(r, body) {
+		return true
+	}
+
+	var v *jsonlimit.Violation
+	if err := s.jsonLimits.Check(body); !errors.As(err, &v) {
+		return true
+	}
+	metrics.Add("limit_violations", 1)
+	s.logger.Info("request body exceeds a JSON limit", zap.String("limit", v.Limit), zap.Int("max", v.Max), zap.String("path", v.Path))
+	if s.shadowed(r, CheckJSONLimits, v.Limit, false, "reject") {
+		return true
+	}
+	// rejected with `413 PAYLOAD TOO LARGE` unless the status of exceeded limits is overridden
+	s.writeRejection(w, ErrorLimitExceeded, 413, &ruleError{rule: v.Limit, msg: "request body " + v.Error()})
+	return false
+}
@@ -0,0 +1,45 @@
+package proxyserver
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonlimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJSONLimits tests the ServeHTTP method on ProxyServer with structural JSON limits
+func TestJSONLimits(t *testing.T) {
+	ctx := context.Background()
+	var hits int32
+
+	s := newDuplicateTestServer(t, &hits, 0).
+		WithJSONLimits(jsonlimit.Limits{MaxDepth: 4, MaxKeys: 3, MaxArrayLength: 3, MaxStringLength: 8, MaxTokens: 50})
+
+	assert.Equal(t, 200, servePost(ctx, s, `{"a": {"b": [1, 2, 3]}, "c": "short"}`).Code)
+
+	for body, msg := range map[string]string{
+		strings.Repeat(`{"a": `, 1000):     "request body exceeds the `max_depth` limit of 4 at `$.a.a.a.a`",
+		`{"a": 1, "b": 2, "c": 3, "d": 4}`: "request body exceeds the `max_keys` limit of 3 at `$`",
+		`{"items": [1, 2, 3, 4]}`:          "request body exceeds the `max_array_length` limit of 3 at `$.items`",
+		`{"note": "far too long"}`:         "request body exceeds the `max_string_length` limit of 8 at `$.note`",
+	} {
+		w := servePost(ctx, s, body)
+		assert.Equal(t, 413, w.Code)
+		assert.JSONEq(t, `{"code": "413", "msg": "`+msg+`"}`, w.Body.String())
+	}
+
+	// the status of exceeded limits may be overridden, and bodies that are not JSON are left to other checks
+	s.WithErrorStatus(map[string]int{ErrorLimitExceeded: 422})
+	assert.Equal(t, 422, servePost(ctx, s, `{"items": [1, 2, 3, 4]}`).Code)
+	assert.Equal(t, 200, servePost(ctx, s, `not json`).Code)
+
+	// limits are only logged and counted in dry-run mode
+	s.WithDryRun(map[string]bool{CheckJSONLimits: true})
+	before := dryRunCount(CheckJSONLimits)
+	assert.Equal(t, 200, servePost(ctx, s, `{"items": [1, 2, 3, 4, 5]}`).Code)
+	assert.Equal(t, before+1, dryRunCount(CheckJSONLimits))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+}
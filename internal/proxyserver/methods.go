@@ -0,0 +1,156 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// standardMethods lists the methods listed in `Allow` headers when only methods to deny are set,
+// in order. Any other method is allowed as well, unless it is denied.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// bodyMethods lists the methods allowed when `bodyMethodsOnly` is set.
+var bodyMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
+
+// ParseMethods parses a comma-separated list of methods (e.g., `GET, POST`), which are
+// returned in upper case.
+func ParseMethods(spec string) ([]string, error) {
+	var methods []string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		m, err := parseMethod(item)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
+// parseMethod validates a method, which must be an HTTP token, and returns it in upper case.
+func parseMethod(s string) (string, error) {
+	for _, r := range s {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r) {
+			return "", fmt.Errorf("invalid method `%s`", s)
+		}
+	}
+	if s == "" {
+		return "", fmt.Errorf("invalid empty method")
+	}
+	return strings.ToUpper(s), nil
+}
+
+// WithMethods sets the methods allowed, and those denied, on every route. Routes may allow
+// methods in place of allow, and deny methods along with deny. Every method is allowed when
+// allow is empty, unless it is denied.
+func (s *ProxyServer) WithMethods(allow []string, deny []string) *ProxyServer {
+	s.allowMethods = allow
+	s.denyMethods = deny
+	return s
+}
+
+// methodLists returns the methods allowed on the route, empty when any method is, and those
+// denied. The methods allowed by the route replace those allowed by the server, or the methods
+// with a body when `bodyMethodsOnly` is set and no OpenAPI description determines the methods
+// allowed, while the methods denied by either are never allowed.
+func (s *ProxyServer) methodLists(rt *Route) (allow []string, deny []string) {
+	allow = s.allowMethods
+	if len(allow) == 0 && s.bodyMethodsOnly && s.openapi == nil {
+		allow = bodyMethods
+	}
+	deny = s.denyMethods
+	if rt != nil {
+		if len(rt.Methods) > 0 {
+			allow = rt.Methods
+		}
+		deny = append(append([]string{}, deny...), rt.DenyMethods...)
+	}
+	return allow, deny
+}
+
+// allowedMethods returns the methods listed in the `Allow` header of the route, and whether any
+// restriction applies at all. `HEAD` is allowed along with `GET`, and `OPTIONS` is always
+// allowed, since it is answered by the proxy, unless either is denied. When only methods to deny
+// are set, the standard methods that are not denied are listed.
+func (s *ProxyServer) allowedMethods(rt *Route) ([]string, bool) {
+	allow, deny := s.methodLists(rt)
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, false
+	}
+
+	candidates := allow
+	if len(candidates) == 0 {
+		candidates = standardMethods
+	}
+	var allowed []string
+	for _, m := range standardMethods {
+		if containsMethod(candidates, m) || m == http.MethodOptions ||
+			(m == http.MethodHead && containsMethod(candidates, http.MethodGet)) {
+			allowed = append(allowed, m)
+		}
+	}
+	for _, m := range candidates {
+		if !containsMethod(standardMethods, m) {
+			allowed = append(allowed, m)
+		}
+	}
+
+	var methods []string
+	for _, m := range allowed {
+		if !containsMethod(deny, m) {
+			methods = append(methods, m)
+		}
+	}
+	return methods, true
+}
+
+// checkMethod rejects methods not allowed on the route with a 405 and an `Allow` header
+// listing those that are, or the standard ones when only methods to deny are set, and answers `OPTIONS` requests itself, unless the route explicitly
+// allows them, in which case they are forwarded. It returns false when a response has been
+// written.
+func (s *ProxyServer) checkMethod(w http.ResponseWriter, r *http.Request, rt *Route) bool {
+	methods, restricted := s.allowedMethods(rt)
+	if !restricted {
+		return true
+	}
+
+	allow, deny := s.methodLists(rt)
+	allowed := containsMethod(methods, r.Method) || (len(allow) == 0 && !containsMethod(deny, r.Method))
+	if allowed && r.Method == http.MethodOptions && !s.forwardsOptions(rt) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	if allowed || s.shadowed(r, CheckMethod, "", false, "reject") {
+		return true
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	s.writeError(w, ErrorMethodNotAllowed, 405, "`"+r.Method+"` method not allowed, `"+r.URL.Path+"` only supports `"+strings.Join(methods, ", ")+"` requests")
+	return false
+}
+
+// forwardsOptions reports whether `OPTIONS` requests are explicitly allowed on the route, and
+// so forwarded to the backend service rather than answered by the proxy.
+func (s *ProxyServer) forwardsOptions(rt *Route) bool {
+	if rt != nil && len(rt.Methods) > 0 {
+		return containsMethod(rt.Methods, http.MethodOptions)
+	}
+	return containsMethod(s.allowMethods, http.MethodOptions)
+}
+
+// containsMethod reports whether the methods include m.
+func containsMethod(methods []string, m string) bool {
+	for _, e := range methods {
+		if e == m {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package proxyserver
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseMethods tests the ParseMethods function
+func TestParseMethods(t *testing.T) {
+	methods, err := ParseMethods(" get, Post ,PROPFIND,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET", "POST", "PROPFIND"}, methods)
+
+	for _, spec := range []string{"GET POST", "GET;POST", "GÉT"} {
+		_, err := ParseMethods(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestAllowedMethods tests the allowedMethods method on ProxyServer
+func TestAllowedMethods(t *testing.T) {
+
+	type unitTestCase struct {
+		allow           []string
+		deny            []string
+		bodyMethodsOnly bool
+		route           *Route
+		expected        string // expected `Allow` header, empty when no restriction applies
+	}
+
+	for _, tCase := range []unitTestCase{
+		{expected: ""},
+		{bodyMethodsOnly: true, expected: "POST, PUT, PATCH, OPTIONS"},
+		{allow: []string{"GET"}, expected: "GET, HEAD, OPTIONS"},
+		{allow: []string{"POST", "PROPFIND"}, expected: "POST, OPTIONS, PROPFIND"},
+		{deny: []string{"DELETE"}, expected: "GET, HEAD, POST, PUT, PATCH, OPTIONS"},
+		{allow: []string{"GET"}, deny: []string{"HEAD", "OPTIONS"}, expected: "GET"},
+		{bodyMethodsOnly: true, route: &Route{Methods: []string{"GET"}}, expected: "GET, HEAD, OPTIONS"},
+		{allow: []string{"GET", "POST"}, route: &Route{DenyMethods: []string{"POST"}}, expected: "GET, HEAD, OPTIONS"},
+		{route: &Route{Prefix: "/posts"}, expected: ""},
+	} {
+		t.Run(fmt.Sprintf("allow=%v/deny=%v/bmo=%t/route=%v", tCase.allow, tCase.deny, tCase.bodyMethodsOnly, tCase.route), func(t *testing.T) {
+			s := &ProxyServer{bodyMethodsOnly: tCase.bodyMethodsOnly}
+			s.WithMethods(tCase.allow, tCase.deny)
+			methods, restricted := s.allowedMethods(tCase.route)
+			assert.Equal(t, tCase.expected != "", restricted)
+			assert.Equal(t, tCase.expected, strings.Join(methods, ", "))
+		})
+	}
+}
+
+// TestMethods tests the ServeHTTP method on ProxyServer with methods allowed per route
+func TestMethods(t *testing.T) {
+	var hits int32
+	s := newEchoTestServer(t, &hits).
+		WithMethods([]string{"POST", "PUT", "PATCH"}, nil).
+		WithRoutes([]Route{
+			{Prefix: "/posts", Methods: []string{"GET", "POST"}, DenyMethods: []string{"HEAD"}},
+			{Prefix: "/cors", Methods: []string{"GET", "OPTIONS"}},
+		})
+
+	type unitTestCase struct {
+		method string
+		target string
+		code   int
+		allow  string // expected `Allow` header
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "GET", target: "/posts", code: 200},
+		{method: "POST", target: "/posts", code: 200},
+		{method: "DELETE", target: "/posts/1", code: 405, allow: "GET, POST, OPTIONS"},
+		{method: "HEAD", target: "/posts/1", code: 405, allow: "GET, POST, OPTIONS"},
+		{method: "OPTIONS", target: "/posts", code: 204, allow: "GET, POST, OPTIONS"},
+		{method: "GET", target: "/users", code: 405, allow: "POST, PUT, PATCH, OPTIONS"},
+		{method: "PATCH", target: "/users/1", code: 200},
+		{method: "OPTIONS", target: "/users", code: 204, allow: "POST, PUT, PATCH, OPTIONS"},
+		// `OPTIONS` requests explicitly allowed are forwarded
+		{method: "OPTIONS", target: "/cors", code: 200},
+	} {
+		t.Run(fmt.Sprintf("%s %s", tCase.method, tCase.target), func(t *testing.T) {
+			r := httptest.NewRequest(tCase.method, tCase.target, strings.NewReader(""))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			assert.Equal(t, tCase.code, w.Code)
+			assert.Equal(t, tCase.allow, w.Header().Get("Allow"))
+		})
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+
+	w := serveGet(s, "/users")
+	assert.JSONEq(t, `{"code": "405", "msg": "`+"`GET` method not allowed, `/users` only supports `POST, PUT, PATCH, OPTIONS` requests"+`"}`, w.Body.String())
+}
+
+// TestDenyMethods tests the ServeHTTP method on ProxyServer with only methods to deny
+func TestDenyMethods(t *testing.T) {
+	var hits int32
+	s := newEchoTestServer(t, &hits).WithMethods(nil, []string{"DELETE", "TRACE"})
+
+	type unitTestCase struct {
+		method string
+		code   int
+		allow  string // expected `Allow` header
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "GET", code: 200},
+		{method: "PROPFIND", code: 200},
+		{method: "CONNECT", code: 200},
+		{method: "DELETE", code: 405, allow: "GET, HEAD, POST, PUT, PATCH, OPTIONS"},
+		{method: "TRACE", code: 405, allow: "GET, HEAD, POST, PUT, PATCH, OPTIONS"},
+		{method: "OPTIONS", code: 204, allow: "GET, HEAD, POST, PUT, PATCH, OPTIONS"},
+	} {
+		t.Run(tCase.method, func(t *testing.T) {
+			r := httptest.NewRequest(tCase.method, "/posts", strings.NewReader(""))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			assert.Equal(t, tCase.code, w.Code)
+			assert.Equal(t, tCase.allow, w.Header().Get("Allow"))
+		})
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+}
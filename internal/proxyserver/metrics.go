@@ -0,0 +1,14 @@
+package proxyserver
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// metrics holds the counters published by the server under the `proxy` expvar.
+var metrics = expvar.NewMap("proxy")
+
+// MetricsHandler returns a handler that serves the published metrics as JSON.
+func MetricsHandler() http.Handler {
+	return expvar.Handler()
+}
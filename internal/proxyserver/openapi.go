@@ -0,0 +1,120 @@
+package proxyserver
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"go.uber.org/zap"
+)
+
+// WithOpenAPI validates requests against an OpenAPI 3 description of the backend service, which
+// then determines the methods allowed on each path in place of `bodyMethodsOnly`. Responses of
+// the backend are validated as well when validateResponses is set. In report-only mode,
+// violations are logged and counted but requests and responses are not rejected.
+func (s *ProxyServer) WithOpenAPI(doc *openapi.Document, reportOnly bool, validateResponses bool) *ProxyServer {
+	s.openapi = doc
+	s.openapiReportOnly = reportOnly
+	s.validateResponses = validateResponses
+	return s
+}
+
+// findOperation returns the operation of the OpenAPI description matching the request, along
+// with the values of its path parameters. Paths the description does not include receive a 404
+// and methods it does not describe for the path a 405 with an `Allow` header. It returns false
+// when a response has been written.
+func (s *ProxyServer) findOperation(w http.ResponseWriter, r *http.Request) (*openapi.Operation, map[string]string, bool) {
+	if s.openapi == nil {
+		return nil, nil, true
+	}
+
+	op, params, allowed := s.openapi.Find(r.Method, r.URL.Path)
+	if op != nil {
+		return op, params, true
+	}
+	if len(allowed) == 0 {
+		return nil, nil, s.reportOpenAPI(w, r, &openapi.Error{
+			Status: 404,
+			Msg:    "path `" + r.URL.Path + "` is not described by the API",
+		})
+	}
+	if !s.openapiReportOnly {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+	}
+	return nil, nil, s.reportOpenAPI(w, r, &openapi.Error{
+		Status: 405,
+		Msg:    "`" + r.Method + "` method not allowed, `" + r.URL.Path + "` only supports `" + strings.Join(allowed, ", ") + "` requests",
+	})
+}
+
+// validateOperation validates the parameters and body of the request against its operation.
+// It returns false when a response has been written.
+func (s *ProxyServer) validateOperation(w http.ResponseWriter, r *http.Request, op *openapi.Operation, params map[string]string, body []byte) bool {
+	if op == nil {
+		return true
+	}
+	if err := op.ValidateRequest(r, params, body); err != nil {
+		return s.reportOpenAPI(w, r, err)
+	}
+	return true
+}
+
+// checkResponse validates a response of the backend against the operation of the request, then
+// redacts it. Responses that do not conform are replaced by a 502, unless in report-only mode.
+func (s *ProxyServer) checkResponse(op *openapi.Operation, resp *backendResponse, code int, err error) (*backendResponse, int, error) {
+	if err != nil {
+		return resp, code, err
+	}
+	if op != nil && s.validateResponses {
+		// responses are written to the client as JSON, whatever their `Content-Type`
+		if verr := op.ValidateResponse(resp.StatusCode, "application/json", resp.Body); verr != nil {
+			metrics.Add("openapi_violations", 1)
+			s.logger.Warn("response does not conform to the API description",
+				zap.String("operation", op.String()),
+				zap.String("msg", verr.Msg),
+				zap.Any("violations", verr.Violations),
+				zap.Bool("report_only", s.openapiReportOnly))
+			if !s.openapiReportOnly {
+				return nil, verr.Status, errors.New("bad gateway: " + verr.Msg)
+			}
+		}
+	}
+	return s.redactResponse(resp), code, nil
+}
+
+// reportOpenAPI logs and counts a request that does not conform to the OpenAPI description.
+// Unless in report-only mode, the request is rejected with the status of the error.
+// It returns whether the request may proceed.
+func (s *ProxyServer) reportOpenAPI(w http.ResponseWriter, r *http.Request, err *openapi.Error) bool {
+	metrics.Add("openapi_violations", 1)
+	s.logger.Warn("request does not conform to the API description",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", err.Status),
+		zap.String("msg", err.Msg),
+		zap.Any("violations", err.Violations),
+		zap.Bool("report_only", s.openapiReportOnly))
+	if s.openapiReportOnly {
+		return true
+	}
+	s.writeError(w, openapiClass(err.Status), err.Status, err.Msg, err.Violations...)
+	return false
+}
+
+// openapiClass returns the class of errors with the given status reported by the OpenAPI description.
+func openapiClass(status int) string {
+	switch status {
+	case 404:
+		return ErrorNotFound
+	case 405:
+		return ErrorMethodNotAllowed
+	case 415:
+		return ErrorUnsupportedMediaType
+	case 422:
+		return ErrorSchemaViolation
+	case 502:
+		return ErrorBadGateway
+	}
+	return ErrorInvalidRequest
+}
@@ -0,0 +1,119 @@
+package proxyserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDescription = `
+openapi: 3.0.3
+info: {title: Posts, version: "1.0"}
+paths:
+  /posts:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [title]
+              properties:
+                title: {type: string}
+      responses:
+        200:
+          description: created
+          content:
+            application/json:
+              schema: {type: object, required: [hit]}
+  /posts/{id}:
+    get:
+      parameters:
+        - {name: id, in: path, schema: {type: integer}}
+      responses:
+        200:
+          description: post
+          content:
+            application/json:
+              schema: {type: object, required: [id]}
+`
+
+// TestOpenAPI tests the ServeHTTP method on ProxyServer with an OpenAPI description
+func TestOpenAPI(t *testing.T) {
+	doc, err := openapi.Parse([]byte(testDescription))
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		method            string
+		target            string
+		body              string
+		reportOnly        bool
+		validateResponses bool
+		expectedCode      int
+		expectedAllow     string
+		expectedHits      int32
+	}
+
+	for _, tCase := range []unitTestCase{
+		{method: "POST", target: "/posts", body: `{"title": "a"}`, expectedCode: 200, expectedHits: 1},
+		{method: "POST", target: "/posts", body: `{"title": "a"}`, validateResponses: true, expectedCode: 200, expectedHits: 1},
+		{method: "POST", target: "/posts", body: `{"title": 1}`, expectedCode: 422},
+		{method: "POST", target: "/posts", body: ``, expectedCode: 400},
+		{method: "PUT", target: "/posts", body: `{"title": "a"}`, expectedCode: 405, expectedAllow: "POST"},
+		{method: "DELETE", target: "/posts/1", body: `{}`, expectedCode: 405, expectedAllow: "GET, HEAD"},
+		{method: "GET", target: "/comments", expectedCode: 404},
+		{method: "GET", target: "/posts/a", expectedCode: 400},
+		{method: "GET", target: "/posts/1", expectedCode: 200, expectedHits: 1},
+		// the backend responds with `{"hit": 1}`, which lacks the `id` of a post
+		{method: "GET", target: "/posts/1", validateResponses: true, expectedCode: 502, expectedHits: 1},
+		// violations are only reported in report-only mode
+		{method: "POST", target: "/posts", body: `{"title": 1}`, reportOnly: true, expectedCode: 200, expectedHits: 1},
+		{method: "PUT", target: "/posts", body: `{}`, reportOnly: true, expectedCode: 200, expectedHits: 1},
+		{method: "GET", target: "/comments", reportOnly: true, expectedCode: 200, expectedHits: 1},
+		{method: "GET", target: "/posts/1", reportOnly: true, validateResponses: true, expectedCode: 200, expectedHits: 1},
+	} {
+		t.Run(fmt.Sprintf("method=%s,target=%s,body=%s,reportOnly=%v,validateResponses=%v", tCase.method, tCase.target, tCase.body, tCase.reportOnly, tCase.validateResponses), func(t *testing.T) {
+			var hits int32
+			s := newDuplicateTestServer(t, &hits, 0).WithOpenAPI(doc, tCase.reportOnly, tCase.validateResponses)
+
+			r := httptest.NewRequest(tCase.method, tCase.target, bytes.NewBufferString(tCase.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			assert.Equal(t, tCase.expectedCode, w.Code)
+			assert.Equal(t, tCase.expectedAllow, w.Header().Get("Allow"))
+			assert.Equal(t, tCase.expectedHits, atomic.LoadInt32(&hits))
+			if w.Code == 422 {
+				var resp proxyErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Len(t, resp.Violations, 1)
+			}
+		})
+	}
+}
+
+// TestOpenAPIReplacesBodyMethodsOnly tests that the OpenAPI description determines the allowed methods
+func TestOpenAPIReplacesBodyMethodsOnly(t *testing.T) {
+	doc, err := openapi.Parse([]byte(testDescription))
+	assert.NoError(t, err)
+
+	var hits int32
+	s := newDuplicateTestServer(t, &hits, 0)
+	s.bodyMethodsOnly = true
+	s.WithOpenAPI(doc, false, false)
+
+	r := httptest.NewRequest("GET", "/posts/1", nil)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
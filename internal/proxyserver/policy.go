@@ -0,0 +1,84 @@
+package proxyserver
+
+import (
+	"net/http"
+
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
+	"go.uber.org/zap"
+)
+
+// WithPolicy admits, denies, tags or routes requests according to the rules of the policy.
+func (s *ProxyServer) WithPolicy(p *policy.Policy) *ProxyServer {
+	s.policy = p
+	return s
+}
+
+// checkPolicy evaluates the policy against the request and its body. The headers set by rules
+// with the `tag` action are removed from every request first, then requests matching them have a
+// header naming each rule added, and those denied by a rule, or by a rule
+// that could not be evaluated, are rejected.
+// It returns the URL of the backend service the request is forwarded to, which is set by rules
+// with the `route` action, and whether the request may proceed. The matches of rules in dry-run
+// mode, or of every rule when the check runs in dry-run mode, are only logged and counted.
+func (s *ProxyServer) checkPolicy(w http.ResponseWriter, r *http.Request, body []byte) (string, bool) {
+	if s.policy == nil {
+		return s.targetURL, true
+	}
+
+	for _, h := range s.policy.TagHeaders() {
+		r.Header.Del(h)
+	}
+	d := s.policy.Evaluate(r, clientIP(r), body)
+	for _, err := range d.Errors {
+		s.logger.Warn("unable to evaluate policy rule", zap.Error(err))
+	}
+	for _, rule := range d.DryRun {
+		s.shadowed(r, CheckPolicy, rule.Name, true, rule.Action)
+	}
+	if s.dryRunChecks[CheckPolicy] {
+		for _, rule := range d.Tags {
+			s.shadowed(r, CheckPolicy, rule.Name, true, rule.Action)
+		}
+		if d.Rule != nil && d.Failed {
+			s.shadowed(r, CheckPolicy, d.Rule.Name, true, policy.ActionDeny)
+		} else if d.Rule != nil {
+			s.shadowed(r, CheckPolicy, d.Rule.Name, true, d.Rule.Action)
+		}
+		return s.targetURL, true
+	}
+	for _, rule := range d.Tags {
+		s.logger.Info("policy rule matched, tagging request", zap.String("rule", rule.Name))
+		r.Header.Add(rule.Header, rule.Name)
+	}
+	if d.Rule == nil {
+		return s.targetURL, true
+	}
+	if d.Failed {
+		s.logger.Info("policy rule could not be evaluated, denying request", zap.String("rule", d.Rule.Name))
+		metrics.Add("denied_requests", 1)
+		s.writeRejection(w, ErrorPolicyDenied, 403, &ruleError{
+			rule:   d.Rule.Name,
+			status: d.Rule.Status,
+			msg:    "denied by policy rule `" + d.Rule.Name + "`, which could not be evaluated",
+		})
+		return "", false
+	}
+
+	switch d.Rule.Action {
+	case policy.ActionDeny:
+		s.logger.Info("policy rule matched, denying request", zap.String("rule", d.Rule.Name))
+		metrics.Add("denied_requests", 1)
+		s.writeRejection(w, ErrorPolicyDenied, 403, &ruleError{
+			rule:   d.Rule.Name,
+			status: d.Rule.Status,
+			msg:    "denied by policy rule `" + d.Rule.Name + "`",
+		})
+		return "", false
+	case policy.ActionRoute:
+		s.logger.Info("policy rule matched, routing request", zap.String("rule", d.Rule.Name), zap.String("target", d.Rule.Target))
+		metrics.Add("routed_requests", 1)
+		return d.Rule.Target, true
+	}
+	s.logger.Debug("policy rule matched, allowing request", zap.String("rule", d.Rule.Name))
+	return s.targetURL, true
+}
@@ -0,0 +1,80 @@
+package proxyserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPolicy tests the ServeHTTP method on ProxyServer with a policy
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	var hits, betaHits int32
+
+	beta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&betaHits, 1)
+		w.Write([]byte(`{"backend": "beta"}`))
+	}))
+	t.Cleanup(beta.Close)
+
+	p, err := policy.New([]policy.Rule{
+		{Name: "vip", When: `body.vip == true`, Action: policy.ActionTag, Header: filter.DefaultTagHeader},
+		{Name: "beta", When: `body.beta == true`, Action: policy.ActionRoute, Target: beta.URL},
+		{Name: "no-drafts", When: `body.status == 'draft'`},
+		{Name: "no-admins", When: `body.role == 'admin'`, Status: 451},
+		{Name: "small-orders", When: `body.total != null && body.total < 1000`, Action: policy.ActionAllow},
+	})
+	assert.NoError(t, err)
+	s := newEchoTestServer(t, &hits).WithPolicy(p)
+
+	w := servePost(ctx, s, `{"vip": true}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"body": "{\"vip\": true}", "length": "13", "tag": "vip"}`, w.Body.String())
+
+	w = servePost(ctx, s, `{"beta": true}`)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"backend": "beta"}`, w.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&betaHits))
+
+	w = servePost(ctx, s, `{"status": "draft"}`)
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), "denied by policy rule `no-drafts`")
+
+	// rules setting a status take precedence over that of denied requests
+	assert.Equal(t, 451, servePost(ctx, s, `{"role": "admin"}`).Code)
+	s.WithErrorStatus(map[string]int{ErrorPolicyDenied: 404})
+	assert.Equal(t, 404, servePost(ctx, s, `{"status": "draft"}`).Code)
+	s.WithErrorStatus(nil)
+
+	// rules that cannot be evaluated deny requests, whatever their action
+	w = servePost(ctx, s, `{"total": "many"}`)
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), "denied by policy rule `small-orders`, which could not be evaluated")
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// tags sent by clients are removed, so that only those of matching rules reach the backend
+	for _, body := range []string{`{}`, `{"vip": true}`} {
+		r := httptest.NewRequest("POST", "/posts", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Add(filter.DefaultTagHeader, "staff")
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code)
+		var got map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		if body == `{}` {
+			assert.Empty(t, got["tag"])
+		} else {
+			assert.Equal(t, "vip", got["tag"])
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package proxyserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"go.uber.org/zap"
+)
+
+// Rate limit keys, these determine which requests share a token bucket.
+const (
+	RateLimitByIP     = "ip"     // one bucket per client IP address
+	RateLimitByHeader = "header" // one bucket per value of an identifying header (e.g., an API key)
+	RateLimitByRoute  = "route"  // one bucket per route
+)
+
+// rateLimitAttempts bounds the number of times a token is taken when other replicas
+// update the same bucket concurrently.
+const rateLimitAttempts = 10
+
+// tokenBucket defines the state of a single rate limit bucket.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// encode returns the representation of the bucket held in the state store.
+func (b tokenBucket) encode() []byte {
+	return []byte(strconv.FormatFloat(b.tokens, 'g', -1, 64) + " " + strconv.FormatInt(b.last.UnixNano(), 10))
+}
+
+// decodeBucket parses a bucket held in the state store.
+func decodeBucket(buf []byte) (tokenBucket, error) {
+	fields := strings.Fields(string(buf))
+	if len(fields) != 2 {
+		return tokenBucket{}, errors.New("malformed token bucket")
+	}
+	tokens, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return tokenBucket{}, err
+	}
+	last, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return tokenBucket{}, err
+	}
+	return tokenBucket{tokens: tokens, last: time.Unix(0, last)}, nil
+}
+
+// rateLimiter is a token bucket rate limiter. Each bucket holds up to `burst` tokens
+// and is refilled at `rate` tokens per second, every request takes one token.
+// Buckets are held in the state store so that every replica shares them.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	by     string
+	header string
+	now    func() time.Time
+}
+
+// rateLimitResult defines the outcome of taking a token from a bucket.
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int           // whole tokens left in the bucket
+	retryAfter time.Duration // time until a token is available, when not allowed
+	reset      time.Duration // time until the bucket is full again
+}
+
+// WithRateLimit enables token bucket rate limiting. Requests are grouped into buckets
+// according to `by`, one of `RateLimitByIP` (the default), `RateLimitByHeader` or `RateLimitByRoute`.
+// The `header` names the identifying header used with `RateLimitByHeader`.
+func (s *ProxyServer) WithRateLimit(rate float64, burst uint, by string, header string) *ProxyServer {
+	s.rateLimiter = &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		by:     by,
+		header: header,
+		now:    time.Now,
+	}
+	return s
+}
+
+// key returns the bucket key for the request.
+func (l *rateLimiter) key(r *http.Request, rt *Route) string {
+	switch l.by {
+	case RateLimitByHeader:
+		if v := r.Header.Get(l.header); v != "" {
+			return "ratelimit:header:" + v
+		}
+	case RateLimitByRoute:
+		if rt != nil {
+			return "ratelimit:route:" + rt.Prefix
+		}
+		return "ratelimit:route:"
+	}
+	// requests without the identifying header fall back to their IP address
+	return "ratelimit:ip:" + clientIP(r)
+}
+
+// take takes a token from the bucket stored under key. The bucket is updated with a
+// compare-and-swap and expires once it has had time to refill completely, since a full
+// bucket is indistinguishable from a new one.
+func (l *rateLimiter) take(ctx context.Context, st statestore.Store, key string) (rateLimitResult, error) {
+	for i := 0; i < rateLimitAttempts; i++ {
+		now := l.now()
+
+		old, err := st.Get(ctx, key)
+		b := tokenBucket{tokens: l.burst, last: now}
+		switch {
+		case err == nil:
+			if b, err = decodeBucket(old); err != nil {
+				return rateLimitResult{}, err
+			}
+		case errors.Is(err, statestore.ErrNotFound):
+			old = nil
+		default:
+			return rateLimitResult{}, err
+		}
+
+		b.tokens = math.Min(l.burst, b.tokens+math.Max(0, now.Sub(b.last).Seconds())*l.rate)
+		b.last = now
+
+		res := rateLimitResult{allowed: b.tokens >= 1}
+		if res.allowed {
+			b.tokens--
+		} else {
+			res.retryAfter = l.duration(1 - b.tokens)
+		}
+		res.remaining = int(b.tokens)
+		res.reset = l.duration(l.burst - b.tokens)
+
+		swapped, err := st.CompareAndSwap(ctx, key, old, b.encode(), res.reset+time.Second)
+		if err != nil {
+			return rateLimitResult{}, err
+		}
+		if swapped {
+			return res, nil
+		}
+	}
+	return rateLimitResult{}, errors.New("rate limit bucket contention")
+}
+
+// duration returns the time it takes to refill the given number of tokens.
+func (l *rateLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// checkRateLimit takes a token for the request and sets the `RateLimit-*` headers.
+// Limited requests receive a 429 with a `Retry-After` header. It returns false when
+// a response has already been written to the client. When the check runs in dry-run mode,
+// limited requests are only logged and counted, and no header is set.
+func (s *ProxyServer) checkRateLimit(w http.ResponseWriter, r *http.Request, rt *Route) bool {
+	if s.rateLimiter == nil {
+		return true
+	}
+
+	key := s.rateLimiter.key(r, rt)
+	res, err := s.rateLimiter.take(r.Context(), s.store, key)
+	if err != nil {
+		// fail open, an unavailable state store should not take the proxy down
+		s.logger.Error("state store failure", zap.Error(err))
+		return true
+	}
+
+	if s.dryRunChecks[CheckRateLimit] {
+		if !res.allowed {
+			s.shadowed(r, CheckRateLimit, key, false, "reject")
+		}
+		return true
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(int(s.rateLimiter.burst)))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.reset)))
+	if res.allowed {
+		return true
+	}
+
+	s.logger.Info("rate limit exceeded", zap.String("key", key))
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.retryAfter)))
+	s.writeError(w, ErrorRateLimited, 429, "rate limit exceeded, retry in "+strconv.Itoa(ceilSeconds(res.retryAfter))+" second(s)")
+	return false
+}
+
+// ceilSeconds rounds the duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,159 @@
+package proxyserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestTokenBucket tests the take method on rateLimiter
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	st := statestore.NewMemoryStore(0)
+	now := time.Now()
+	l := &rateLimiter{rate: 2, burst: 3, now: func() time.Time { return now }}
+
+	take := func(key string) rateLimitResult {
+		res, err := l.take(ctx, st, key)
+		assert.NoError(t, err)
+		return res
+	}
+
+	// the burst is available immediately
+	for i := 2; i >= 0; i-- {
+		res := take("a")
+		assert.True(t, res.allowed)
+		assert.Equal(t, i, res.remaining)
+	}
+
+	res := take("a")
+	assert.False(t, res.allowed)
+	assert.Equal(t, 500*time.Millisecond, res.retryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.reset)
+
+	// other keys have their own bucket
+	assert.True(t, take("b").allowed)
+
+	// tokens are refilled at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, take("a").allowed)
+	assert.False(t, take("a").allowed)
+
+	// buckets never hold more than the burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, 2, take("a").remaining)
+}
+
+// TestRateLimit tests the ServeHTTP method on ProxyServer with rate limiting
+func TestRateLimit(t *testing.T) {
+
+	type unitTestCase struct {
+		by      string
+		header  string // value of the X-API-Key header of the second request
+		remote  string // remote address of the second request
+		path    string // path of the second request
+		limited bool   // whether the second request is limited
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	for _, tCase := range []unitTestCase{
+		{by: RateLimitByIP, header: "key-1", remote: "10.0.0.1:1234", path: "/posts", limited: true},
+		{by: RateLimitByIP, header: "key-1", remote: "10.0.0.2:1234", path: "/posts", limited: false},
+		{by: RateLimitByHeader, header: "key-1", remote: "10.0.0.2:1234", path: "/posts", limited: true},
+		{by: RateLimitByHeader, header: "key-2", remote: "10.0.0.1:1234", path: "/posts", limited: false},
+		{by: RateLimitByRoute, header: "key-2", remote: "10.0.0.2:1234", path: "/posts/1", limited: true},
+		{by: RateLimitByRoute, header: "key-1", remote: "10.0.0.1:1234", path: "/users", limited: false},
+	} {
+		t.Run(tCase.by+"/"+tCase.header+"/"+tCase.remote+tCase.path, func(t *testing.T) {
+			s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+				WithRoutes([]Route{{Prefix: "/posts"}, {Prefix: "/users"}}).
+				WithRateLimit(0.001, 1, tCase.by, "X-API-Key")
+
+			send := func(key string, remote string, path string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest("GET", path, nil)
+				r.RemoteAddr = remote
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("X-API-Key", key)
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, r)
+				return w
+			}
+
+			w := send("key-1", "10.0.0.1:1234", "/posts")
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+			w = send(tCase.header, tCase.remote, tCase.path)
+			if !tCase.limited {
+				assert.Equal(t, 200, w.Code)
+				return
+			}
+			assert.Equal(t, 429, w.Code)
+			assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+			assert.Equal(t, "1000", w.Header().Get("RateLimit-Reset"))
+		})
+	}
+}
+
+// TestRateLimitMethods tests that requests answered by the method check do not use up tokens
+func TestRateLimitMethods(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+		WithMethods([]string{http.MethodGet}, nil).
+		WithRateLimit(0.001, 1, RateLimitByIP, "")
+
+	send := func(method string) int {
+		r := httptest.NewRequest(method, "/posts", nil)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, 204, send(http.MethodOptions))
+	assert.Equal(t, 405, send(http.MethodDelete))
+	assert.Equal(t, 200, send(http.MethodGet))
+	assert.Equal(t, 429, send(http.MethodGet))
+}
+
+// TestRateLimitReplicas tests that replicas sharing a state store share rate limits
+func TestRateLimitReplicas(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	mr := miniredis.RunT(t)
+	replica := func() *ProxyServer {
+		st, err := statestore.NewRedisStore("redis://" + mr.Addr())
+		assert.NoError(t, err)
+		return NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+			WithStateStore(st).
+			WithRateLimit(0.001, 2, RateLimitByIP, "")
+	}
+	replicas := []*ProxyServer{replica(), replica()}
+
+	for i, code := range []int{200, 200, 429} {
+		r := httptest.NewRequest("GET", "/posts", nil)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		replicas[i%2].ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package proxyserver
+
+import (
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"go.uber.org/zap"
+)
+
+// WithRedactor redacts the bodies of backend responses, so that personal information is
+// neither written to the client nor cached or replayed.
+func (s *ProxyServer) WithRedactor(r *redact.Redactor) *ProxyServer {
+	s.redactor = r
+	return s
+}
+
+// redactResponse returns a redacted copy of a backend response, or the response itself when
+// nothing is redacted. The response is never changed, since coalesced requests share it.
+func (s *ProxyServer) redactResponse(resp *backendResponse) *backendResponse {
+	if !s.redactor.Enabled() {
+		return resp
+	}
+	body, n := s.redactor.Body(resp.Body)
+	if n == 0 {
+		return resp
+	}
+
+	redacted := &backendResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone(), Body: body}
+	redacted.Header.Del("Content-Length")
+	metrics.Add("redacted_values", int64(n))
+	s.logger.Info("redacted response", zap.Int("values", n))
+	return redacted
+}
@@ -0,0 +1,80 @@
+package proxyserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janu-cambrelen/proxy-service/internal/cache"
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestRedaction tests the ServeHTTP method on ProxyServer with a response redactor
+func TestRedaction(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1, "email": "jane@example.com", "password": "hunter2", "bio": "call 555-123-4567"}`))
+	}))
+	t.Cleanup(backend.Close)
+
+	r, err := redact.New("", []string{"$.email"}, []string{"$.password"}, []string{"phone"})
+	assert.NoError(t, err)
+
+	c := cache.New(cache.NewMemoryStorage(), time.Minute, 0, 0)
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).WithRedactor(r).WithCache(c)
+
+	expected := `{"id": 1, "email": "[REDACTED]", "bio": "call [REDACTED]"}`
+	w := serveGet(s, "/users/1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, expected, w.Body.String())
+
+	// the cached copy is redacted as well
+	w = serveGet(s, "/users/1")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, expected, w.Body.String())
+
+	w = servePost(context.Background(), s, `{}`)
+	assert.JSONEq(t, expected, w.Body.String())
+}
+
+// TestRedactionCoalesced tests that concurrent coalesced requests each receive a redacted
+// response without racing on the response they share (run with `-race`)
+func TestRedactionCoalesced(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Length", "49")
+		w.Write([]byte(`{"id": 1, "email": "jane@example.com", "n": 1234}`))
+	}))
+	t.Cleanup(backend.Close)
+
+	r, err := redact.New("", []string{"$.email"}, nil, nil)
+	assert.NoError(t, err)
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+		WithRedactor(r).
+		WithRoutes([]Route{{Prefix: "/users", Coalesce: true}})
+
+	const n = 20
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = serveGet(s, "/users/1").Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, body := range bodies {
+		assert.JSONEq(t, `{"id": 1, "email": "[REDACTED]", "n": 1234}`, body)
+	}
+	assert.Less(t, atomic.LoadInt32(&hits), int32(n))
+}
@@ -0,0 +1,98 @@
+package proxyserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonschema"
+)
+
+// Route defines settings that apply to requests whose path falls under Prefix.
+// When several routes match a request, the route with the longest prefix is used.
+type Route struct {
+	Prefix       string   `json:"prefix"`        // path prefix, matched on segment boundaries (e.g., `/posts` matches `/posts/1` but not `/postsx`)
+	Coalesce     bool     `json:"coalesce"`      // whether identical concurrent safe requests share a single backend request
+	Schema       string   `json:"schema"`        // path to a JSON Schema file request bodies must conform to, relative to the routes file
+	Methods      []string `json:"methods"`       // methods allowed, in place of those allowed by the server (e.g., `["GET", "POST"]`)
+	DenyMethods  []string `json:"deny_methods"`  // methods denied, along with those denied by the server
+	ContentTypes []string `json:"content_types"` // media types of the request bodies accepted, in place of those accepted by the server (e.g., `["application/*+json"]`)
+
+	schema *jsonschema.Schema
+}
+
+// LoadRoutes reads a JSON array of routes from the given file and compiles the JSON Schemas they reference.
+func LoadRoutes(filename string) ([]Route, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	if err := json.Unmarshal(buf, &routes); err != nil {
+		return nil, err
+	}
+
+	for i, rt := range routes {
+		if !strings.HasPrefix(rt.Prefix, "/") {
+			return nil, fmt.Errorf("prefix of route %d must start with `/`", i)
+		}
+		for j, m := range rt.Methods {
+			if routes[i].Methods[j], err = parseMethod(m); err != nil {
+				return nil, fmt.Errorf("methods of route %d: %s", i, err.Error())
+			}
+		}
+		for j, m := range rt.DenyMethods {
+			if routes[i].DenyMethods[j], err = parseMethod(m); err != nil {
+				return nil, fmt.Errorf("deny methods of route %d: %s", i, err.Error())
+			}
+		}
+		for j, ct := range rt.ContentTypes {
+			if routes[i].ContentTypes[j], err = parseMediaRange(ct); err != nil {
+				return nil, fmt.Errorf("content types of route %d: %s", i, err.Error())
+			}
+		}
+		if rt.Schema != "" {
+			path := rt.Schema
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			if routes[i].schema, err = jsonschema.Load(path); err != nil {
+				return nil, fmt.Errorf("schema of route %d: %s", i, err.Error())
+			}
+		}
+	}
+	return routes, nil
+}
+
+// WithRoutes sets the per-route settings used by the server.
+func (s *ProxyServer) WithRoutes(routes []Route) *ProxyServer {
+	s.routes = routes
+	return s
+}
+
+// route returns the route with the longest prefix matching the given path, or nil.
+func (s *ProxyServer) route(path string) *Route {
+	var match *Route
+	for i := range s.routes {
+		rt := &s.routes[i]
+		if !matchPrefix(rt.Prefix, path) {
+			continue
+		}
+		if match == nil || len(rt.Prefix) > len(match.Prefix) {
+			match = rt
+		}
+	}
+	return match
+}
+
+// matchPrefix reports whether path falls under prefix on a segment boundary.
+func matchPrefix(prefix string, path string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,82 @@
+package proxyserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRoute tests the route method on ProxyServer
+func TestRoute(t *testing.T) {
+
+	type unitTestCase struct {
+		path   string
+		prefix string // expected prefix, empty when no route matches
+	}
+
+	server := &ProxyServer{routes: []Route{
+		{Prefix: "/posts"},
+		{Prefix: "/posts/1/comments/"},
+		{Prefix: "/users"},
+	}}
+
+	for _, tCase := range []unitTestCase{
+		{path: "/posts", prefix: "/posts"},
+		{path: "/posts/1", prefix: "/posts"},
+		{path: "/posts/1/comments", prefix: "/posts/1/comments/"},
+		{path: "/posts/1/comments/2", prefix: "/posts/1/comments/"},
+		{path: "/postsx", prefix: ""},
+		{path: "/comments", prefix: ""},
+	} {
+		t.Run(tCase.path, func(t *testing.T) {
+			rt := server.route(tCase.path)
+			if tCase.prefix == "" {
+				assert.Nil(t, rt)
+				return
+			}
+			assert.Equal(t, tCase.prefix, rt.Prefix)
+		})
+	}
+}
+
+// TestLoadRoutes tests the LoadRoutes function
+func TestLoadRoutes(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	assert.NoError(t, os.WriteFile(valid, []byte(`[{"prefix": "/posts", "coalesce": true}]`), 0o600))
+	routes, err := LoadRoutes(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{Prefix: "/posts", Coalesce: true}}, routes)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`[{"prefix": "posts"}]`), 0o600))
+	_, err = LoadRoutes(invalid)
+	assert.Error(t, err)
+
+	types := filepath.Join(dir, "types.json")
+	assert.NoError(t, os.WriteFile(types, []byte(`[{"prefix": "/posts", "content_types": ["Application/*+JSON; charset=utf-8"]}]`), 0o600))
+	routes, err = LoadRoutes(types)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"application/*+json"}, routes[0].ContentTypes)
+
+	assert.NoError(t, os.WriteFile(invalid, []byte(`[{"prefix": "/posts", "content_types": ["json"]}]`), 0o600))
+	_, err = LoadRoutes(invalid)
+	assert.Error(t, err)
+
+	methods := filepath.Join(dir, "methods.json")
+	assert.NoError(t, os.WriteFile(methods, []byte(`[{"prefix": "/posts", "methods": ["get", "POST"], "deny_methods": ["delete"]}]`), 0o600))
+	routes, err = LoadRoutes(methods)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET", "POST"}, routes[0].Methods)
+	assert.Equal(t, []string{"DELETE"}, routes[0].DenyMethods)
+
+	assert.NoError(t, os.WriteFile(invalid, []byte(`[{"prefix": "/posts", "methods": ["GET POST"]}]`), 0o600))
+	_, err = LoadRoutes(invalid)
+	assert.Error(t, err)
+
+	_, err = LoadRoutes(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package proxyserver
+
+import (
+	"net/http"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonschema"
+)
+
+// hasBody reports whether the request is expected to carry a body. Requests with other methods
+// are only validated when they carry one.
+func hasBody(r *http.Request, body []byte) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return len(body) > 0
+}
+
+// validateSchema validates the request body against the JSON Schema of the route, if any.
+// Bodies that are not valid JSON receive a 400 and bodies that do not conform to the schema
+// receive a 422 listing every violation. It returns false when a response has been written.
+func (s *ProxyServer) validateSchema(w http.ResponseWriter, r *http.Request, rt *Route, body []byte) bool {
+	if rt == nil || rt.schema == nil || !hasBody(r, body) {
+		return true
+	}
+
+	doc, err := jsonschema.Decode(body)
+	if err != nil {
+		s.writeError(w, ErrorInvalidRequest, 400, "request body is not valid JSON: "+err.Error())
+		return false
+	}
+	if violations := rt.schema.Validate(doc); len(violations) > 0 {
+		s.writeError(w, ErrorSchemaViolation, 422, "request body does not conform to the schema of the route", violations...)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package proxyserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSchemaValidation tests the ServeHTTP method on ProxyServer with a route referencing a JSON Schema
+func TestSchemaValidation(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "schemas"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "schemas", "post.json"), []byte(`{
+		"type": "object",
+		"required": ["title", "userId"],
+		"properties": {"title": {"type": "string"}, "userId": {"type": "integer"}}
+	}`), 0o600))
+	routesFile := filepath.Join(dir, "routes.json")
+	assert.NoError(t, os.WriteFile(routesFile, []byte(`[{"prefix": "/posts", "schema": "schemas/post.json"}]`), 0o600))
+
+	routes, err := LoadRoutes(routesFile)
+	assert.NoError(t, err)
+
+	var hits int32
+	s := newDuplicateTestServer(t, &hits, 0).WithRoutes(routes)
+
+	send := func(method string, uri string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, uri, bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, 200, send("POST", "/posts", `{"title": "a", "userId": 1}`).Code)
+
+	w := send("POST", "/posts", `{"title": 1}`)
+	assert.Equal(t, 422, w.Code)
+	var resp proxyErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "422", resp.Code)
+	assert.Len(t, resp.Violations, 2)
+	assert.Equal(t, "$", resp.Violations[0].Path)
+	assert.Equal(t, "required", resp.Violations[0].Keyword)
+	assert.Equal(t, "$.title", resp.Violations[1].Path)
+	assert.Equal(t, "type", resp.Violations[1].Keyword)
+
+	assert.Equal(t, 400, send("PUT", "/posts/1", `{"title": `).Code)
+	assert.Equal(t, 400, send("POST", "/posts", ``).Code)
+
+	// requests without a body, or to other routes, are not validated
+	assert.Equal(t, 200, send("GET", "/posts/1", ``).Code)
+	assert.Equal(t, 200, send("POST", "/comments", `{}`).Code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	// a route referencing an invalid schema fails to load
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "schemas", "post.json"), []byte(`{"type": "text"}`), 0o600))
+	_, err = LoadRoutes(routesFile)
+	assert.Error(t, err)
+}
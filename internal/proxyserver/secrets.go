@@ -0,0 +1,45 @@
+package proxyserver
+
+import (
+	"net/http"
+
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"go.uber.org/zap"
+)
+
+// WithSecretScanner scans request bodies for credentials and sensitive data, such as AWS keys,
+// private keys, JWTs or card numbers, before they are forwarded to the backend.
+func (s *ProxyServer) WithSecretScanner(sc *redact.Scanner) *ProxyServer {
+	s.secretScanner = sc
+	return s
+}
+
+// scanSecrets scans the request body for secrets and returns the body to forward, in which the
+// secrets found by detectors with the `redact` action are masked. Secrets found by detectors
+// with the `block` action are returned as an error naming the detector. Findings are logged
+// by detector, position and fingerprint, never echoing the secret itself. When the check runs in
+// dry-run mode, the body is forwarded as it is.
+func (s *ProxyServer) scanSecrets(r *http.Request, b string) (string, error) {
+	body, findings := s.secretScanner.Scan(b)
+	blocked := ""
+	for _, f := range findings {
+		s.logger.Warn("secret found within request body",
+			zap.String("detector", f.Detector),
+			zap.String("action", f.Action),
+			zap.Int("offset", f.Offset),
+			zap.Int("length", f.Length),
+			zap.String("fingerprint", f.Fingerprint),
+		)
+		if f.Action == redact.ActionBlock && blocked == "" {
+			blocked = f.Detector
+		}
+	}
+	metrics.Add("secrets_found", int64(len(findings)))
+	if len(findings) > 0 && s.shadowed(r, CheckSecrets, findings[0].Detector, false, findings[0].Action) {
+		return b, nil
+	}
+	if blocked != "" {
+		return "", &ruleError{rule: blocked, msg: "rejected because a secret (`" + blocked + "`) was found within request body"}
+	}
+	return body, nil
+}
@@ -2,7 +2,6 @@ package proxyserver
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,12 +9,19 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/janu-cambrelen/proxy-service/internal/cache"
+	"github.com/janu-cambrelen/proxy-service/internal/filter"
+	"github.com/janu-cambrelen/proxy-service/internal/jsonlimit"
+	"github.com/janu-cambrelen/proxy-service/internal/jsonschema"
+	"github.com/janu-cambrelen/proxy-service/internal/openapi"
+	"github.com/janu-cambrelen/proxy-service/internal/policy"
+	"github.com/janu-cambrelen/proxy-service/internal/redact"
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
 	"go.uber.org/zap"
 )
 
@@ -29,36 +35,58 @@ type ProxyServer struct {
 	rejectExact       bool
 	rejectInsensitive bool
 	logger            *zap.Logger
-	priorRequest      RequestCopy
+	store             statestore.Store
+	cache             *cache.Cache
+	routes            []Route
+	coalescer         coalescer
+	idempotencyTTL    time.Duration
+	rateLimiter       *rateLimiter
+	clientIDHeader    string
+	priorRequestTTL   time.Duration
+	fingerprint       *Fingerprint
+	duplicateStrategy string
+	duplicateMaxDelay time.Duration
+	blocklist         func() *filter.Filter
+	normalizer        textnorm.Normalizer
+	openapi           *openapi.Document
+	openapiReportOnly bool
+	validateResponses bool
+	redactor          *redact.Redactor
+	secretScanner     *redact.Scanner
+	errorStatus       map[string]int
+	errorTemplate     *ErrorTemplate
+	problemTypeBase   string
+	policy            *policy.Policy
+	dryRunChecks      map[string]bool
+	rejectFilter      *filter.Filter
+	rejectValues      *filter.Filter
+	rejectAction      string
+	rejectReplacement string
+	rejectIn          []string
+	rejectHeaders     []string
+	jsonLimits        jsonlimit.Limits
+	contentTypes      []string
+	skipBodyless      bool
+	validateJSON      bool
+	allowMethods      []string
+	denyMethods       []string
 }
 
-// RequestCopy defines a request representation that is used to compare requests.
-// The values are captured from incoming HTTP requests.
-type RequestCopy struct {
-	Method    string
-	TargetURL string
-	TargetURI string
-	Header    headerCopy
-	Body      []byte
-}
+// defaultPriorRequestTTL is how long the prior request of each client is remembered by default.
+const defaultPriorRequestTTL = time.Minute
 
-// headerCopy defines a subset of common, non-auth, related headers.
-// These headers will be used when comparing two requests.
-// The values are captured from incoming HTTP request headers.
-type headerCopy struct {
-	Host           []string
-	Accept         []string
-	UserAgent      []string
-	Connection     []string
-	ContentType    []string
-	ContentLength  []string
-	AcceptEncoding []string
+// backendResponse defines a buffered response from the backend service.
+type backendResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
 }
 
 // proxyErrorResponse defines a server error that is marshalled into JSON and returned to the client.
 type proxyErrorResponse struct {
-	Code string `json:"code"`
-	Msg  string `json:"msg"`
+	Code       string                 `json:"code"`
+	Msg        string                 `json:"msg"`
+	Violations []jsonschema.Violation `json:"violations,omitempty"`
 }
 
 // NewProxyServer constructor creates a new ProxyServer.
@@ -71,7 +99,6 @@ func NewProxyServer(
 	re bool,
 	ri bool,
 	l *zap.Logger,
-	pr RequestCopy,
 ) *ProxyServer {
 	s := &ProxyServer{
 		debug:             d,
@@ -82,38 +109,72 @@ func NewProxyServer(
 		rejectExact:       re,
 		rejectInsensitive: ri,
 		logger:            l,
-		priorRequest:      pr,
+		store:             statestore.NewMemoryStore(statestore.DefaultMemoryStoreMaxItems),
+		priorRequestTTL:   defaultPriorRequestTTL,
+		fingerprint:       &Fingerprint{headers: DefaultFingerprintHeaders},
 	}
+	s.compileRejectValues()
+	return s
+}
+
+// WithStateStore sets the store holding the state shared by every replica of the server,
+// such as rate limit buckets, idempotency records and the prior request of each client.
+// By default, the state is held in a bounded in-memory store.
+func (s *ProxyServer) WithStateStore(st statestore.Store) *ProxyServer {
+	s.store = st
+	return s
+}
+
+// WithNormalizer sets how request bodies and the `rejectWith` phrase are normalized before
+// they are compared. By default, they are compared as they are.
+func (s *ProxyServer) WithNormalizer(n textnorm.Normalizer) *ProxyServer {
+	s.normalizer = n
+	s.compileRejectValues()
+	return s
+}
+
+// WithCache enables response caching for safe requests using the given cache.
+func (s *ProxyServer) WithCache(c *cache.Cache) *ProxyServer {
+	s.cache = c
 	return s
 }
 
 // ServeHTTP is the main handler used by the server.
 func (s *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// validate request method
-	if s.bodyMethodsOnly {
-		methodAllowed := false
-		allowedMethods := [3]string{"POST", "PUT", "PATCH"}
-		for _, m := range allowedMethods {
-			if m == r.Method {
-				methodAllowed = true
-			}
-		}
-		if !methodAllowed {
-			s.writeError(w, 405, "`"+r.Method+"` method not allowed, this proxy server only supports `POST, PUT, PATCH` requests")
-			return
-		}
+	// create a request id that is set to the `X-Proxy-Request-ID` header of every response
+	reqID := uuid.NewString()
+	w.Header().Set("X-Proxy-Request-ID", reqID)
+	s.logger.Info("processing", zap.String("X-Proxy-Request-ID", reqID))
+
+	// settings of the route matching the path requested by the client
+	rt := s.route(r.URL.Path)
+
+	// validate request method against the methods allowed on the route, answering `OPTIONS` requests
+	// before the rate limit, so that neither uses up the tokens of the client
+	if !s.checkMethod(w, r, rt) {
+		return
+	}
+
+	// limit the rate of requests per client, API key or route
+	if !s.checkRateLimit(w, r, rt) {
+		return
 	}
 
-	// validate content type
-	if r.Header.Get("Content-Type") != "application/json" {
-		s.writeError(w, 415, "Content-Type header must be `application/json`")
+	// find the operation of the OpenAPI description matching the request
+	op, params, proceed := s.findOperation(w, r)
+	if !proceed {
+		return
+	}
+
+	// validate content type against the media types accepted by the route
+	if !s.checkContentType(w, r, rt) {
 		return
 	}
 
 	// create identical ReadClosers from request body
 	r1, r2, err := s.copyBody(r.Body)
 	if err != nil {
-		s.writeError(w, 400, "invalid request body")
+		s.writeError(w, ErrorInvalidRequest, 400, "invalid request body")
 		return
 	}
 
@@ -123,66 +184,131 @@ func (s *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// create a byte array representation of the original request body
 	cb, err := io.ReadAll(r2)
 	if err != nil {
-		s.writeError(w, 400, "invalid request body")
+		s.writeError(w, ErrorInvalidRequest, 400, "invalid request body")
+		return
+	}
+
+	// reject bodies exceeding the structural JSON limits before they are parsed by any other check
+	if !s.checkJSONLimits(w, r, cb) {
+		return
+	}
+
+	// reject bodies of JSON media types that are not well-formed JSON
+	if !s.checkJSONBody(w, r, cb) {
+		return
+	}
+
+	// allow, deny, tag or route the request according to the rules of the policy
+	target, proceed := s.checkPolicy(w, r, cb)
+	if !proceed {
+		return
+	}
+
+	// validate the request body against the JSON Schema of the route
+	if !s.validateSchema(w, r, rt, cb) {
+		return
+	}
+
+	// validate the parameters and body of the request against the OpenAPI description
+	if !s.validateOperation(w, r, op, params, cb) {
 		return
 	}
 
 	// reject requests with the word/phrase within the string value of `s.RejectWith`
 	// whether the check is "exact" or "contains" is determined by the `s.RejectExact` boolean
 	// please refer to the method's documentation for additional context
-	if s.rejectWith != "" {
+	// unless a `WithRejectAction` rewrites or tags such requests instead
+	if s.rejectWith != "" && s.rejectFilter == nil {
 		err = s.validateRequestBody(string(cb))
+		if err != nil && !s.shadowed(r, CheckReject, s.rejectWith, false, "reject") {
+			// rejected with `401 UNAUTHORIZED` unless the status of rejected content is overridden
+			s.writeRejection(w, ErrorRejectedContent, 401, err)
+			return
+		}
+	}
+	if s.rejectFilter != nil {
+		body, err := s.applyRules(r, s.rejectFilter, CheckReject, string(cb))
+		if err != nil {
+			s.writeRejection(w, ErrorRejectedContent, 401, err)
+			return
+		}
+		cb = replaceBody(r, cb, body)
+	}
+	// and within the values of JSON bodies, where escape sequences may hide the phrase
+	if s.rejectValues != nil && hasJSONBody(r) {
+		body, err := s.applyRules(r, s.rejectValues, CheckReject, string(cb))
 		if err != nil {
-			// consider whether `400 BAD REQUEST` or `422 UNPROCESSABLE ENTITY`
-			// is more fitting than `401 UNAUTHORIZED`
-			s.writeError(w, 401, err.Error())
+			s.writeRejection(w, ErrorRejectedContent, 401, err)
 			return
 		}
+		cb = replaceBody(r, cb, body)
 	}
 
-	// delay response for consecutive requests
-	ch := s.copyHeader(r.Header)
+	// block requests carrying credentials, or redact them
+	if s.secretScanner.Enabled() {
+		body, err := s.scanSecrets(r, string(cb))
+		if err != nil {
+			s.writeRejection(w, ErrorSecretDetected, 401, err)
+			return
+		}
+		cb = replaceBody(r, cb, body)
+	}
 
-	pr := s.priorRequest
-	cr := RequestCopy{
-		Method:    r.Method,
-		TargetURL: s.targetURL,
-		TargetURI: r.RequestURI,
-		Header:    ch,
-		Body:      cb,
+	// reject, rewrite or tag requests matching the rules of the blocklist
+	if s.blocklist != nil {
+		body, err := s.checkBlocklist(r, string(cb))
+		if err != nil {
+			s.writeRejection(w, ErrorRejectedContent, 401, err)
+			return
+		}
+		cb = replaceBody(r, cb, body)
 	}
 
-	if cmp.Equal(pr, cr) {
-		d := time.Duration(s.requestDelay * uint(time.Second))
-		s.logger.Info("consecutive requests detected, delaying response", zap.Any("seconds", s.requestDelay))
-		time.Sleep(d)
+	// replay or reject retries of requests carrying an `Idempotency-Key` header
+	idem, proceed := s.checkIdempotency(w, r, cb)
+	if !proceed {
+		return
 	}
 
-	s.priorRequest = cr
+	// delay, reject or replay consecutive identical requests from the same client
+	client := s.clientID(r)
+	dup, proceed := s.checkDuplicate(w, r, client, s.fingerprint.sum(r, target, cb))
+	if !proceed {
+		// release the Idempotency-Key, since the request was not proxied
+		s.completeIdempotency(idem, nil, errDuplicate)
+		return
+	}
 
 	// prepare request to hit backend service
-	req, err := s.prepareRequest(r)
+	req, err := s.prepareRequest(r, target)
 	if err != nil {
 		// although the url is already validated in the `Config.validate()` method
 		// an additional parse attempt takes place within the the `prepareRequest`
 		// method. A 500 is returned since target url is not something the client
 		// is able to provide.
-		s.writeError(w, 500, err.Error())
+		s.completeIdempotency(idem, nil, err)
+		s.completeDuplicate(r.Context(), dup, nil, err)
+		s.writeError(w, ErrorInternal, 500, err.Error())
 		return
 	}
 
-	// create a request id that will be set to the `X-Proxy-Request-ID` response
-	reqID := uuid.NewString()
-	s.logger.Info("processing", zap.String("X-Proxy-Request-ID", reqID))
+	// serve cacheable requests through the response cache
+	if s.cache != nil && isCacheable(req) {
+		s.serveCached(w, req, rt, op, cb, reqID)
+		return
+	}
 
 	// make request backend service and write the result to the client
-	code, err := s.requestBackendService(w, req, reqID)
+	resp, code, err := s.fetch(req, rt, cb)
+	resp, code, err = s.checkResponse(op, resp, code, err)
+	s.completeIdempotency(idem, resp, err)
+	s.completeDuplicate(r.Context(), dup, resp, err)
 	// the status code is only intended for use when the server encounters an error
 	if err != nil {
-		s.writeError(w, code, err.Error())
+		s.writeError(w, ErrorBadGateway, code, err.Error())
 		return
 	}
-
+	s.writeResponse(w, resp, reqID)
 }
 
 // WithRequestLoggerMiddleware is "middleware" that logs every request
@@ -190,7 +316,7 @@ func (s *ProxyServer) WithRequestLoggerMiddleware() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rLog, err := httputil.DumpRequest(r, true)
 		if err != nil {
-			s.writeError(w, 400, "bad request")
+			s.writeError(w, ErrorInvalidRequest, 400, "bad request")
 			return
 		}
 
@@ -210,6 +336,13 @@ func (s *ProxyServer) validateRequestBody(b string) error {
 		b = strings.ToLower(b)
 		v = strings.ToLower(v)
 	}
+	phrase := v
+
+	// normalize both, so that visually equivalent text cannot evade the validation
+	if s.normalizer.Enabled() {
+		b = s.normalizer.String(b)
+		v = s.normalizer.String(v)
+	}
 
 	// general contains case
 	invalid := []string{v}
@@ -225,7 +358,7 @@ func (s *ProxyServer) validateRequestBody(b string) error {
 
 	for _, c := range invalid {
 		if strings.Contains(b, c) {
-			return errors.New("rejected because `" + v + "` found within request body")
+			return errors.New("rejected because `" + phrase + "` found within request body")
 		}
 	}
 
@@ -233,10 +366,10 @@ func (s *ProxyServer) validateRequestBody(b string) error {
 }
 
 // prepareRequest modifies the client's request and routes URLs to the scheme,
-// host, and base path provided in target. If the target's path is "/base" and
+// host, and base path provided in targetURL. If the target's path is "/base" and
 // the incoming request was for "/dir", the target request will be for /base/dir.
-func (s *ProxyServer) prepareRequest(r *http.Request) (*http.Request, error) {
-	target, err := url.Parse(s.targetURL)
+func (s *ProxyServer) prepareRequest(r *http.Request, targetURL string) (*http.Request, error) {
+	target, err := url.Parse(targetURL)
 	if err != nil {
 		return nil, errors.New("unable to parse target url")
 	}
@@ -307,55 +440,56 @@ func (s *ProxyServer) sanitizeHeader(r *http.Request) *http.Request {
 }
 
 // requestBackendService is the method that actually makes the request to the backend service.
-// It also adds the `X-Proxy-Request-ID`, which is a UUID v4 string, to the header of every response
-// from the backend.
-func (s *ProxyServer) requestBackendService(w http.ResponseWriter, r *http.Request, reqID string) (code int, err error) {
+// The response is buffered so that it may be cached or shared before it is written to the client.
+func (s *ProxyServer) requestBackendService(r *http.Request) (resp *backendResponse, code int, err error) {
 	client := &http.Client{}
-	resp, err := client.Do(r)
+	res, err := client.Do(r)
 	if err != nil {
-		return 502, errors.New("bad gateway")
+		return nil, 502, errors.New("bad gateway")
 	}
 	defer client.CloseIdleConnections()
 
-	w.Header().Add("X-Proxy-Request-ID", reqID)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode)
-
-	newResp, err := io.Copy(w, resp.Body)
-	if err := resp.Body.Close(); err != nil {
+	body, err := io.ReadAll(res.Body)
+	if err := res.Body.Close(); err != nil {
 		s.logger.Error("failed to close response", zap.Error(err))
 	}
-	s.logger.Debug("copied bytes to client", zap.Int64("body", newResp))
+	if err != nil {
+		return nil, 502, errors.New("bad gateway")
+	}
+
+	resp = &backendResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}
 
 	// the status code is only used when the server encounters an error
 	// returning 418 I'M A TEAPOT status code as a place holder.
-	return 418, nil
+	return resp, 418, nil
 }
 
-// writeError writes and logs a JSON HTTP response error that conforms to the `proxyErrorResponse` struct defined above.
-func (s *ProxyServer) writeError(w http.ResponseWriter, code int, msg string) {
-	codeString := strconv.Itoa(code)
-	errJSON := proxyErrorResponse{
-		Code: codeString,
-		Msg:  msg,
-	}
-
-	s.logger.Info("response", zap.Any("error", errJSON))
+// writeResponse writes a backend response to the client. It also adds the `X-Proxy-Request-ID`,
+// which is a UUID v4 string, to the header of every response from the backend.
+func (s *ProxyServer) writeResponse(w http.ResponseWriter, resp *backendResponse, reqID string) {
+	w.Header().Set("X-Proxy-Request-ID", reqID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
 
-	buf, err := json.Marshal(&errJSON)
+	n, err := w.Write(resp.Body)
 	if err != nil {
-		buf = []byte("{\"code\": \"" + codeString + "\"\"msg\": \"There was a response that could not be serialized into JSON\"}")
+		s.logger.Error("failed to write response", zap.Error(err))
 	}
+	s.logger.Debug("copied bytes to client", zap.Int("body", n))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
-	w.WriteHeader(code)
-
-	_, writeErr := w.Write(buf)
-	if writeErr != nil {
-		// avoid unnecessary log / stderr messages in the unlikely event `w.Write()` returns an error
-		_ = writeErr
+// writeError writes and logs a JSON HTTP response error of the given class that conforms to the `proxyErrorResponse`
+// struct defined above, or to the error template when one is set. The status is code, unless overridden for the class.
+// Violations, if any, detail which parts of the request are invalid.
+func (s *ProxyServer) writeError(w http.ResponseWriter, class string, code int, msg string, violations ...jsonschema.Violation) {
+	if status, ok := s.errorStatus[class]; ok {
+		code = status
 	}
+	s.writeProxyError(w, &proxyError{class: class, status: code, msg: msg, violations: violations})
 }
 
 // copyBody returns two ReadClosers that yield the same bytes.
@@ -373,28 +507,3 @@ func (s *ProxyServer) copyBody(b io.ReadCloser) (r1 io.ReadCloser, r2 io.ReadClo
 	r2 = ioutil.NopCloser(bytes.NewBuffer(buf))
 	return r1, r2, nil
 }
-
-// copyHeader creates and returns a HeaderCopy.
-func (s *ProxyServer) copyHeader(h http.Header) (hc headerCopy) {
-	for k, vv := range h {
-		switch k {
-		case "Host":
-			hc.Host = vv
-		case "Accept":
-			hc.Accept = vv
-		case "User-Agent":
-			hc.UserAgent = vv
-		case "Connection":
-			hc.Connection = vv
-		case "Content-Type":
-			hc.ContentType = vv
-		case "Content-Length":
-			hc.ContentLength = vv
-		case "AcceptEncoding":
-			hc.AcceptEncoding = vv
-		default:
-			// do nothing
-		}
-	}
-	return hc
-}
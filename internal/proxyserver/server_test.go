@@ -1,10 +1,18 @@
 package proxyserver
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/janu-cambrelen/proxy-service/internal/statestore"
+	"github.com/janu-cambrelen/proxy-service/internal/textnorm"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 // TODO(TESTS): add unit tests for other ProxyServer methods
@@ -64,3 +72,80 @@ func TestBodyValidation(t *testing.T) {
 	}
 
 }
+
+// TestBodyValidationNormalization tests the validateRequestBody method on ProxyServer with a normalizer
+func TestBodyValidationNormalization(t *testing.T) {
+	n, err := textnorm.New("all")
+	assert.NoError(t, err)
+	server := &ProxyServer{rejectWith: "Bad_Message", rejectInsensitive: true}
+
+	// full-width letters, a zero-width space and a Cyrillic `е`
+	body := "{\"body\": \"\uff42ad\u200b_m\u0435ssage\"}"
+	assert.NoError(t, server.validateRequestBody(body))
+
+	server.WithNormalizer(n)
+	err = server.validateRequestBody(body)
+	assert.Error(t, err)
+	assert.Equal(t, "rejected because `bad_message` found within request body", err.Error())
+}
+
+// TestConsecutiveRequests tests that consecutive identical requests are delayed per client
+func TestConsecutiveRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	s := NewProxyServer(false, backend.URL, 1, false, "", false, false, zap.NewNop()).
+		WithClientIDHeader("X-API-Key")
+
+	send := func(remote string, key string, body string) time.Duration {
+		r := httptest.NewRequest("POST", "/posts", bytes.NewBufferString(body))
+		r.RemoteAddr = remote
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		start := time.Now()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code)
+		return time.Since(start)
+	}
+
+	// the first request of each client is never delayed, even if another client sent the same request
+	assert.Less(t, int64(send("10.0.0.1:1234", "", `{"body": "a"}`)), int64(500*time.Millisecond))
+	assert.Less(t, int64(send("10.0.0.2:1234", "", `{"body": "a"}`)), int64(500*time.Millisecond))
+	assert.Less(t, int64(send("10.0.0.1:1234", "key-1", `{"body": "a"}`)), int64(500*time.Millisecond))
+
+	// a different request from the same client resets its prior request
+	assert.Less(t, int64(send("10.0.0.1:1234", "", `{"body": "b"}`)), int64(500*time.Millisecond))
+
+	// consecutive identical requests from the same client are delayed
+	assert.GreaterOrEqual(t, int64(send("10.0.0.1:1234", "", `{"body": "b"}`)), int64(time.Second))
+	assert.GreaterOrEqual(t, int64(send("10.0.0.3:1234", "key-1", `{"body": "a"}`)), int64(time.Second))
+}
+
+// TestConcurrentRequests tests that concurrent requests from many clients are safe (run with -race)
+func TestConcurrentRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	s := NewProxyServer(false, backend.URL, 0, false, "", false, false, zap.NewNop()).
+		WithStateStore(statestore.NewMemoryStore(4))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/posts", bytes.NewBufferString(`{"body": "a"}`))
+			r.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i%8)
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+		}(i)
+	}
+	wg.Wait()
+}
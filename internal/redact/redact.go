@@ -0,0 +1,214 @@
+// Package redact masks or removes sensitive data, such as personal information, from JSON
+// documents and text.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/janu-cambrelen/proxy-service/internal/jsonpath"
+)
+
+// Patterns of personal information that can be redacted.
+const (
+	PatternEmail = "email" // email addresses
+	PatternPhone = "phone" // phone numbers, in North American or international format
+	PatternSSN   = "ssn"   // US social security numbers
+	PatternCard  = "card"  // payment card numbers that pass the Luhn check
+)
+
+// DefaultMask replaces redacted values when no other mask is set.
+const DefaultMask = "[REDACTED]"
+
+// pattern defines a kind of personal information found within text.
+type pattern struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool // further check of matches, if any
+}
+
+// patterns are applied in order, so that the digits of card numbers are not mistaken for
+// phone numbers.
+var patterns = []pattern{
+	{name: PatternCard, re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+	{name: PatternSSN, re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), valid: ssn},
+	{name: PatternPhone, re: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`)},
+	{name: PatternEmail, re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+}
+
+// Redactor masks the fields of JSON documents selected by paths, removes others, and masks
+// the personal information found within the remaining string values. The zero value, or a
+// nil Redactor, leaves documents as they are.
+type Redactor struct {
+	mask     string
+	masked   []jsonpath.Path
+	removed  []jsonpath.Path
+	patterns []pattern
+}
+
+// New returns a Redactor replacing the values of the masked fields, and the personal
+// information matching the named patterns ('email', 'phone', 'ssn', 'card' or 'all'),
+// with mask, and removing the removed fields. DefaultMask is used when mask is empty.
+func New(mask string, masked []string, removed []string, names []string) (*Redactor, error) {
+	if mask == "" {
+		mask = DefaultMask
+	}
+	r := &Redactor{mask: mask}
+	for _, expr := range masked {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		r.masked = append(r.masked, p)
+	}
+	for _, expr := range removed {
+		p, err := jsonpath.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		r.removed = append(r.removed, p)
+	}
+
+	enabled := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "all":
+			for _, p := range patterns {
+				enabled[p.name] = true
+			}
+		case PatternEmail, PatternPhone, PatternSSN, PatternCard:
+			enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown pattern `%s`, must be one of 'email', 'phone', 'ssn', 'card' or 'all'", name)
+		}
+	}
+	for _, p := range patterns {
+		if enabled[p.name] {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	return r, nil
+}
+
+// Enabled reports whether the Redactor changes anything.
+func (r *Redactor) Enabled() bool {
+	return r != nil && len(r.masked)+len(r.removed)+len(r.patterns) > 0
+}
+
+// Body redacts a document and returns it along with the number of values that were masked or
+// removed. JSON documents are re-encoded, with their keys in order, only when something was
+// redacted. Other documents are treated as text.
+func (r *Redactor) Body(body []byte) ([]byte, int) {
+	if !r.Enabled() || len(body) == 0 {
+		return body, 0
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil || d.More() {
+		text, n := r.Text(string(body))
+		return []byte(text), n
+	}
+
+	n := 0
+	for _, p := range r.removed {
+		n += len(p.Select(doc))
+		doc = p.Delete(doc)
+	}
+	for _, p := range r.masked {
+		doc = p.Replace(doc, func(interface{}) interface{} {
+			n++
+			return r.mask
+		})
+	}
+	if len(r.patterns) > 0 {
+		doc = r.strings(doc, &n)
+	}
+	if n == 0 {
+		return body, 0
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return body, 0
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), n
+}
+
+// Text masks the personal information found within text and returns it along with the
+// number of values that were masked.
+func (r *Redactor) Text(text string) (string, int) {
+	n := 0
+	if r == nil {
+		return text, n
+	}
+	for _, p := range r.patterns {
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if p.valid != nil && !p.valid(match) {
+				return match
+			}
+			n++
+			return r.mask
+		})
+	}
+	return text, n
+}
+
+// strings masks the personal information found within every string value of v, adding the
+// number of masked values to n.
+func (r *Redactor) strings(v interface{}, n *int) interface{} {
+	switch t := v.(type) {
+	case string:
+		text, m := r.Text(t)
+		*n += m
+		return text
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = r.strings(e, n)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = r.strings(e, n)
+		}
+	}
+	return v
+}
+
+// luhn reports whether the digits of a card number candidate pass the Luhn check.
+func luhn(match string) bool {
+	var digits []int
+	for _, c := range match {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// ssn reports whether a social security number candidate has been, or could be, issued.
+func ssn(match string) bool {
+	area, group, serial := match[0:3], match[4:6], match[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
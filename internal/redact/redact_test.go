@@ -0,0 +1,123 @@
+package redact
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestText tests the Text method on Redactor
+func TestText(t *testing.T) {
+	r, err := New("", nil, nil, []string{"all"})
+	assert.NoError(t, err)
+
+	type unitTestCase struct {
+		text     string
+		expected string
+		n        int
+	}
+
+	for _, tCase := range []unitTestCase{
+		{text: "write to jane.doe+news@example.co.uk", expected: "write to [REDACTED]", n: 1},
+		{text: "call (555) 123-4567 or +1 555.123.4567", expected: "call [REDACTED] or [REDACTED]", n: 2},
+		{text: "call 5551234567", expected: "call [REDACTED]", n: 1},
+		{text: "ssn 123-45-6789", expected: "ssn [REDACTED]", n: 1},
+		{text: "ssn 000-45-6789 or 666-45-6789", expected: "ssn 000-45-6789 or 666-45-6789"},
+		{text: "card 4111 1111 1111 1111", expected: "card [REDACTED]", n: 1},
+		{text: "card 4111-1111-1111-1111", expected: "card [REDACTED]", n: 1},
+		{text: "card 378282246310005", expected: "card [REDACTED]", n: 1},
+		// numbers failing the Luhn check are left as they are
+		{text: "order 4111111111111112", expected: "order 4111111111111112"},
+		{text: "id 12345", expected: "id 12345"},
+		{text: "nothing to see here", expected: "nothing to see here"},
+	} {
+		t.Run(fmt.Sprintf("text=%s", tCase.text), func(t *testing.T) {
+			text, n := r.Text(tCase.text)
+			assert.Equal(t, tCase.expected, text)
+			assert.Equal(t, tCase.n, n)
+		})
+	}
+}
+
+// TestBody tests the Body method on Redactor
+func TestBody(t *testing.T) {
+
+	type unitTestCase struct {
+		mask     string
+		masked   []string
+		removed  []string
+		patterns []string
+		body     string
+		expected string
+		n        int
+	}
+
+	for _, tCase := range []unitTestCase{
+		{
+			masked:   []string{"$.user.name", "$.items[*].secret"},
+			body:     `{"user": {"id": 1, "name": "jane"}, "items": [{"secret": 1}, {"secret": {"a": 1}}]}`,
+			expected: `{"items":[{"secret":"[REDACTED]"},{"secret":"[REDACTED]"}],"user":{"id":1,"name":"[REDACTED]"}}`,
+			n:        3,
+		},
+		{
+			mask:     "***",
+			removed:  []string{"$.user.password"},
+			patterns: []string{"email"},
+			body:     `{"user": {"password": "hunter2", "bio": "mail <jane@example.com>"}}`,
+			expected: `{"user":{"bio":"mail <***>"}}`,
+			n:        2,
+		},
+		{
+			patterns: []string{"ssn", "card"},
+			body:     `[{"note": "ssn 123-45-6789"}, 4111111111111111]`,
+			expected: `[{"note":"ssn [REDACTED]"},4111111111111111]`,
+			n:        1,
+		},
+		// documents are returned as they are when nothing is redacted
+		{
+			masked:   []string{"$.missing"},
+			patterns: []string{"email"},
+			body:     `{"b": 1.50, "a": "x"}`,
+			expected: `{"b": 1.50, "a": "x"}`,
+		},
+		// other documents are treated as text
+		{
+			masked:   []string{"$.user"},
+			patterns: []string{"email"},
+			body:     `contact jane@example.com`,
+			expected: `contact [REDACTED]`,
+			n:        1,
+		},
+	} {
+		t.Run(fmt.Sprintf("body=%s", tCase.body), func(t *testing.T) {
+			r, err := New(tCase.mask, tCase.masked, tCase.removed, tCase.patterns)
+			assert.NoError(t, err)
+			assert.True(t, r.Enabled())
+
+			body, n := r.Body([]byte(tCase.body))
+			assert.Equal(t, tCase.expected, string(body))
+			assert.Equal(t, tCase.n, n)
+		})
+	}
+}
+
+// TestNew tests that New rejects invalid paths and patterns
+func TestNew(t *testing.T) {
+	_, err := New("", []string{"$["}, nil, nil)
+	assert.Error(t, err)
+	_, err = New("", nil, []string{"$.."}, nil)
+	assert.Error(t, err)
+	_, err = New("", nil, nil, []string{"passport"})
+	assert.Error(t, err)
+
+	r, err := New("", nil, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, r.Enabled())
+
+	var nilRedactor *Redactor
+	assert.False(t, nilRedactor.Enabled())
+	body, n := nilRedactor.Body([]byte(`{"a": 1}`))
+	assert.Equal(t, `{"a": 1}`, string(body))
+	assert.Equal(t, 0, n)
+}
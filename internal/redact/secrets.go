@@ -0,0 +1,222 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Detectors of secrets and sensitive data within request bodies.
+const (
+	DetectorAWSKey     = "aws_key"     // AWS access key IDs and secret access keys
+	DetectorPrivateKey = "private_key" // PEM encoded private keys
+	DetectorJWT        = "jwt"         // JSON Web Tokens
+	DetectorToken      = "token"       // generic high-entropy tokens, such as API keys
+	DetectorCard       = "card"        // payment card numbers that pass the Luhn check
+)
+
+// Actions taken on the secrets found by a detector.
+const (
+	ActionBlock  = "block"  // reject the request
+	ActionRedact = "redact" // replace the secret with the mask
+)
+
+// minTokenEntropy is the Shannon entropy, in bits per character, from which a token is deemed
+// random. Hexadecimal strings, such as hashes and UUIDs, cannot reach it.
+const minTokenEntropy = 4.2
+
+// detector defines a kind of secret found within text.
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	group int                      // submatch holding the secret, the whole match when 0
+	valid func(secret string) bool // further check of secrets, if any
+}
+
+// detectors are applied in order, secrets found by an earlier detector are not reported again
+// by a later one (e.g., JWTs are not reported as tokens as well).
+var detectors = []detector{
+	{name: DetectorPrivateKey, re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----(?:[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----)?`)},
+	{name: DetectorAWSKey, re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{name: DetectorAWSKey, re: regexp.MustCompile(`(?i)aws.{0,20}?secret.{0,20}?["':=\s]+([A-Za-z0-9/+=]{40})(?:[^A-Za-z0-9/+=]|$)`), group: 1},
+	{name: DetectorJWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), valid: jwt},
+	{name: DetectorCard, re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+	{name: DetectorToken, re: regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`), valid: random},
+}
+
+// Finding defines a secret found by a Scanner. It never holds the secret itself, so that it can
+// safely be logged.
+type Finding struct {
+	Detector    string // detector that found the secret
+	Action      string // action taken on the secret
+	Offset      int    // byte offset of the secret within the text
+	Length      int    // length of the secret in bytes
+	Fingerprint string // truncated SHA-256 of the secret, so that findings can be correlated
+}
+
+// Scanner finds secrets within text, using the detectors it was created with.
+type Scanner struct {
+	mask    string
+	actions map[string]string
+}
+
+// NewScanner returns a Scanner using the given detectors, mapped to the action taken on the
+// secrets they find. Redacted secrets are replaced by mask, or DefaultMask when it is empty.
+func NewScanner(actions map[string]string, mask string) (*Scanner, error) {
+	if mask == "" {
+		mask = DefaultMask
+	}
+	s := &Scanner{mask: mask, actions: map[string]string{}}
+	for name, action := range actions {
+		switch name {
+		case DetectorAWSKey, DetectorPrivateKey, DetectorJWT, DetectorToken, DetectorCard:
+		default:
+			return nil, fmt.Errorf("unknown detector `%s`, must be one of 'aws_key', 'private_key', 'jwt', 'token' or 'card'", name)
+		}
+		switch action {
+		case ActionBlock, ActionRedact:
+		default:
+			return nil, fmt.Errorf("invalid action `%s` of detector `%s`, must be one of 'block' or 'redact'", action, name)
+		}
+		s.actions[name] = action
+	}
+	return s, nil
+}
+
+// ParseScanner returns a Scanner using the detectors of a comma-separated list, each optionally
+// followed by its action (e.g., `aws_key,jwt:redact`). Detectors block requests by default,
+// and `all` enables every detector.
+func ParseScanner(spec string, mask string) (*Scanner, error) {
+	actions := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, action := item, ActionBlock
+		if i := strings.Index(item, ":"); i >= 0 {
+			name, action = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		if name == "all" {
+			for _, d := range detectors {
+				actions[d.name] = action
+			}
+			continue
+		}
+		actions[name] = action
+	}
+	return NewScanner(actions, mask)
+}
+
+// Enabled reports whether the Scanner uses any detector.
+func (s *Scanner) Enabled() bool {
+	return s != nil && len(s.actions) > 0
+}
+
+// Scan returns the text with the secrets found by detectors with the `redact` action replaced
+// by the mask, along with every secret found, in order.
+func (s *Scanner) Scan(text string) (string, []Finding) {
+	if !s.Enabled() {
+		return text, nil
+	}
+
+	type secret struct {
+		start, end int
+		detector   string
+	}
+	var secrets []secret
+	overlaps := func(start, end int) bool {
+		for _, sec := range secrets {
+			if start < sec.end && sec.start < end {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range detectors {
+		if s.actions[d.name] == "" {
+			continue
+		}
+		for _, m := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*d.group], m[2*d.group+1]
+			if start < 0 || overlaps(start, end) || (d.valid != nil && !d.valid(text[start:end])) {
+				continue
+			}
+			secrets = append(secrets, secret{start: start, end: end, detector: d.name})
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].start < secrets[j].start })
+
+	var b strings.Builder
+	var findings []Finding
+	last := 0
+	for _, sec := range secrets {
+		sum := sha256.Sum256([]byte(text[sec.start:sec.end]))
+		f := Finding{
+			Detector:    sec.detector,
+			Action:      s.actions[sec.detector],
+			Offset:      sec.start,
+			Length:      sec.end - sec.start,
+			Fingerprint: hex.EncodeToString(sum[:])[:12],
+		}
+		findings = append(findings, f)
+		if f.Action == ActionRedact {
+			b.WriteString(text[last:sec.start])
+			b.WriteString(s.mask)
+			last = sec.end
+		}
+	}
+	if last == 0 {
+		return text, findings
+	}
+	b.WriteString(text[last:])
+	return b.String(), findings
+}
+
+// jwt reports whether a JSON Web Token candidate has a header naming its algorithm.
+func jwt(token string) bool {
+	header, err := base64.RawURLEncoding.DecodeString(token[:strings.Index(token, ".")])
+	if err != nil {
+		return false
+	}
+	var h map[string]interface{}
+	if err := json.Unmarshal(header, &h); err != nil {
+		return false
+	}
+	_, ok := h["alg"]
+	return ok
+}
+
+// random reports whether a token candidate looks randomly generated: it mixes upper case
+// letters, lower case letters and digits, and its entropy is high.
+func random(token string) bool {
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(token))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minTokenEntropy
+}
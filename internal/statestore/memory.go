@@ -0,0 +1,181 @@
+package statestore
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryItem defines a value held by a MemoryStore.
+type memoryItem struct {
+	key     string
+	value   []byte
+	expires time.Time // zero when the item does not expire
+}
+
+// MemoryStore is an in-process Store. Its state is not shared between replicas.
+// When bounded, the least recently written keys are evicted once the store is full.
+type MemoryStore struct {
+	mu        sync.Mutex
+	maxItems  int
+	items     map[string]*list.Element
+	order     *list.List // most recently written items at the front
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore constructor creates a new MemoryStore holding at most maxItems keys.
+// The store is unbounded when maxItems is 0.
+func NewMemoryStore(maxItems int) *MemoryStore {
+	return &MemoryStore{
+		maxItems: maxItems,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value stored under key or ErrNotFound.
+func (m *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return it.value, nil
+}
+
+// Set stores value under key.
+func (m *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, ttl)
+	return nil
+}
+
+// SetNX stores value under key only if the key does not exist.
+func (m *MemoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+// CompareAndSwap stores value under key only if the current value equals old.
+func (m *MemoryStore) CompareAndSwap(ctx context.Context, key string, old []byte, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.get(key)
+	if ok != (old != nil) || (ok && !bytes.Equal(it.value, old)) {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+// Swap stores value under key and returns the previous value.
+func (m *MemoryStore) Swap(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.get(key)
+	m.set(key, value, ttl)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return it.value, nil
+}
+
+// Incr increments the counter stored under key.
+func (m *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.get(key)
+	if !ok {
+		m.set(key, []byte("1"), ttl)
+		return 1, nil
+	}
+
+	n, err := strconv.ParseInt(string(it.value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	n++
+	it.value = []byte(strconv.FormatInt(n, 10))
+	m.order.MoveToFront(m.items[key])
+	return n, nil
+}
+
+// Delete removes key, if it exists.
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.items[key]; ok {
+		m.remove(e)
+	}
+	return nil
+}
+
+// Len returns the number of keys held by the store, including expired keys
+// that have not been removed yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// get returns the unexpired item stored under key. The caller must hold the lock.
+func (m *MemoryStore) get(key string) (*memoryItem, bool) {
+	e, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	it := e.Value.(*memoryItem)
+	if !it.expires.IsZero() && !m.now().Before(it.expires) {
+		m.remove(e)
+		return nil, false
+	}
+	return it, true
+}
+
+// set stores the item, removes expired items at most once a minute, and evicts
+// the least recently written items while the store is over capacity.
+// The caller must hold the lock.
+func (m *MemoryStore) set(key string, value []byte, ttl time.Duration) {
+	now := m.now()
+	it := &memoryItem{key: key, value: value}
+	if ttl > 0 {
+		it.expires = now.Add(ttl)
+	}
+	if e, ok := m.items[key]; ok {
+		e.Value = it
+		m.order.MoveToFront(e)
+	} else {
+		m.items[key] = m.order.PushFront(it)
+	}
+
+	if now.Sub(m.lastSweep) >= time.Minute {
+		for _, e := range m.items {
+			if it := e.Value.(*memoryItem); !it.expires.IsZero() && !now.Before(it.expires) {
+				m.remove(e)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	for m.maxItems > 0 && len(m.items) > m.maxItems {
+		m.remove(m.order.Back())
+	}
+}
+
+// remove deletes the item held by the list element. The caller must hold the lock.
+func (m *MemoryStore) remove(e *list.Element) {
+	m.order.Remove(e)
+	delete(m.items, e.Value.(*memoryItem).key)
+}
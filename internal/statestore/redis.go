@@ -0,0 +1,340 @@
+package statestore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// redisPoolSize is the number of idle connections kept by a RedisStore.
+	redisPoolSize = 16
+	// redisTimeout bounds each command when the context has no deadline.
+	redisTimeout = 5 * time.Second
+)
+
+// scripts run server-side so that read-modify-write operations are atomic across replicas
+const (
+	// casScript implements CompareAndSwap. ARGV: old exists (0/1), old value, new value, ttl in ms.
+	casScript = `local cur = redis.call('GET', KEYS[1])
+if ARGV[1] == '0' then
+  if cur then return 0 end
+elseif cur ~= ARGV[2] then
+  return 0
+end
+if tonumber(ARGV[4]) > 0 then
+  redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[4])
+else
+  redis.call('SET', KEYS[1], ARGV[3])
+end
+return 1`
+
+	// swapScript implements Swap. ARGV: new value, ttl in ms.
+	swapScript = `local old = redis.call('GET', KEYS[1])
+if tonumber(ARGV[2]) > 0 then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+  redis.call('SET', KEYS[1], ARGV[1])
+end
+return old`
+
+	// incrScript implements Incr. ARGV: ttl in ms.
+	incrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n`
+)
+
+// errRedisNil is returned by `do` when the server replies with a null bulk string.
+var errRedisNil = errors.New("redis: nil")
+
+// redisConn defines a connection to a Redis server.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// RedisStore is a Store backed by a server that speaks the Redis protocol (RESP),
+// so that its state is shared by every replica using the same server.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+// NewRedisStore constructor creates a new RedisStore from a URL of the form
+// `redis://[:password@]host:port[/db]`. Connections are established lazily.
+func NewRedisStore(rawurl string) (*RedisStore, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("redis url must include a host")
+	}
+
+	s := &RedisStore{
+		addr: u.Host,
+		pool: make(chan *redisConn, redisPoolSize),
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		s.addr = net.JoinHostPort(u.Host, "6379")
+	}
+	if u.User != nil {
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database `%s`", db)
+		}
+	}
+	return s, nil
+}
+
+// Get returns the value stored under key or ErrNotFound.
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.do(ctx, "GET", key)
+	if err == errRedisNil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// Set stores value under key.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+	_, err := s.do(ctx, args...)
+	return err
+}
+
+// SetNX stores value under key only if the key does not exist.
+func (s *RedisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", milliseconds(ttl))
+	}
+	_, err := s.do(ctx, args...)
+	if err == errRedisNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompareAndSwap stores value under key only if the current value equals old.
+func (s *RedisStore) CompareAndSwap(ctx context.Context, key string, old []byte, value []byte, ttl time.Duration) (bool, error) {
+	exists := "1"
+	if old == nil {
+		exists = "0"
+	}
+	v, err := s.do(ctx, "EVAL", casScript, "1", key, exists, string(old), string(value), milliseconds(ttl))
+	if err != nil {
+		return false, err
+	}
+	return v.(int64) == 1, nil
+}
+
+// Swap stores value under key and returns the previous value.
+func (s *RedisStore) Swap(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error) {
+	v, err := s.do(ctx, "EVAL", swapScript, "1", key, string(value), milliseconds(ttl))
+	if err == errRedisNil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// Incr increments the counter stored under key.
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	v, err := s.do(ctx, "EVAL", incrScript, "1", key, milliseconds(ttl))
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+// Delete removes key, if it exists.
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", key)
+	return err
+}
+
+// Close closes the idle connections held by the store.
+func (s *RedisStore) Close() error {
+	for {
+		select {
+		case c := <-s.pool:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply. Replies are decoded as `string` (simple strings),
+// `int64` (integers), `[]byte` (bulk strings) or `[]interface{}` (arrays).
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	v, err := c.roundTrip(args)
+	var serverErr redisError
+	if err != nil && err != errRedisNil && !errors.As(err, &serverErr) {
+		// the connection is in an unknown state
+		c.Close()
+		return nil, err
+	}
+
+	select {
+	case s.pool <- c:
+	default:
+		c.Close()
+	}
+	return v, err
+}
+
+// conn returns an idle connection or dials a new one.
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.pool:
+		return c, nil
+	default:
+	}
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if err := c.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if s.password != "" {
+		if _, err := c.roundTrip([]string{"AUTH", s.password}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.roundTrip([]string{"SELECT", strconv.Itoa(s.db)}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// milliseconds formats the ttl in whole milliseconds, rounding positive values up to at least 1.
+func milliseconds(ttl time.Duration) string {
+	ms := ttl.Milliseconds()
+	if ttl > 0 && ms == 0 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// redisError defines an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// roundTrip writes a command as an array of bulk strings and reads its reply.
+func (c *redisConn) roundTrip(args []string) (interface{}, error) {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads a single RESP reply.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		vv := make([]interface{}, n)
+		for i := range vv {
+			v, err := c.readReply()
+			var serverErr redisError
+			switch {
+			case errors.As(err, &serverErr):
+				vv[i] = serverErr
+			case err != nil && err != errRedisNil:
+				return nil, err
+			default:
+				vv[i] = v
+			}
+		}
+		return vv, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply type `%c`", kind)
+}
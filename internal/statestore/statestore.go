@@ -0,0 +1,56 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when no value exists for the given key.
+var ErrNotFound = errors.New("state store key not found")
+
+// Store defines a key/value store for counters and keys with a time to live.
+// It holds the state that must be shared by every replica of the proxy, such as
+// rate limit buckets and duplicate request records. Implementations must be safe
+// for concurrent use. A ttl of 0 means the key does not expire.
+type Store interface {
+	// Get returns the value stored under key or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value under key only if the key does not exist. It reports whether the value was stored.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// CompareAndSwap stores value under key only if the current value equals old, or if the key does
+	// not exist when old is nil. It reports whether the value was stored.
+	CompareAndSwap(ctx context.Context, key string, old []byte, value []byte, ttl time.Duration) (bool, error)
+	// Swap stores value under key and returns the previous value, or ErrNotFound if the key did not exist.
+	Swap(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error)
+	// Incr increments the counter stored under key and returns its new value. The ttl is only
+	// applied when the counter is created.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Delete removes key, if it exists.
+	Delete(ctx context.Context, key string) error
+}
+
+// DefaultMemoryStoreMaxItems is the default bound of a MemoryStore, it is used by Open.
+const DefaultMemoryStoreMaxItems = 100000
+
+// Open returns the Store described by the given URL. An empty URL returns a new bounded
+// MemoryStore and a `redis://` URL returns a RedisStore.
+func Open(rawurl string) (Store, error) {
+	if rawurl == "" {
+		return NewMemoryStore(DefaultMemoryStoreMaxItems), nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "redis":
+		return NewRedisStore(rawurl)
+	}
+	return nil, fmt.Errorf("unsupported state store scheme `%s`", u.Scheme)
+}
@@ -0,0 +1,225 @@
+package statestore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// stores returns a MemoryStore and a RedisStore backed by miniredis along with
+// functions to advance their clocks.
+func stores(t *testing.T) map[string]struct {
+	store   Store
+	advance func(time.Duration)
+} {
+	now := time.Now()
+	mem := NewMemoryStore(0)
+	mem.now = func() time.Time { return now }
+
+	mr := miniredis.RunT(t)
+	rs, err := NewRedisStore("redis://" + mr.Addr())
+	assert.NoError(t, err)
+	t.Cleanup(func() { rs.Close() })
+
+	return map[string]struct {
+		store   Store
+		advance func(time.Duration)
+	}{
+		"memory": {store: mem, advance: func(d time.Duration) { now = now.Add(d) }},
+		"redis":  {store: rs, advance: mr.FastForward},
+	}
+}
+
+// TestStore tests the Store implementations
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	for name, tc := range stores(t) {
+		s := tc.store
+		t.Run(name, func(t *testing.T) {
+
+			t.Run("get and set", func(t *testing.T) {
+				_, err := s.Get(ctx, "missing")
+				assert.ErrorIs(t, err, ErrNotFound)
+
+				assert.NoError(t, s.Set(ctx, "key", []byte("value"), 0))
+				v, err := s.Get(ctx, "key")
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("value"), v)
+
+				assert.NoError(t, s.Set(ctx, "empty", []byte{}, 0))
+				v, err = s.Get(ctx, "empty")
+				assert.NoError(t, err)
+				assert.Empty(t, v)
+
+				assert.NoError(t, s.Delete(ctx, "key"))
+				_, err = s.Get(ctx, "key")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("set nx", func(t *testing.T) {
+				ok, err := s.SetNX(ctx, "nx", []byte("first"), time.Minute)
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				ok, err = s.SetNX(ctx, "nx", []byte("second"), time.Minute)
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				v, _ := s.Get(ctx, "nx")
+				assert.Equal(t, []byte("first"), v)
+			})
+
+			t.Run("compare and swap", func(t *testing.T) {
+				ok, err := s.CompareAndSwap(ctx, "cas", nil, []byte("1"), 0)
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				ok, err = s.CompareAndSwap(ctx, "cas", nil, []byte("2"), 0)
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				ok, err = s.CompareAndSwap(ctx, "cas", []byte("0"), []byte("2"), 0)
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				ok, err = s.CompareAndSwap(ctx, "cas", []byte("1"), []byte("2"), 0)
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				v, _ := s.Get(ctx, "cas")
+				assert.Equal(t, []byte("2"), v)
+			})
+
+			t.Run("swap", func(t *testing.T) {
+				_, err := s.Swap(ctx, "swap", []byte("1"), 0)
+				assert.ErrorIs(t, err, ErrNotFound)
+
+				old, err := s.Swap(ctx, "swap", []byte("2"), 0)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("1"), old)
+
+				v, _ := s.Get(ctx, "swap")
+				assert.Equal(t, []byte("2"), v)
+			})
+
+			t.Run("incr", func(t *testing.T) {
+				for i := int64(1); i <= 3; i++ {
+					n, err := s.Incr(ctx, "counter", time.Minute)
+					assert.NoError(t, err)
+					assert.Equal(t, i, n)
+				}
+			})
+
+			t.Run("ttl", func(t *testing.T) {
+				assert.NoError(t, s.Set(ctx, "ttl-set", []byte("v"), time.Second))
+				_, err := s.SetNX(ctx, "ttl-setnx", []byte("v"), time.Second)
+				assert.NoError(t, err)
+				_, err = s.CompareAndSwap(ctx, "ttl-cas", nil, []byte("v"), time.Second)
+				assert.NoError(t, err)
+				_, err = s.Swap(ctx, "ttl-swap", []byte("v"), time.Second)
+				assert.ErrorIs(t, err, ErrNotFound)
+				_, err = s.Incr(ctx, "ttl-incr", time.Second)
+				assert.NoError(t, err)
+				assert.NoError(t, s.Set(ctx, "no-ttl", []byte("v"), 0))
+
+				tc.advance(2 * time.Second)
+
+				for _, k := range []string{"ttl-set", "ttl-setnx", "ttl-cas", "ttl-swap", "ttl-incr"} {
+					_, err := s.Get(ctx, k)
+					assert.ErrorIs(t, err, ErrNotFound, k)
+				}
+				_, err = s.Get(ctx, "no-ttl")
+				assert.NoError(t, err)
+			})
+		})
+	}
+}
+
+// TestMemoryStoreBound tests that a bounded MemoryStore evicts the least recently written keys
+func TestMemoryStoreBound(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2)
+
+	assert.NoError(t, s.Set(ctx, "a", []byte("1"), 0))
+	assert.NoError(t, s.Set(ctx, "b", []byte("1"), 0))
+	assert.NoError(t, s.Set(ctx, "a", []byte("2"), 0))
+	assert.NoError(t, s.Set(ctx, "c", []byte("1"), 0))
+
+	assert.Equal(t, 2, s.Len())
+	_, err := s.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	v, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), v)
+	_, err = s.Get(ctx, "c")
+	assert.NoError(t, err)
+}
+
+// TestMemoryStoreConcurrency tests that a MemoryStore is safe for concurrent use (run with -race)
+func TestMemoryStoreConcurrency(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i % 12)
+			for j := 0; j < 100; j++ {
+				s.Set(ctx, key, []byte("v"), time.Minute)
+				s.Swap(ctx, key, []byte("w"), time.Minute)
+				s.Incr(ctx, "counter", 0)
+				s.Get(ctx, key)
+				s.Delete(ctx, key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, s.Len(), 8)
+}
+
+// TestOpen tests the Open function
+func TestOpen(t *testing.T) {
+	s, err := Open("")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = Open("redis://:secret@localhost/2")
+	assert.NoError(t, err)
+	rs := s.(*RedisStore)
+	assert.Equal(t, "localhost:6379", rs.addr)
+	assert.Equal(t, "secret", rs.password)
+	assert.Equal(t, 2, rs.db)
+
+	_, err = Open("memcached://localhost")
+	assert.Error(t, err)
+}
+
+// TestRedisAuth tests that a RedisStore authenticates and selects its database
+func TestRedisAuth(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	rs, err := NewRedisStore("redis://:wrong@" + mr.Addr())
+	assert.NoError(t, err)
+	assert.Error(t, rs.Set(ctx, "key", []byte("v"), 0))
+
+	rs, err = NewRedisStore("redis://:secret@" + mr.Addr() + "/3")
+	assert.NoError(t, err)
+	defer rs.Close()
+	assert.NoError(t, rs.Set(ctx, "key", []byte("v"), 0))
+
+	mr.Select(3)
+	v, err := mr.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", v)
+}
@@ -0,0 +1,34 @@
+package textnorm
+
+// confusables maps characters commonly substituted for Latin letters to the letter they
+// imitate. It is a subset of the Unicode confusables data (UTS #39) covering the Latin,
+// Cyrillic, Greek and Armenian homoglyphs of Latin letters. Upper case letters are mapped to
+// upper case prototypes, so that case sensitive rules keep working without case folding.
+var confusables = map[rune]rune{
+	// Latin look-alikes
+	'ı': 'i', 'ȷ': 'j', 'ɑ': 'a', 'ɡ': 'g', 'ɩ': 'i', 'ɪ': 'i', 'ʏ': 'y', 'ℓ': 'l',
+	'ꜱ': 's', 'ᴄ': 'c', 'ᴏ': 'o', 'ᴜ': 'u', 'ᴠ': 'v', 'ᴡ': 'w', 'ᴢ': 'z', 'ƅ': 'b',
+
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j', 'о': 'o', 'р': 'p', 'с': 'c',
+	'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'ӏ': 'l',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'Ё': 'E', 'Һ': 'H', 'І': 'I', 'Ї': 'I', 'Ј': 'J', 'К': 'K', 'М': 'M',
+	'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S', 'Ԁ': 'D', 'Ԛ': 'Q',
+	'Ԝ': 'W', 'Ү': 'Y', 'Ӏ': 'I',
+
+	// Greek
+	'α': 'a', 'γ': 'y', 'η': 'n', 'ι': 'i', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'χ': 'x',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O',
+	'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'ց': 'g', 'հ': 'h', 'ո': 'n', 'զ': 'q',
+}
+
+// leetspeak maps the digits and signs written in place of Latin letters (e.g., `b4d`) to the
+// letter they stand for. They are not confusable with those letters, so the mapping is kept
+// apart from the confusables data and only applied when asked for.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'l', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '|': 'l', '!': 'i',
+}
@@ -0,0 +1,122 @@
+package textnorm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Steps of the normalization pipeline, in the order they are applied.
+const (
+	StepInvisible   = "invisible"   // remove invisible characters, such as zero-width spaces and joiners
+	StepNFKC        = "nfkc"        // apply compatibility normalization, such as full-width to ASCII letters
+	StepCaseFold    = "casefold"    // apply full Unicode case folding
+	StepConfusables = "confusables" // map homoglyphs to a common skeleton and remove combining marks
+	StepLeetspeak   = "leetspeak"   // map digits and signs written in place of letters to those letters
+)
+
+// Normalizer normalizes text before it is matched against filtering rules, so that
+// visually equivalent text cannot be used to evade them. The zero value leaves text
+// unchanged. A Normalizer is safe for concurrent use.
+type Normalizer struct {
+	invisible   bool
+	nfkc        bool
+	caseFold    bool
+	confusables bool
+	leetspeak   bool
+}
+
+// New constructor creates a new Normalizer applying the given steps. The steps are
+// always applied in the order of their declaration, whatever their given order. `all`
+// applies every step but leetspeak, which alters ordinary text such as numbers.
+func New(steps ...string) (Normalizer, error) {
+	var n Normalizer
+	for _, s := range steps {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "":
+		case "all":
+			n = Normalizer{invisible: true, nfkc: true, caseFold: true, confusables: true, leetspeak: n.leetspeak}
+		case StepInvisible:
+			n.invisible = true
+		case StepNFKC:
+			n.nfkc = true
+		case StepCaseFold:
+			n.caseFold = true
+		case StepConfusables:
+			n.confusables = true
+		case StepLeetspeak:
+			n.leetspeak = true
+		default:
+			return Normalizer{}, fmt.Errorf("unknown normalization step %q must be one of 'invisible', 'nfkc', 'casefold', 'confusables', 'leetspeak' or 'all'", s)
+		}
+	}
+	return n, nil
+}
+
+// Parse creates a new Normalizer from a comma-separated list of steps (e.g., `nfkc,casefold`).
+func Parse(spec string) (Normalizer, error) {
+	return New(strings.Split(spec, ",")...)
+}
+
+// Enabled reports whether any step is applied.
+func (n Normalizer) Enabled() bool {
+	return n.invisible || n.nfkc || n.caseFold || n.confusables || n.leetspeak
+}
+
+// String returns the normalized form of s.
+func (n Normalizer) String(s string) string {
+	if n.invisible {
+		s = strings.Map(func(r rune) rune {
+			if isInvisible(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if n.nfkc {
+		s = norm.NFKC.String(s)
+	}
+	if n.caseFold {
+		// a Caser holds state, so one is created for every call
+		s = cases.Fold().String(s)
+	}
+	if n.confusables {
+		s = skeleton(s)
+	}
+	if n.leetspeak {
+		s = strings.Map(func(r rune) rune {
+			if l, ok := leetspeak[r]; ok {
+				return l
+			}
+			return r
+		}, s)
+	}
+	return s
+}
+
+// isInvisible reports whether r is rendered without any glyph, such as a zero-width space,
+// a joiner, a soft hyphen, a byte order mark, a bidirectional control or a variation selector.
+func isInvisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r) ||
+		unicode.Is(unicode.Variation_Selector, r) ||
+		unicode.Is(unicode.Other_Default_Ignorable_Code_Point, r)
+}
+
+// skeleton decomposes s, removes its combining marks and maps every confusable character
+// to its prototype, so that strings that look alike share the same skeleton.
+func skeleton(s string) string {
+	s = norm.NFD.String(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) {
+			return -1
+		}
+		if p, ok := confusables[r]; ok {
+			return p
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
@@ -0,0 +1,85 @@
+package textnorm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bypasses are variants of `bad_message` that evade a case-insensitive `strings.Contains`
+// check, along with the step that catches each of them.
+var bypasses = []struct {
+	name  string
+	text  string
+	steps []string
+}{
+	{name: "zero-width space", text: "bad\u200b_message", steps: []string{StepInvisible}},
+	{name: "zero-width joiner", text: "b\u200dad_mess\u200dage", steps: []string{StepInvisible}},
+	{name: "soft hyphen", text: "bad_mes\u00adsage", steps: []string{StepInvisible}},
+	{name: "byte order mark", text: "\ufeffbad_\ufeffmessage", steps: []string{StepInvisible}},
+	{name: "word joiner", text: "bad_\u2060message", steps: []string{StepInvisible}},
+	{name: "variation selector", text: "ba\ufe0fd_message", steps: []string{StepInvisible}},
+	{name: "full-width letters", text: "\uff42\uff41\uff44_message", steps: []string{StepNFKC}},
+	{name: "full-width low line", text: "bad\uff3fmessage", steps: []string{StepNFKC}},
+	{name: "mathematical letters", text: "\U0001d41b\U0001d41a\U0001d41d_message", steps: []string{StepNFKC}},
+	{name: "circled letters", text: "\u24d1\u24d0\u24d3_message", steps: []string{StepNFKC}},
+	{name: "long s", text: "bad_me\u017f\u017fage", steps: []string{StepCaseFold}},
+	{name: "combining marks", text: "b\u0336a\u0336d\u0336_message", steps: []string{StepConfusables}},
+	{name: "accents", text: "b\u00e1d_m\u00e9ssage", steps: []string{StepConfusables}},
+	{name: "cyrillic a and e", text: "b\u0430d_m\u0435ssage", steps: []string{StepConfusables}},
+	{name: "greek alpha", text: "bad_mess\u03b1ge", steps: []string{StepConfusables}},
+	{name: "digits", text: "b4d_m3ssage", steps: []string{StepLeetspeak}},
+	{name: "signs", text: "b@d_me$$age", steps: []string{StepLeetspeak}},
+	{name: "combined", text: "\uff22\u0410\u200bD_m\u0435\u0455\u0455\u0430g\u0435", steps: []string{StepInvisible, StepNFKC, StepCaseFold, StepConfusables}},
+}
+
+// TestBypasses tests that each normalization step catches the bypasses it is meant for
+func TestBypasses(t *testing.T) {
+	for _, b := range bypasses {
+		t.Run(fmt.Sprintf("name=%s", b.name), func(t *testing.T) {
+			phrase := "bad_message"
+
+			// the bypass evades the current case-insensitive check
+			assert.NotContains(t, strings.ToLower(b.text), phrase)
+
+			n, err := New(b.steps...)
+			assert.NoError(t, err)
+			assert.Contains(t, strings.ToLower(n.String(b.text)), n.String(phrase))
+
+			// and every step together
+			all, _ := New("all", StepLeetspeak)
+			assert.Contains(t, all.String(b.text), all.String(phrase))
+		})
+	}
+}
+
+// TestNormalizer tests the String method on Normalizer
+func TestNormalizer(t *testing.T) {
+	var zero Normalizer
+	assert.False(t, zero.Enabled())
+	assert.Equal(t, "B\u200bad", zero.String("B\u200bad"))
+
+	n, err := Parse("nfkc, casefold")
+	assert.NoError(t, err)
+	assert.True(t, n.Enabled())
+	assert.Equal(t, "bad", n.String("\uff22AD"))
+
+	// text that needs no normalization is left as it is
+	all, _ := New("all")
+	assert.Equal(t, "plain text", all.String("plain text"))
+
+	// leetspeak is only applied when asked for
+	assert.Equal(t, "b4d", all.String("b4d"))
+	n, err = Parse("leetspeak,all")
+	assert.NoError(t, err)
+	assert.Equal(t, "bad", n.String("b4d"))
+
+	_, err = Parse("nfkc,soundex")
+	assert.Error(t, err)
+
+	n, err = Parse("")
+	assert.NoError(t, err)
+	assert.False(t, n.Enabled())
+}